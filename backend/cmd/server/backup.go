@@ -0,0 +1,88 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/nlstn/go-odata"
+	"github.com/nlstn/my-crm/backend/database"
+	"github.com/nlstn/my-crm/backend/workflows"
+	"gorm.io/gorm"
+)
+
+// registerBackupActions registers ExportAllData, which downloads every table as one archive, and RestoreData,
+// which loads such an archive into an empty database.
+func registerBackupActions(service *odata.Service, db *gorm.DB) error {
+	if err := service.RegisterAction(odata.ActionDefinition{
+		Name:       "ExportAllData",
+		IsBound:    false,
+		EntitySet:  "",
+		Parameters: nil,
+		ReturnType: nil,
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			writeDownloadHeaders(w, "application/zip", "backup", "zip")
+
+			// The response has already started, so failures can only be logged.
+			if _, err := database.WriteBackup(r.Context(), db, w); err != nil {
+				log.Printf("ExportAllData failed while streaming: %v", err)
+			}
+			return nil
+		},
+	}); err != nil {
+		return err
+	}
+
+	return service.RegisterAction(odata.ActionDefinition{
+		Name:      "RestoreData",
+		IsBound:   false,
+		EntitySet: "",
+		Parameters: []odata.ParameterDefinition{
+			{Name: "Zip", Type: reflect.TypeOf(""), Required: true},
+		},
+		ReturnType: reflect.TypeOf(map[string]interface{}{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			payload, ok := params["Zip"].(string)
+			if !ok || strings.TrimSpace(payload) == "" {
+				return writeJSONError(w, http.StatusBadRequest, "Zip parameter is required")
+			}
+			data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+			if err != nil {
+				return writeJSONError(w, http.StatusBadRequest, "Zip must be base64 encoded")
+			}
+			archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+			if err != nil {
+				return writeJSONError(w, http.StatusBadRequest, "Zip is not a valid ZIP archive")
+			}
+			manifest, err := database.ReadBackupManifest(archive)
+			if err != nil {
+				return writeJSONError(w, http.StatusBadRequest, err.Error())
+			}
+
+			err = db.WithContext(workflows.WithoutEvents(r.Context())).Transaction(func(tx *gorm.DB) error {
+				return database.RestoreBackup(tx, archive, manifest)
+			})
+			if errors.Is(err, database.ErrDatabaseNotEmpty) {
+				return writeJSONError(w, http.StatusConflict, "RestoreData requires an empty database ("+err.Error()+")")
+			}
+			if err != nil {
+				return writeJSONError(w, http.StatusBadRequest, err.Error())
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			return json.NewEncoder(w).Encode(map[string]interface{}{
+				"formatVersion": manifest.FormatVersion,
+				"schemaVersion": manifest.SchemaVersion,
+				"createdAt":     manifest.CreatedAt,
+				"tables":        manifest.Tables,
+			})
+		},
+	})
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nlstn/go-odata"
+	"github.com/nlstn/my-crm/backend/database"
+	"github.com/nlstn/my-crm/backend/duplicates"
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+// duplicateWarningsHeader carries the possible duplicates of a record created through POST, as a JSON array of matches.
+const duplicateWarningsHeader = "X-Duplicate-Warnings"
+
+// maxDuplicateWarnings limits the matches reported in duplicateWarningsHeader.
+const maxDuplicateWarnings = 5
+
+// maxDuplicateProbeBody limits the request bodies duplicateWarningMiddleware inspects.
+const maxDuplicateProbeBody = 1 << 20
+
+// duplicateEntitySet is an entity set supporting duplicate detection.
+type duplicateEntitySet struct {
+	EntitySet string
+	// Parameters are the fields FindDuplicates accepts to check a record that has not been created yet.
+	Parameters []string
+	New        func() interface{}
+}
+
+var duplicateEntitySets = []duplicateEntitySet{
+	{EntitySet: "Accounts", Parameters: []string{"Name", "Email", "Phone", "Website"}, New: func() interface{} { return &models.Account{} }},
+	{EntitySet: "Contacts", Parameters: []string{"FirstName", "LastName", "Email", "Phone"}, New: func() interface{} { return &models.Contact{} }},
+	{EntitySet: "Leads", Parameters: []string{"Name", "Email", "Phone", "Website", "Company"}, New: func() interface{} { return &models.Lead{} }},
+}
+
+// registerDuplicateActions registers the FindDuplicates function of every entity set supporting duplicate detection
+// and ScanDuplicates, which refreshes the duplicate queue immediately instead of waiting for the scheduled scan.
+func registerDuplicateActions(service *odata.Service, db *gorm.DB, detector *duplicates.Detector) error {
+	for _, set := range duplicateEntitySets {
+		set := set
+		parameters := make([]odata.ParameterDefinition, len(set.Parameters))
+		for i, name := range set.Parameters {
+			parameters[i] = odata.ParameterDefinition{Name: name, Type: reflect.TypeOf(""), Required: false}
+		}
+
+		// FindDuplicates is bound to a record, as in Accounts(5)/FindDuplicates(), or to the entity set with the
+		// values of a record about to be created, as in Accounts/FindDuplicates(Name='Acme',Website='acme.com').
+		if err := service.RegisterFunction(odata.FunctionDefinition{
+			Name:       "FindDuplicates",
+			IsBound:    true,
+			EntitySet:  set.EntitySet,
+			Parameters: parameters,
+			ReturnType: reflect.TypeOf([]duplicates.Match{}),
+			Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) (interface{}, error) {
+				record := ctx
+				if record == nil {
+					record = set.New()
+					values, err := json.Marshal(params)
+					if err != nil {
+						return nil, err
+					}
+					if err := json.Unmarshal(values, record); err != nil {
+						return nil, err
+					}
+				}
+
+				entityType, probe, ok := duplicates.ProbeOf(record)
+				if !ok {
+					return nil, fmt.Errorf("invalid %s context for duplicate detection", strings.ToLower(set.EntitySet))
+				}
+				matches, err := duplicates.Find(db.WithContext(r.Context()), entityType, []duplicates.Probe{probe})
+				if err != nil {
+					return nil, err
+				}
+				if matches[0] == nil {
+					return []duplicates.Match{}, nil
+				}
+				return matches[0], nil
+			},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return service.RegisterAction(odata.ActionDefinition{
+		Name:       "ScanDuplicates",
+		IsBound:    false,
+		EntitySet:  "",
+		Parameters: nil,
+		ReturnType: reflect.TypeOf(duplicates.ScanResult{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			result, err := detector.Scan(r.Context())
+			if err != nil {
+				return err
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			return json.NewEncoder(w).Encode(result)
+		},
+	})
+}
+
+// duplicateWarningMiddleware checks accounts, contacts and leads created through POST against the duplicate rules
+// and lists the records they may duplicate in the X-Duplicate-Warnings response header. The record is created
+// either way.
+func duplicateWarningMiddleware(db *gorm.DB, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var set *duplicateEntitySet
+		for i := range duplicateEntitySets {
+			if strings.Trim(r.URL.Path, "/") == duplicateEntitySets[i].EntitySet {
+				set = &duplicateEntitySets[i]
+			}
+		}
+		if set == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxDuplicateProbeBody+1))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err != nil || len(body) > maxDuplicateProbeBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		record := set.New()
+		if err := json.Unmarshal(body, record); err == nil {
+			if header, err := duplicateWarnings(db.WithContext(r.Context()), record); err != nil {
+				log.Printf("duplicate check of new %s failed: %v", strings.ToLower(set.EntitySet), err)
+			} else if header != "" {
+				w.Header().Set(duplicateWarningsHeader, header)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// duplicateWarnings returns the value of duplicateWarningsHeader for a record, or an empty string when it has no
+// possible duplicates.
+func duplicateWarnings(db *gorm.DB, record interface{}) (string, error) {
+	entityType, probe, ok := duplicates.ProbeOf(record)
+	if !ok {
+		return "", nil
+	}
+	probe.ID = 0
+
+	matches, err := duplicates.Find(db, entityType, []duplicates.Probe{probe})
+	if err != nil || len(matches[0]) == 0 {
+		return "", err
+	}
+	if len(matches[0]) > maxDuplicateWarnings {
+		matches[0] = matches[0][:maxDuplicateWarnings]
+	}
+
+	data, err := json.Marshal(matches[0])
+	if err != nil {
+		return "", err
+	}
+	return asciiJSON(data), nil
+}
+
+// asciiJSON escapes the non-ASCII characters of JSON text, which header values cannot carry reliably.
+func asciiJSON(data []byte) string {
+	var builder strings.Builder
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		switch {
+		case r < utf8.RuneSelf:
+			builder.WriteRune(r)
+		case r > 0xFFFF:
+			r -= 0x10000
+			fmt.Fprintf(&builder, `\u%04x\u%04x`, 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+		default:
+			fmt.Fprintf(&builder, `\u%04x`, r)
+		}
+	}
+	return builder.String()
+}
+
+// importDuplicateWarnings warns about import rows that may duplicate an existing record or an earlier row. Rows
+// that match an existing record carry its ID, so they are not reported as duplicates of it.
+func importDuplicateWarnings[T any](db *gorm.DB, label string, records []T, rowNumbers []int) ([]database.RowWarning, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	probes := make([]duplicates.Probe, len(records))
+	var entityType string
+	for i := range records {
+		entityType, probes[i], _ = duplicates.ProbeOf(&records[i])
+	}
+
+	matches, err := duplicates.Find(db, entityType, probes)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := duplicates.FindWithin(db, entityType, probes)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []database.RowWarning
+	for idx, rowMatches := range matches {
+		for _, match := range rowMatches {
+			warnings = append(warnings, database.RowWarning{
+				Row:     rowNumbers[idx],
+				Field:   match.Fields[0],
+				Message: fmt.Sprintf("may duplicate %s %d %q: %s", label, match.ID, match.Name, strings.Join(match.Reasons, ", ")),
+			})
+		}
+	}
+	for _, pair := range pairs {
+		warnings = append(warnings, database.RowWarning{
+			Row:     rowNumbers[pair.Index],
+			Field:   pair.Fields[0],
+			Message: fmt.Sprintf("may duplicate row %d: %s", rowNumbers[pair.Earlier], strings.Join(pair.Reasons, ", ")),
+		})
+	}
+	sort.SliceStable(warnings, func(i, j int) bool { return warnings[i].Row < warnings[j].Row })
+	return warnings, nil
+}
+
+// Values of the OnDuplicate parameter of ConvertLead.
+const (
+	// conversionCreate creates a new account and contact unless existing ones are given, as before duplicate checks.
+	conversionCreate = "Create"
+	// conversionFail rejects the conversion when the lead strongly matches an existing account or contact.
+	conversionFail = "Fail"
+	// conversionLink converts the lead into the account and contact it strongly matches.
+	conversionLink = "Link"
+)
+
+// strongConversionMatch is the score from which ConvertLead treats a matching account or contact as the lead's own.
+const strongConversionMatch = 0.9
+
+// conversionCandidate is an account or contact a lead may already exist as.
+type conversionCandidate struct {
+	duplicates.Match
+	// AccountID is the account of a matching contact.
+	AccountID uint `json:"AccountID,omitempty"`
+}
+
+// conversionCandidates are the accounts and contacts matching a lead, strongest first.
+type conversionCandidates struct {
+	Accounts []conversionCandidate `json:"Accounts"`
+	Contacts []conversionCandidate `json:"Contacts"`
+}
+
+// strongAccount returns the best account matching at least strongConversionMatch, if any.
+func (c *conversionCandidates) strongAccount() *conversionCandidate {
+	if len(c.Accounts) > 0 && c.Accounts[0].Score >= strongConversionMatch {
+		return &c.Accounts[0]
+	}
+	return nil
+}
+
+// strongContact returns the best contact matching at least strongConversionMatch, if any. Unless accountID is zero,
+// only contacts of that account are considered.
+func (c *conversionCandidates) strongContact(accountID uint) *conversionCandidate {
+	for i := range c.Contacts {
+		if c.Contacts[i].Score < strongConversionMatch {
+			break
+		}
+		if accountID == 0 || c.Contacts[i].AccountID == accountID {
+			return &c.Contacts[i]
+		}
+	}
+	return nil
+}
+
+// findConversionCandidates compares a lead with the existing accounts and contacts under their duplicate rules.
+// The account the lead would become is named accountName, its contact after the lead.
+func findConversionCandidates(db *gorm.DB, lead *models.Lead, accountName string) (*conversionCandidates, error) {
+	accountMatches, err := duplicates.Find(db, "Account", []duplicates.Probe{{Values: map[string]string{
+		"Name": accountName, "Email": lead.Email, "Phone": lead.Phone, "Website": lead.Website,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	contactMatches, err := duplicates.Find(db, "Contact", []duplicates.Probe{{Values: map[string]string{
+		"Name": lead.Name, "Email": lead.Email, "Phone": lead.Phone,
+	}}})
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := &conversionCandidates{
+		Accounts: make([]conversionCandidate, 0, len(accountMatches[0])),
+		Contacts: make([]conversionCandidate, 0, len(contactMatches[0])),
+	}
+	for _, match := range accountMatches[0] {
+		candidates.Accounts = append(candidates.Accounts, conversionCandidate{Match: match})
+	}
+
+	contactIDs := make([]uint, len(contactMatches[0]))
+	for i, match := range contactMatches[0] {
+		contactIDs[i] = match.ID
+	}
+	contactAccounts, err := fetchContactAccounts(db, contactIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, match := range contactMatches[0] {
+		candidates.Contacts = append(candidates.Contacts, conversionCandidate{Match: match, AccountID: contactAccounts[match.ID]})
+	}
+	return candidates, nil
+}
+
+// registerConversionCandidatesFunction registers GetConversionCandidates, which lists the accounts and contacts a
+// lead may already exist as, so they can be passed to ConvertLead as ExistingAccountID and ExistingContactID.
+func registerConversionCandidatesFunction(service *odata.Service, db *gorm.DB) error {
+	return service.RegisterFunction(odata.FunctionDefinition{
+		Name:      "GetConversionCandidates",
+		IsBound:   true,
+		EntitySet: "Leads",
+		Parameters: []odata.ParameterDefinition{
+			{Name: "AccountName", Type: reflect.TypeOf(""), Required: false},
+		},
+		ReturnType: reflect.TypeOf(conversionCandidates{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) (interface{}, error) {
+			lead, ok := ctx.(*models.Lead)
+			if !ok || lead == nil {
+				return nil, fmt.Errorf("invalid lead context for conversion candidates")
+			}
+
+			overrideName, _ := params["AccountName"].(string)
+			return findConversionCandidates(db.WithContext(r.Context()), lead, conversionAccountName(lead, overrideName))
+		},
+	})
+}
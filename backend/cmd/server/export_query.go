@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nlstn/my-crm/backend/database"
+	"gorm.io/gorm"
+)
+
+// exportQuery holds the subset of OData query options supported by CSV exports.
+type exportQuery struct {
+	// Where is a SQL condition with positional arguments; empty when no $filter was given.
+	Where   string
+	Args    []interface{}
+	OrderBy []string
+	// Select lists the exported columns in output order; empty exports every column.
+	Select []string
+	Expand []string
+}
+
+// parseExportQuery reads $filter, $orderby, $select and $expand from the request URL. Properties are
+// validated against the exported columns, so only fields that appear in the CSV can be used. Computed
+// properties have no column to query and can only be selected. enums holds the members of enumeration
+// properties, which are stored as integers but compared by name in $filter, as in the entity set.
+func parseExportQuery(db *gorm.DB, values url.Values, properties, computed []string, enums map[string]map[string]int64) (exportQuery, error) {
+	var query exportQuery
+	known := make(map[string]string, len(properties))
+	for _, property := range properties {
+		if !containsField(computed, property) {
+			known[property] = db.NamingStrategy.ColumnName("", property)
+		}
+	}
+
+	if filter := strings.TrimSpace(values.Get("$filter")); filter != "" {
+		tokens, err := tokenizeFilter(filter)
+		if err != nil {
+			return query, err
+		}
+		parser := &filterParser{tokens: tokens, columns: known, enums: enums}
+		where, err := parser.parseOr()
+		if err != nil {
+			return query, err
+		}
+		if parser.pos < len(parser.tokens) {
+			return query, fmt.Errorf("$filter has unexpected %q", parser.tokens[parser.pos].text)
+		}
+		query.Where = where
+		query.Args = parser.args
+	}
+
+	for _, item := range splitQueryList(values.Get("$orderby")) {
+		fields := strings.Fields(item)
+		column, ok := known[fields[0]]
+		if !ok || len(fields) > 2 {
+			return query, fmt.Errorf("$orderby references unknown property %q", item)
+		}
+		direction := "ASC"
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				direction = "DESC"
+			default:
+				return query, fmt.Errorf("$orderby direction must be asc or desc, not %q", fields[1])
+			}
+		}
+		query.OrderBy = append(query.OrderBy, column+" "+direction)
+	}
+	query.OrderBy = append(query.OrderBy, "id ASC")
+
+	for _, property := range splitQueryList(values.Get("$select")) {
+		if _, ok := known[property]; !ok && !containsField(computed, property) {
+			return query, fmt.Errorf("$select references unknown property %q", property)
+		}
+		query.Select = append(query.Select, property)
+	}
+
+	query.Expand = splitQueryList(values.Get("$expand"))
+	return query, nil
+}
+
+func splitQueryList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
+
+type filterTokenKind int
+
+const (
+	filterTokenWord filterTokenKind = iota
+	filterTokenString
+	filterTokenOpen
+	filterTokenClose
+	filterTokenComma
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+}
+
+func tokenizeFilter(filter string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: filterTokenOpen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: filterTokenClose, text: ")"})
+			i++
+		case r == ',':
+			tokens = append(tokens, filterToken{kind: filterTokenComma, text: ","})
+			i++
+		case r == '\'':
+			var text strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						text.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				text.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("$filter has an unterminated string literal")
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenString, text: text.String()})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("(),'", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenWord, text: string(runes[start:i])})
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser translates an OData $filter expression into a SQL condition. It supports the comparison
+// operators eq, ne, gt, ge, lt and le, the logical operators and, or and not, parentheses and the
+// contains, startswith and endswith string functions.
+type filterParser struct {
+	tokens  []filterToken
+	pos     int
+	columns map[string]string
+	enums   map[string]map[string]int64
+	args    []interface{}
+}
+
+var filterOperators = map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+
+func (p *filterParser) peekWord(word string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == filterTokenWord && strings.EqualFold(p.tokens[p.pos].text, word)
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, fmt.Errorf("$filter ends unexpectedly")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token, nil
+}
+
+func (p *filterParser) expect(kind filterTokenKind, text string) error {
+	token, err := p.next()
+	if err != nil {
+		return err
+	}
+	if token.kind != kind {
+		return fmt.Errorf("$filter expected %q but found %q", text, token.text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for p.peekWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = fmt.Sprintf("(%s OR %s)", left, right)
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (string, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return "", err
+	}
+	for p.peekWord("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		left = fmt.Sprintf("(%s AND %s)", left, right)
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (string, error) {
+	if p.peekWord("not") {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("NOT (%s)", operand), nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (string, error) {
+	token, err := p.next()
+	if err != nil {
+		return "", err
+	}
+
+	if token.kind == filterTokenOpen {
+		inner, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect(filterTokenClose, ")"); err != nil {
+			return "", err
+		}
+		return "(" + inner + ")", nil
+	}
+	if token.kind != filterTokenWord {
+		return "", fmt.Errorf("$filter expected a property but found %q", token.text)
+	}
+
+	switch strings.ToLower(token.text) {
+	case "contains", "startswith", "endswith":
+		return p.parseStringFunction(strings.ToLower(token.text))
+	}
+
+	column, ok := p.columns[token.text]
+	if !ok {
+		return "", fmt.Errorf("$filter references unknown property %q", token.text)
+	}
+
+	operatorToken, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	operator, ok := filterOperators[strings.ToLower(operatorToken.text)]
+	if !ok || operatorToken.kind != filterTokenWord {
+		return "", fmt.Errorf("$filter has unsupported operator %q", operatorToken.text)
+	}
+
+	literal, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if literal.kind == filterTokenWord && literal.text == "null" {
+		switch operator {
+		case "=":
+			return column + " IS NULL", nil
+		case "<>":
+			return column + " IS NOT NULL", nil
+		default:
+			return "", fmt.Errorf("$filter can only compare null with eq or ne")
+		}
+	}
+
+	var value interface{}
+	if members, ok := p.enums[token.text]; ok && literal.kind == filterTokenString {
+		value, err = enumLiteral(token.text, members, literal.text)
+	} else {
+		value, err = filterLiteral(literal)
+	}
+	if err != nil {
+		return "", err
+	}
+	p.args = append(p.args, value)
+	return fmt.Sprintf("%s %s ?", column, operator), nil
+}
+
+func (p *filterParser) parseStringFunction(name string) (string, error) {
+	if err := p.expect(filterTokenOpen, "("); err != nil {
+		return "", err
+	}
+	property, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	column, ok := p.columns[property.text]
+	if !ok || property.kind != filterTokenWord {
+		return "", fmt.Errorf("$filter references unknown property %q", property.text)
+	}
+	if _, enum := p.enums[property.text]; enum {
+		return "", fmt.Errorf("%s cannot be used with %s, compare it with eq or ne instead", name, property.text)
+	}
+	if err := p.expect(filterTokenComma, ","); err != nil {
+		return "", err
+	}
+	literal, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if literal.kind != filterTokenString {
+		return "", fmt.Errorf("%s expects a string literal", name)
+	}
+	if err := p.expect(filterTokenClose, ")"); err != nil {
+		return "", err
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(literal.text)
+	switch name {
+	case "contains":
+		escaped = "%" + escaped + "%"
+	case "startswith":
+		escaped += "%"
+	case "endswith":
+		escaped = "%" + escaped
+	}
+	p.args = append(p.args, escaped)
+	return fmt.Sprintf("%s LIKE ?", column), nil
+}
+
+// enumLiteral returns the stored value of the enumeration member named text, ignoring case.
+func enumLiteral(property string, members map[string]int64, text string) (interface{}, error) {
+	for name, value := range members {
+		if strings.EqualFold(name, text) {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("$filter has invalid %s %q, expected one of %s", property, text, strings.Join(database.EnumNames(members), ", "))
+}
+
+// filterLiteral converts a literal token into a value for the database driver.
+func filterLiteral(token filterToken) (interface{}, error) {
+	if token.kind == filterTokenString {
+		return token.text, nil
+	}
+	if token.kind != filterTokenWord {
+		return nil, fmt.Errorf("$filter expected a value but found %q", token.text)
+	}
+
+	switch token.text {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if number, err := strconv.ParseInt(token.text, 10, 64); err == nil {
+		return number, nil
+	}
+	if number, err := strconv.ParseFloat(token.text, 64); err == nil {
+		return number, nil
+	}
+	if timestamp, err := time.Parse(time.RFC3339, token.text); err == nil {
+		return timestamp, nil
+	}
+	if date, err := time.Parse("2006-01-02", token.text); err == nil {
+		return date, nil
+	}
+	return nil, fmt.Errorf("$filter has invalid value %q", token.text)
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nlstn/go-odata"
+	"github.com/nlstn/my-crm/backend/database"
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is the number of rows read from the cursor before they are written and flushed.
+const exportBatchSize = 500
+
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// exportSpec describes how one entity type is exported.
+type exportSpec[T any] struct {
+	// EntitySet names the entity set, for example Accounts. Actions are named Export<EntitySet>CSV and Export<EntitySet>XLSX.
+	EntitySet string
+	// FilePrefix starts the name of the downloaded file, for example "accounts".
+	FilePrefix string
+	Codec      database.CSVCodec[T]
+	// Computed lists codec columns that are not stored in a column of their own, such as account tags.
+	// They can be selected but not used in $filter or $orderby.
+	Computed []string
+	// Load fills the computed columns of a batch of rows read from the cursor. It is optional.
+	Load func(db *gorm.DB, batch []T) error
+	// Expand lists the related rows that can be exported with $expand, keyed by navigation property.
+	Expand map[string]exportExpansion[T]
+}
+
+// exportExpansion loads related rows for a batch of parents. CSV exports write them next to their parent,
+// repeating a parent once per related row; XLSX exports write them to a sheet of their own.
+type exportExpansion[T any] struct {
+	// EntitySet names the sheet of the related rows in XLSX exports.
+	EntitySet string
+	Headers   []string
+	// Load returns the related rows of each parent, in parent order.
+	Load func(db *gorm.DB, parents []T) ([][]exportRow, error)
+}
+
+// exportRow is one related row as CSV text and as spreadsheet cells.
+type exportRow struct {
+	Text  []string
+	Cells []interface{}
+}
+
+// exportPlan is an export after the query options of the request have been applied.
+type exportPlan[T any] struct {
+	spec  exportSpec[T]
+	query exportQuery
+	// columns are the indexes of the selected codec columns, in output order.
+	columns       []int
+	headers       []string
+	expansion     *exportExpansion[T]
+	expansionName string
+}
+
+// exportSheet writes the full contents of one entity set to a workbook sheet.
+type exportSheet func(ctx context.Context, db *gorm.DB, workbook *database.XLSXWriter) error
+
+// registerExportActions registers the Export*CSV and Export*XLSX actions of every entity supporting bulk export,
+// and ExportWorkbookXLSX, which exports all of them into one workbook.
+func registerExportActions(service *odata.Service, db *gorm.DB) error {
+	var sheets []exportSheet
+
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.Employee]{
+		EntitySet: "Employees", FilePrefix: "employees", Codec: database.EmployeeCSV,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.Product]{
+		EntitySet: "Products", FilePrefix: "products", Codec: database.ProductCSV,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.Account]{
+		EntitySet: "Accounts", FilePrefix: "accounts", Codec: database.AccountCSV,
+		Computed: []string{"Tags"},
+		Load:     loadAccountTags,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.Contact]{
+		EntitySet: "Contacts", FilePrefix: "contacts", Codec: database.ContactCSV,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.Lead]{
+		EntitySet: "Leads", FilePrefix: "leads", Codec: database.LeadCSV,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.Opportunity]{
+		EntitySet: "Opportunities", FilePrefix: "opportunities", Codec: database.OpportunityCSV,
+		Expand: map[string]exportExpansion[models.Opportunity]{
+			"LineItems": {
+				EntitySet: "OpportunityLineItems",
+				Headers:   database.OpportunityLineItemCSV.Headers,
+				Load:      loadOpportunityLineItemRows,
+			},
+		},
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.OpportunityLineItem]{
+		EntitySet: "OpportunityLineItems", FilePrefix: "opportunity-line-items", Codec: database.OpportunityLineItemCSV,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.Activity]{
+		EntitySet: "Activities", FilePrefix: "activities", Codec: database.ActivityCSV,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.Issue]{
+		EntitySet: "Issues", FilePrefix: "issues", Codec: database.IssueCSV,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.Task]{
+		EntitySet: "Tasks", FilePrefix: "tasks", Codec: database.TaskCSV,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.Tag]{
+		EntitySet: "Tags", FilePrefix: "tags", Codec: database.TagCSV,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.IssueUpdate]{
+		EntitySet: "IssueUpdates", FilePrefix: "issue-updates", Codec: database.IssueUpdateCSV,
+	}); err != nil {
+		return err
+	}
+	if err := registerExportAction(service, db, &sheets, exportSpec[models.WorkflowRule]{
+		EntitySet: "WorkflowRules", FilePrefix: "workflow-rules", Codec: database.WorkflowRuleCSV,
+	}); err != nil {
+		return err
+	}
+
+	return service.RegisterAction(odata.ActionDefinition{
+		Name:       "ExportWorkbookXLSX",
+		IsBound:    false,
+		EntitySet:  "",
+		Parameters: nil,
+		ReturnType: nil,
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			workbook, err := database.NewXLSXWriter()
+			if err != nil {
+				return err
+			}
+			defer workbook.Close()
+
+			for _, sheet := range sheets {
+				if err := sheet(r.Context(), db, workbook); err != nil {
+					return err
+				}
+			}
+
+			writeDownloadHeaders(w, xlsxContentType, "workbook", "xlsx")
+			_, err = workbook.WriteTo(w)
+			return err
+		},
+	})
+}
+
+func registerExportAction[T any](service *odata.Service, db *gorm.DB, sheets *[]exportSheet, spec exportSpec[T]) error {
+	*sheets = append(*sheets, func(ctx context.Context, db *gorm.DB, workbook *database.XLSXWriter) error {
+		plan, err := planExport(db, url.Values{}, spec)
+		if err != nil {
+			return err
+		}
+		return writeXLSXSheet(ctx, db, plan, workbook)
+	})
+
+	if err := service.RegisterAction(odata.ActionDefinition{
+		Name:       "Export" + spec.EntitySet + "CSV",
+		IsBound:    false,
+		EntitySet:  "",
+		Parameters: nil,
+		ReturnType: nil,
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			return streamCSVExport(w, r, db, spec)
+		},
+	}); err != nil {
+		return err
+	}
+
+	return service.RegisterAction(odata.ActionDefinition{
+		Name:       "Export" + spec.EntitySet + "XLSX",
+		IsBound:    false,
+		EntitySet:  "",
+		Parameters: nil,
+		ReturnType: nil,
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			plan, err := planExport(db, r.URL.Query(), spec)
+			if err != nil {
+				return writeJSONError(w, http.StatusBadRequest, err.Error())
+			}
+
+			workbook, err := database.NewXLSXWriter()
+			if err != nil {
+				return err
+			}
+			defer workbook.Close()
+
+			if err := writeXLSXSheet(r.Context(), db, plan, workbook); err != nil {
+				return err
+			}
+
+			writeDownloadHeaders(w, xlsxContentType, spec.FilePrefix, "xlsx")
+			_, err = workbook.WriteTo(w)
+			return err
+		},
+	})
+}
+
+// planExport applies $filter, $orderby, $select and $expand to an export.
+func planExport[T any](db *gorm.DB, values url.Values, spec exportSpec[T]) (*exportPlan[T], error) {
+	enums := make(map[string]map[string]int64)
+	for _, property := range spec.Codec.Headers {
+		if members, ok := spec.Codec.EnumMembers(property); ok {
+			enums[property] = members
+		}
+	}
+	query, err := parseExportQuery(db, values, spec.Codec.Headers, spec.Computed, enums)
+	if err != nil {
+		return nil, err
+	}
+	plan := &exportPlan[T]{spec: spec, query: query}
+
+	switch len(query.Expand) {
+	case 0:
+	case 1:
+		expand, ok := spec.Expand[query.Expand[0]]
+		if !ok {
+			return nil, fmt.Errorf("$expand=%s is not supported by %s exports", query.Expand[0], spec.EntitySet)
+		}
+		plan.expansion = &expand
+		plan.expansionName = query.Expand[0]
+	default:
+		return nil, fmt.Errorf("$expand supports a single navigation property")
+	}
+
+	if len(query.Select) == 0 {
+		for idx, header := range spec.Codec.Headers {
+			plan.columns = append(plan.columns, idx)
+			plan.headers = append(plan.headers, header)
+		}
+	} else {
+		for _, property := range query.Select {
+			for idx, header := range spec.Codec.Headers {
+				if header == property {
+					plan.columns = append(plan.columns, idx)
+					plan.headers = append(plan.headers, header)
+				}
+			}
+		}
+	}
+	return plan, nil
+}
+
+// open starts the query and returns a cursor over the matching rows.
+func (p *exportPlan[T]) open(ctx context.Context, db *gorm.DB) (*sql.Rows, error) {
+	statement := db.WithContext(ctx).Model(new(T))
+	if p.query.Where != "" {
+		statement = statement.Where(p.query.Where, p.query.Args...)
+	}
+	for _, order := range p.query.OrderBy {
+		statement = statement.Order(order)
+	}
+	return statement.Rows()
+}
+
+// forEachBatch reads the cursor in batches and loads the computed columns and expanded rows of each batch.
+func (p *exportPlan[T]) forEachBatch(ctx context.Context, db *gorm.DB, rows *sql.Rows, write func(batch []T, related [][]exportRow) error) error {
+	flush := func(batch []T) error {
+		if p.spec.Load != nil && len(batch) > 0 {
+			if err := p.spec.Load(db.WithContext(ctx), batch); err != nil {
+				return err
+			}
+		}
+		var related [][]exportRow
+		if p.expansion != nil && len(batch) > 0 {
+			var err error
+			if related, err = p.expansion.Load(db.WithContext(ctx), batch); err != nil {
+				return err
+			}
+		}
+		return write(batch, related)
+	}
+
+	batch := make([]T, 0, exportBatchSize)
+	for rows.Next() {
+		var item T
+		if err := db.ScanRows(rows, &item); err != nil {
+			return err
+		}
+		batch = append(batch, item)
+		if len(batch) == exportBatchSize {
+			if err := flush(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return flush(batch)
+}
+
+// streamCSVExport applies the request's query options and writes the matching rows straight to the response
+// while reading them from a database cursor, so exports never hold the whole table in memory.
+func streamCSVExport[T any](w http.ResponseWriter, r *http.Request, db *gorm.DB, spec exportSpec[T]) error {
+	plan, err := planExport(db, r.URL.Query(), spec)
+	if err != nil {
+		return writeJSONError(w, http.StatusBadRequest, err.Error())
+	}
+
+	rows, err := plan.open(r.Context(), db)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	headers := plan.headers
+	var emptyExpansion []string
+	if plan.expansion != nil {
+		for _, header := range plan.expansion.Headers {
+			headers = append(headers, plan.expansionName+"."+header)
+		}
+		emptyExpansion = make([]string, len(plan.expansion.Headers))
+	}
+
+	writeDownloadHeaders(w, "text/csv", spec.FilePrefix, "csv")
+	writer := csv.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+
+	stream := func() error {
+		if err := writer.Write(headers); err != nil {
+			return err
+		}
+
+		return plan.forEachBatch(r.Context(), db, rows, func(batch []T, related [][]exportRow) error {
+			for idx, item := range batch {
+				full := spec.Codec.Record(item)
+				record := make([]string, 0, len(headers))
+				for _, column := range plan.columns {
+					record = append(record, full[column])
+				}
+
+				if plan.expansion == nil {
+					if err := writer.Write(record); err != nil {
+						return err
+					}
+					continue
+				}
+				children := related[idx]
+				if len(children) == 0 {
+					children = []exportRow{{Text: emptyExpansion}}
+				}
+				for _, child := range children {
+					if err := writer.Write(append(append([]string{}, record...), child.Text...)); err != nil {
+						return err
+					}
+				}
+			}
+
+			writer.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return writer.Error()
+		})
+	}
+
+	// The response has already started, so streaming failures can only be logged.
+	if err := stream(); err != nil {
+		log.Printf("Export%sCSV failed while streaming: %v", spec.EntitySet, err)
+	}
+	return nil
+}
+
+// writeXLSXSheet writes the rows of an export plan to a new sheet named after the entity set,
+// and expanded rows to a second sheet named after the related entity set.
+func writeXLSXSheet[T any](ctx context.Context, db *gorm.DB, plan *exportPlan[T], workbook *database.XLSXWriter) error {
+	rows, err := plan.open(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	sheet, err := workbook.AddSheet(plan.spec.EntitySet, plan.headers)
+	if err != nil {
+		return err
+	}
+	var relatedSheet *database.XLSXSheetWriter
+	if plan.expansion != nil {
+		if relatedSheet, err = workbook.AddSheet(plan.expansion.EntitySet, plan.expansion.Headers); err != nil {
+			return err
+		}
+	}
+
+	return plan.forEachBatch(ctx, db, rows, func(batch []T, related [][]exportRow) error {
+		for idx, item := range batch {
+			full := plan.spec.Codec.Cells(item)
+			cells := make([]interface{}, 0, len(plan.columns))
+			for _, column := range plan.columns {
+				cells = append(cells, full[column])
+			}
+			if err := sheet.WriteRow(cells); err != nil {
+				return err
+			}
+
+			if relatedSheet == nil {
+				continue
+			}
+			for _, child := range related[idx] {
+				if err := relatedSheet.WriteRow(child.Cells); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// loadAccountTags loads the tags of a batch of accounts, ordered by name.
+func loadAccountTags(db *gorm.DB, accounts []models.Account) error {
+	ids := make([]uint, len(accounts))
+	for idx, account := range accounts {
+		ids[idx] = account.ID
+	}
+
+	var tagged []models.Account
+	if err := db.Select("id").Where("id IN ?", ids).
+		Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("tags.name ASC") }).
+		Find(&tagged).Error; err != nil {
+		return err
+	}
+
+	byAccount := make(map[uint][]models.Tag, len(tagged))
+	for _, account := range tagged {
+		byAccount[account.ID] = account.Tags
+	}
+	for idx := range accounts {
+		accounts[idx].Tags = byAccount[accounts[idx].ID]
+	}
+	return nil
+}
+
+// loadOpportunityLineItemRows loads the line items of a batch of opportunities for $expand=LineItems.
+func loadOpportunityLineItemRows(db *gorm.DB, opportunities []models.Opportunity) ([][]exportRow, error) {
+	ids := make([]uint, len(opportunities))
+	for idx, opportunity := range opportunities {
+		ids[idx] = opportunity.ID
+	}
+
+	var items []models.OpportunityLineItem
+	if err := db.Where("opportunity_id IN ?", ids).Order("opportunity_id ASC, id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	byOpportunity := make(map[uint][]exportRow, len(opportunities))
+	for _, item := range items {
+		byOpportunity[item.OpportunityID] = append(byOpportunity[item.OpportunityID], exportRow{
+			Text:  database.OpportunityLineItemCSV.Record(item),
+			Cells: database.OpportunityLineItemCSV.Cells(item),
+		})
+	}
+
+	related := make([][]exportRow, len(opportunities))
+	for idx, opportunity := range opportunities {
+		related[idx] = byOpportunity[opportunity.ID]
+	}
+	return related, nil
+}
+
+func writeDownloadHeaders(w http.ResponseWriter, contentType, prefix, extension string) {
+	filename := fmt.Sprintf("%s-%s.%s", prefix, time.Now().UTC().Format("20060102-150405"), extension)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.WriteHeader(http.StatusOK)
+}
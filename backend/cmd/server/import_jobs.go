@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlstn/go-odata"
+	"github.com/nlstn/my-crm/backend/database"
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+// importJobBatchSize is the number of rows written and committed per batch by import jobs.
+const importJobBatchSize = 500
+
+// importKind exposes the import of one entity set to actions that are not tied to its type,
+// such as background jobs and workbook imports.
+type importKind struct {
+	// fields lists the columns the parser understands.
+	fields  []string
+	options func(params map[string]interface{}) (importOptions, error)
+	// run imports a table as a background job.
+	run func(jobID uint, opts importOptions, table *database.Table)
+	// importTable imports a table inside an existing transaction.
+	importTable func(tx *gorm.DB, opts importOptions, table *database.Table) (importResult, []database.RowError, error)
+}
+
+// importKinds maps entity set names such as "Accounts" to their import.
+type importKinds map[string]importKind
+
+func newImportKind[T any](db *gorm.DB, spec importSpec[T]) importKind {
+	return importKind{
+		fields: spec.Fields,
+		options: func(params map[string]interface{}) (importOptions, error) {
+			return parseImportOptions(spec, params)
+		},
+		run: func(jobID uint, opts importOptions, table *database.Table) {
+			runImportJob(db, spec, jobID, opts, table)
+		},
+		importTable: func(tx *gorm.DB, opts importOptions, table *database.Table) (importResult, []database.RowError, error) {
+			return importTable(tx, spec, opts, table)
+		},
+	}
+}
+
+// registerImportJobActions registers StartImportJob and the Cancel action of ImportJobs.
+func registerImportJobActions(service *odata.Service, db *gorm.DB, kinds importKinds) error {
+	// Jobs that were running when the server stopped can never finish.
+	now := time.Now().UTC()
+	if err := db.Model(&models.ImportJob{}).
+		Where("status IN ?", []models.ImportJobStatus{models.ImportJobStatusPending, models.ImportJobStatusRunning}).
+		UpdateColumns(map[string]interface{}{
+			"status":      models.ImportJobStatusFailed,
+			"last_error":  "The server restarted before the import finished",
+			"finished_at": now,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to mark interrupted import jobs: %w", err)
+	}
+
+	if err := service.RegisterAction(odata.ActionDefinition{
+		Name:      "StartImportJob",
+		IsBound:   false,
+		EntitySet: "",
+		Parameters: []odata.ParameterDefinition{
+			{Name: "EntitySet", Type: reflect.TypeOf(""), Required: true},
+			{Name: "Csv", Type: reflect.TypeOf(""), Required: false},
+			{Name: "Xlsx", Type: reflect.TypeOf(""), Required: false},
+			{Name: "FileName", Type: reflect.TypeOf(""), Required: false},
+			{Name: "Mode", Type: reflect.TypeOf(""), Required: false},
+			{Name: "MatchKey", Type: reflect.TypeOf(""), Required: false},
+			{Name: "SkipInvalidRows", Type: reflect.TypeOf(false), Required: false},
+			{Name: "MappingID", Type: reflect.TypeOf(uint(0)), Required: false},
+			{Name: "CreateMissingTags", Type: reflect.TypeOf(false), Required: false},
+		},
+		ReturnType: reflect.TypeOf(models.ImportJob{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			entitySet, _ := params["EntitySet"].(string)
+			kind, ok := kinds[strings.TrimSpace(entitySet)]
+			if !ok {
+				allowed := make([]string, 0, len(kinds))
+				for name := range kinds {
+					allowed = append(allowed, name)
+				}
+				sort.Strings(allowed)
+				return writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("EntitySet must be one of %s", strings.Join(allowed, ", ")))
+			}
+
+			var table *database.Table
+			for _, format := range importFormats {
+				payload, _ := params[format.Parameter].(string)
+				if strings.TrimSpace(payload) == "" {
+					continue
+				}
+				if table != nil {
+					return writeJSONError(w, http.StatusBadRequest, "Pass either Csv or Xlsx, not both")
+				}
+				var err error
+				if table, err = format.Read(payload, strings.TrimSpace(entitySet)); err != nil {
+					return writeJSONError(w, http.StatusBadRequest, err.Error())
+				}
+			}
+			if table == nil {
+				return writeJSONError(w, http.StatusBadRequest, "Csv or Xlsx parameter is required")
+			}
+
+			opts, err := kind.options(params)
+			if err != nil {
+				return writeJSONError(w, http.StatusBadRequest, err.Error())
+			}
+			var mappingID *uint
+			if opts.MappingID != 0 {
+				table, err = applyImportMapping(db, opts.MappingID, strings.TrimSpace(entitySet), kind.fields, table)
+				var invalid invalidMappingError
+				if errors.As(err, &invalid) {
+					return writeJSONError(w, http.StatusBadRequest, invalid.Error())
+				}
+				if err != nil {
+					return err
+				}
+				mappingID = &opts.MappingID
+			}
+
+			fileName, _ := params["FileName"].(string)
+			job := models.ImportJob{
+				EntitySet:         strings.TrimSpace(entitySet),
+				FileName:          strings.TrimSpace(fileName),
+				Mode:              string(opts.Mode),
+				MatchKey:          opts.MatchKey,
+				SkipInvalidRows:   opts.SkipInvalidRows,
+				CreateMissingTags: opts.CreateMissingTags,
+				ImportMappingID:   mappingID,
+				Status:            models.ImportJobStatusPending,
+			}
+			if err := db.Create(&job).Error; err != nil {
+				return err
+			}
+
+			go kind.run(job.ID, opts, table)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Location", fmt.Sprintf("/ImportJobs(%d)", job.ID))
+			w.WriteHeader(http.StatusAccepted)
+			return json.NewEncoder(w).Encode(job)
+		},
+	}); err != nil {
+		return err
+	}
+
+	return service.RegisterAction(odata.ActionDefinition{
+		Name:       "Cancel",
+		IsBound:    true,
+		EntitySet:  "ImportJobs",
+		Parameters: []odata.ParameterDefinition{},
+		ReturnType: reflect.TypeOf(models.ImportJob{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			job, ok := ctx.(*models.ImportJob)
+			if !ok || job == nil {
+				return fmt.Errorf("invalid import job context")
+			}
+			if job.IsFinished() {
+				return writeJSONError(w, http.StatusConflict, fmt.Sprintf("Import job has already finished with status %s", job.Status))
+			}
+
+			if err := db.Model(job).UpdateColumn("cancel_requested", true).Error; err != nil {
+				return err
+			}
+			job.CancelRequested = true
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			return json.NewEncoder(w).Encode(job)
+		},
+	})
+}
+
+// runImportJob parses and validates the CSV, then writes the records in batches that are committed one by one,
+// recording progress on the job after each batch. Cancellation is checked between batches, so rows from batches
+// that were already committed are kept. Without SkipInvalidRows the job fails before writing anything when
+// validation finds errors, and stops at the first batch with a rejected row.
+func runImportJob[T any](db *gorm.DB, spec importSpec[T], jobID uint, opts importOptions, table *database.Table) {
+	var (
+		result    importResult
+		rowErrors []database.RowError
+	)
+	finish := func(status models.ImportJobStatus, lastError string) {
+		finishImportJob(db, jobID, status, result, withSheet(table, rowErrors), table, lastError)
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("import job %d panicked: %v", jobID, recovered)
+			finish(models.ImportJobStatusFailed, fmt.Sprintf("internal error: %v", recovered))
+		}
+	}()
+
+	startedAt := time.Now().UTC()
+	if err := updateImportJob(db, jobID, map[string]interface{}{
+		"status":     models.ImportJobStatusRunning,
+		"started_at": startedAt,
+	}); err != nil {
+		log.Printf("import job %d could not be started: %v", jobID, err)
+		return
+	}
+
+	columns := spec.columns(table)
+	records, rowNumbers, validationErrors, err := spec.parse(table, opts)
+	if err != nil {
+		finish(models.ImportJobStatusFailed, err.Error())
+		return
+	}
+	rowErrors = validationErrors
+	if spec.Validate != nil {
+		dependencyErrors, err := spec.validate(db, opts, table, records, rowNumbers)
+		if err != nil {
+			finish(models.ImportJobStatusFailed, err.Error())
+			return
+		}
+		rowErrors = append(rowErrors, dependencyErrors...)
+	}
+
+	failedRows := make(map[int]struct{}, len(rowErrors))
+	for _, rowError := range rowErrors {
+		failedRows[rowError.Row] = struct{}{}
+	}
+	parsedRows := make(map[int]struct{}, len(rowNumbers))
+	for _, row := range rowNumbers {
+		parsedRows[row] = struct{}{}
+	}
+	processed := 0
+	for row := range failedRows {
+		if _, parsed := parsedRows[row]; !parsed {
+			processed++
+		}
+	}
+
+	if err := updateImportJob(db, jobID, map[string]interface{}{
+		"total_rows":     len(records) + processed,
+		"processed_rows": processed,
+		"error_count":    len(failedRows),
+	}); err != nil {
+		log.Printf("import job %d failed to record progress: %v", jobID, err)
+	}
+
+	if len(rowErrors) > 0 && !opts.SkipInvalidRows {
+		finish(models.ImportJobStatusFailed, fmt.Sprintf("One or more %s rows could not be imported", spec.Label))
+		return
+	}
+	if len(records) == 0 && len(rowErrors) == 0 {
+		finish(models.ImportJobStatusFailed, fmt.Sprintf("No %s rows were found in the file", spec.Label))
+		return
+	}
+
+	for start := 0; start < len(records); start += importJobBatchSize {
+		var cancelRequested bool
+		if err := db.Model(&models.ImportJob{}).Where("id = ?", jobID).Pluck("cancel_requested", &cancelRequested).Error; err != nil {
+			finish(models.ImportJobStatusFailed, err.Error())
+			return
+		}
+		if cancelRequested {
+			finish(models.ImportJobStatusCancelled, "")
+			return
+		}
+
+		end := min(start+importJobBatchSize, len(records))
+		chunk := records[start:end]
+		chunkRows := rowNumbers[start:end]
+
+		var batch importResult
+		err := db.Transaction(func(tx *gorm.DB) error {
+			before := len(rowErrors)
+			var err error
+			rowErrors, err = importBatch(tx, opts, columns, chunk, chunkRows, failedRows, rowErrors, &batch)
+			if err != nil {
+				return err
+			}
+			if !opts.SkipInvalidRows && len(rowErrors) > before {
+				return errImportRowsRejected
+			}
+			return nil
+		})
+		if errors.Is(err, errImportRowsRejected) {
+			finish(models.ImportJobStatusFailed, fmt.Sprintf("One or more %s rows could not be imported", spec.Label))
+			return
+		}
+		if err != nil {
+			finish(models.ImportJobStatusFailed, err.Error())
+			return
+		}
+
+		result.Inserted += batch.Inserted
+		result.Updated += batch.Updated
+		result.Unchanged += batch.Unchanged
+		processed += len(chunk)
+
+		if err := updateImportJob(db, jobID, map[string]interface{}{
+			"processed_rows": processed,
+			"inserted_rows":  result.Inserted,
+			"updated_rows":   result.Updated,
+			"unchanged_rows": result.Unchanged,
+			"error_count":    len(failedRows),
+		}); err != nil {
+			log.Printf("import job %d failed to record progress: %v", jobID, err)
+		}
+	}
+
+	finish(models.ImportJobStatusSucceeded, "")
+}
+
+// importBatch writes one batch of records. Inserts use CreateInBatches and fall back to row by row writes
+// when the batch is rejected, so the failing rows can be identified and skipped.
+func importBatch[T any](tx *gorm.DB, opts importOptions, columns importColumns, records []T, rowNumbers []int, failedRows map[int]struct{}, rowErrors []database.RowError, result *importResult) ([]database.RowError, error) {
+	if opts.Mode == importModeInsert {
+		valid := make([]T, 0, len(records))
+		for idx := range records {
+			if _, failed := failedRows[rowNumbers[idx]]; !failed {
+				clearPrimaryKey(&records[idx])
+				valid = append(valid, records[idx])
+			}
+		}
+		if len(valid) == 0 {
+			return rowErrors, nil
+		}
+
+		if err := tx.SavePoint("import_batch").Error; err != nil {
+			return rowErrors, err
+		}
+		err := tx.CreateInBatches(&valid, importJobBatchSize).Error
+		if err == nil {
+			result.Inserted += len(valid)
+			return rowErrors, nil
+		}
+		if rollbackErr := tx.RollbackTo("import_batch").Error; rollbackErr != nil {
+			return rowErrors, rollbackErr
+		}
+	}
+
+	return importRowsIndividually(tx, opts, columns, records, rowNumbers, failedRows, rowErrors, result, false)
+}
+
+// finishImportJob stores the final status, counts and error report of a job.
+func finishImportJob(db *gorm.DB, jobID uint, status models.ImportJobStatus, result importResult, rowErrors []database.RowError, table *database.Table, lastError string) {
+	failedRows := make(map[int]struct{}, len(rowErrors))
+	for _, rowError := range rowErrors {
+		failedRows[rowError.Row] = struct{}{}
+	}
+
+	updates := map[string]interface{}{
+		"status":         status,
+		"inserted_rows":  result.Inserted,
+		"updated_rows":   result.Updated,
+		"unchanged_rows": result.Unchanged,
+		"error_count":    len(failedRows),
+		"last_error":     lastError,
+		"finished_at":    time.Now().UTC(),
+	}
+	if len(rowErrors) > 0 {
+		report, err := database.BuildErrorReport(table, rowErrors)
+		if err != nil {
+			log.Printf("import job %d failed to build error report: %v", jobID, err)
+		} else {
+			updates["error_report"] = string(report)
+		}
+	}
+
+	if err := updateImportJob(db, jobID, updates); err != nil {
+		log.Printf("import job %d failed to record its result: %v", jobID, err)
+	}
+}
+
+func updateImportJob(db *gorm.DB, jobID uint, updates map[string]interface{}) error {
+	return db.Model(&models.ImportJob{}).Where("id = ?", jobID).UpdateColumns(updates).Error
+}
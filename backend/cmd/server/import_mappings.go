@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nlstn/my-crm/backend/database"
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+// headerSuggestionThreshold is the lowest similarity for which a header suggestion is returned.
+const headerSuggestionThreshold = 0.6
+
+// invalidMappingError reports a mapping that cannot be applied to an import. It is returned to the client as a 400.
+type invalidMappingError string
+
+func (e invalidMappingError) Error() string {
+	return string(e)
+}
+
+// applyImportMapping loads a saved import mapping and rewrites the table so its headers are the target fields.
+// Mapped values are filled from their source column or constant and transformed; headers that are not mapped
+// but already name a known field are kept. Rows keep their position, so row numbers in errors still refer to
+// the uploaded file. Dates that do not match the mapping's format are passed on unchanged and rejected by the parser.
+func applyImportMapping(db *gorm.DB, mappingID uint, entitySet string, fields []string, table *database.Table) (*database.Table, error) {
+	var mapping models.ImportMapping
+	err := db.Preload("Columns", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id ASC")
+	}).First(&mapping, mappingID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, invalidMappingError(fmt.Sprintf("Import mapping %d does not exist", mappingID))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mapping.EntitySet != entitySet {
+		return nil, invalidMappingError(fmt.Sprintf("Import mapping %q is for %s, not %s", mapping.Name, mapping.EntitySet, entitySet))
+	}
+
+	sourceIndex := make(map[string]int, len(table.Headers))
+	for idx, header := range table.Headers {
+		if trimmed := strings.TrimSpace(header); trimmed != "" {
+			sourceIndex[strings.ToLower(trimmed)] = idx
+		}
+	}
+	known := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		known[field] = struct{}{}
+	}
+
+	type mappedColumn struct {
+		source     int
+		constant   string
+		transforms []models.ImportTransform
+		layout     string
+	}
+	var (
+		headers []string
+		columns []mappedColumn
+	)
+	targets := make(map[string]struct{}, len(mapping.Columns))
+	consumed := make(map[int]struct{}, len(mapping.Columns))
+	for _, column := range mapping.Columns {
+		target := strings.TrimSpace(column.TargetField)
+		if _, ok := known[target]; !ok {
+			return nil, invalidMappingError(fmt.Sprintf("Import mapping %q targets unknown field %s; %s imports accept %s", mapping.Name, target, mapping.EntitySet, strings.Join(fields, ", ")))
+		}
+		if _, duplicate := targets[target]; duplicate {
+			return nil, invalidMappingError(fmt.Sprintf("Import mapping %q maps %s more than once", mapping.Name, target))
+		}
+		targets[target] = struct{}{}
+
+		mapped := mappedColumn{source: -1, constant: column.Constant}
+		if source := strings.TrimSpace(column.SourceColumn); source != "" {
+			idx, ok := sourceIndex[strings.ToLower(source)]
+			if !ok {
+				return nil, invalidMappingError(fmt.Sprintf("The file has no column %q required by import mapping %q", source, mapping.Name))
+			}
+			mapped.source = idx
+			consumed[idx] = struct{}{}
+		}
+		if mapped.transforms, err = column.ParsedTransforms(); err != nil {
+			return nil, invalidMappingError(err.Error())
+		}
+		if column.DateFormat != "" {
+			if mapped.layout, err = models.ImportDateLayout(column.DateFormat); err != nil {
+				return nil, invalidMappingError(err.Error())
+			}
+		}
+
+		headers = append(headers, target)
+		columns = append(columns, mapped)
+	}
+
+	for idx, header := range table.Headers {
+		trimmed := strings.TrimSpace(header)
+		if _, ok := consumed[idx]; ok {
+			continue
+		}
+		if _, ok := known[trimmed]; !ok {
+			continue
+		}
+		if _, ok := targets[trimmed]; ok {
+			continue
+		}
+		headers = append(headers, trimmed)
+		columns = append(columns, mappedColumn{source: idx})
+	}
+
+	rows := make([][]string, len(table.Rows))
+	for rowIndex, row := range table.Rows {
+		mappedRow := make([]string, len(columns))
+		for idx, column := range columns {
+			value := ""
+			if column.source >= 0 && column.source < len(row) {
+				value = row[column.source]
+			}
+			if strings.TrimSpace(value) == "" {
+				value = column.constant
+			}
+			mappedRow[idx] = transformImportValue(value, column.transforms, column.layout)
+		}
+		rows[rowIndex] = mappedRow
+	}
+
+	return &database.Table{Sheet: table.Sheet, Headers: headers, Rows: rows}, nil
+}
+
+func transformImportValue(value string, transforms []models.ImportTransform, layout string) string {
+	for _, transform := range transforms {
+		switch transform {
+		case models.ImportTransformTrim:
+			value = strings.TrimSpace(value)
+		case models.ImportTransformUppercase:
+			value = strings.ToUpper(value)
+		case models.ImportTransformLowercase:
+			value = strings.ToLower(value)
+		}
+	}
+	if layout != "" && strings.TrimSpace(value) != "" {
+		if parsed, err := time.ParseInLocation(layout, strings.TrimSpace(value), time.UTC); err == nil {
+			value = parsed.Format(time.RFC3339)
+		}
+	}
+	return value
+}
+
+// headerSuggestion proposes the field an unrecognised header most likely refers to.
+type headerSuggestion struct {
+	Column string  `json:"column"`
+	Field  string  `json:"field"`
+	Score  float64 `json:"score"`
+}
+
+// suggestHeaders compares every header that is not a known field with the fields missing from the table
+// and suggests the closest one. Names are compared without case, spaces and punctuation, so "E-mail"
+// matches Email and "account id" matches AccountID.
+func suggestHeaders(table *database.Table, fields []string) []headerSuggestion {
+	present := make(map[string]struct{}, len(table.Headers))
+	for _, column := range table.Columns() {
+		present[column] = struct{}{}
+	}
+
+	var candidates []string
+	for _, field := range fields {
+		if _, ok := present[field]; !ok {
+			candidates = append(candidates, field)
+		}
+	}
+
+	suggestions := []headerSuggestion{}
+	for _, column := range table.Columns() {
+		if containsField(fields, column) {
+			continue
+		}
+		normalizedColumn := normalizeHeader(column)
+		best := headerSuggestion{Column: column}
+		for _, field := range candidates {
+			if score := headerSimilarity(normalizedColumn, normalizeHeader(field)); score > best.Score {
+				best.Field, best.Score = field, score
+			}
+		}
+		if best.Score >= headerSuggestionThreshold {
+			best.Score = float64(int(best.Score*100+0.5)) / 100
+			suggestions = append(suggestions, best)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	return suggestions
+}
+
+func containsField(fields []string, name string) bool {
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeHeader(header string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(header) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// headerSimilarity scores two normalized names between 0 and 1 from their edit distance. A name that
+// contains the other, such as "emailaddress" and "email", scores at least 0.8.
+func headerSimilarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+
+	longest := len([]rune(a))
+	if other := len([]rune(b)); other > longest {
+		longest = other
+	}
+	score := 1 - float64(levenshtein(a, b))/float64(longest)
+
+	shorter := a
+	if len(b) < len(a) {
+		shorter = b
+	}
+	if len(shorter) >= 3 && (strings.Contains(a, b) || strings.Contains(b, a)) && score < 0.8 {
+		score = 0.8
+	}
+	return score
+}
+
+func levenshtein(a, b string) int {
+	source, target := []rune(a), []rune(b)
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(target)]
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nlstn/my-crm/backend/database"
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+// referenceKey is an import column that refers to a record by a natural key instead of its ID,
+// so files from other systems can be imported without knowing the IDs assigned here.
+type referenceKey struct {
+	// Column is the import column, for example AccountName.
+	Column string
+	Model  interface{}
+	// Key is the database column compared case-insensitively with the value.
+	Key string
+	// Label is the singular record name and Match describes the comparison, as in "account named".
+	Label string
+	Match string
+	// Scope is an optional account_id column narrowing the candidates to the account of the row.
+	Scope string
+}
+
+var (
+	accountNameReference  = referenceKey{Column: "AccountName", Model: &models.Account{}, Key: "name", Label: "account", Match: "named"}
+	contactEmailReference = referenceKey{Column: "ContactEmail", Model: &models.Contact{}, Key: "email", Label: "contact", Match: "with email", Scope: "account_id"}
+	ownerEmailReference   = referenceKey{Column: "OwnerEmail", Model: &models.Employee{}, Key: "email", Label: "employee", Match: "with email"}
+	productSKUReference   = referenceKey{Column: "ProductSKU", Model: &models.Product{}, Key: "sku", Label: "product", Match: "with SKU"}
+)
+
+// resolveReferences looks up the natural key of every record for which unset reports that its ID column
+// is empty, and returns the IDs found by record index. Values matching no record or several records are
+// returned as row errors on the natural key column. When scope returns an account ID for a record, only
+// candidates of that account are considered.
+func resolveReferences(db *gorm.DB, table *database.Table, rowNumbers []int, ref referenceKey, field string, unset func(idx int) bool, scope func(idx int) uint) (map[int]uint, []database.RowError, error) {
+	resolved := make(map[int]uint)
+	lookup := table.Lookup(ref.Column)
+
+	values := make(map[int]string)
+	keySet := make(map[string]struct{})
+	for idx, row := range rowNumbers {
+		if !unset(idx) {
+			continue
+		}
+		if value := lookup(row); value != "" {
+			values[idx] = value
+			keySet[strings.ToLower(value)] = struct{}{}
+		}
+	}
+	if len(values) == 0 {
+		return resolved, nil, nil
+	}
+
+	type candidate struct {
+		ID      uint
+		Value   string
+		ScopeID uint
+	}
+	columns := []string{"id", fmt.Sprintf("LOWER(%s) AS value", ref.Key)}
+	if ref.Scope != "" {
+		columns = append(columns, fmt.Sprintf("%s AS scope_id", ref.Scope))
+	}
+	var candidates []candidate
+	if err := db.Model(ref.Model).Select(columns).Where(fmt.Sprintf("LOWER(%s) IN ?", ref.Key), keysFromStringSet(keySet)).Scan(&candidates).Error; err != nil {
+		return nil, nil, err
+	}
+	byValue := make(map[string][]candidate, len(candidates))
+	for _, c := range candidates {
+		byValue[c.Value] = append(byValue[c.Value], c)
+	}
+
+	var rowErrors []database.RowError
+	for idx, value := range values {
+		matches := byValue[strings.ToLower(value)]
+		scopeID := uint(0)
+		if scope != nil {
+			scopeID = scope(idx)
+		}
+		if scopeID != 0 {
+			var scoped []candidate
+			for _, c := range matches {
+				if c.ScopeID == scopeID {
+					scoped = append(scoped, c)
+				}
+			}
+			matches = scoped
+		}
+
+		switch len(matches) {
+		case 1:
+			resolved[idx] = matches[0].ID
+		case 0:
+			message := fmt.Sprintf("no %s %s %q exists", ref.Label, ref.Match, value)
+			if scopeID != 0 {
+				message = fmt.Sprintf("no %s %s %q belongs to account %d", ref.Label, ref.Match, value, scopeID)
+			}
+			rowErrors = append(rowErrors, database.RowError{Row: rowNumbers[idx], Field: ref.Column, Message: message})
+		default:
+			rowErrors = append(rowErrors, database.RowError{
+				Row:     rowNumbers[idx],
+				Field:   ref.Column,
+				Message: fmt.Sprintf("%q matches %d %ss; give the %s instead", value, len(matches), ref.Label, field),
+			})
+		}
+	}
+	sortRowErrors(rowErrors)
+	return resolved, rowErrors, nil
+}
+
+// resolveRequiredReference resolves a natural key into a required ID field, which the parser leaves at zero
+// when only the natural key was given.
+func resolveRequiredReference(db *gorm.DB, table *database.Table, rowNumbers []int, ref referenceKey, field string, id func(idx int) *uint, scope func(idx int) uint) ([]database.RowError, error) {
+	resolved, rowErrors, err := resolveReferences(db, table, rowNumbers, ref, field, func(idx int) bool { return *id(idx) == 0 }, scope)
+	if err != nil {
+		return nil, err
+	}
+	for idx, value := range resolved {
+		*id(idx) = value
+	}
+	return rowErrors, nil
+}
+
+// resolveOptionalReference resolves a natural key into an optional ID field.
+func resolveOptionalReference(db *gorm.DB, table *database.Table, rowNumbers []int, ref referenceKey, field string, id func(idx int) **uint, scope func(idx int) uint) ([]database.RowError, error) {
+	resolved, rowErrors, err := resolveReferences(db, table, rowNumbers, ref, field, func(idx int) bool { return *id(idx) == nil }, scope)
+	if err != nil {
+		return nil, err
+	}
+	for idx, value := range resolved {
+		value := value
+		*id(idx) = &value
+	}
+	return rowErrors, nil
+}
+
+// resolveActivityReferences fills AccountID, ContactID and EmployeeID from AccountName, ContactEmail and OwnerEmail.
+func resolveActivityReferences(db *gorm.DB, table *database.Table, activities []models.Activity, rowNumbers []int) ([]database.RowError, error) {
+	accountErrors, err := resolveOptionalReference(db, table, rowNumbers, accountNameReference, "AccountID",
+		func(idx int) **uint { return &activities[idx].AccountID }, nil)
+	if err != nil {
+		return nil, err
+	}
+	contactErrors, err := resolveOptionalReference(db, table, rowNumbers, contactEmailReference, "ContactID",
+		func(idx int) **uint { return &activities[idx].ContactID },
+		func(idx int) uint { return optionalID(activities[idx].AccountID) })
+	if err != nil {
+		return nil, err
+	}
+	ownerErrors, err := resolveOptionalReference(db, table, rowNumbers, ownerEmailReference, "EmployeeID",
+		func(idx int) **uint { return &activities[idx].EmployeeID }, nil)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRowErrors(accountErrors, contactErrors, ownerErrors), nil
+}
+
+// resolveTaskReferences fills AccountID, ContactID and EmployeeID from AccountName, ContactEmail and OwnerEmail.
+func resolveTaskReferences(db *gorm.DB, table *database.Table, tasks []models.Task, rowNumbers []int) ([]database.RowError, error) {
+	accountErrors, err := resolveOptionalReference(db, table, rowNumbers, accountNameReference, "AccountID",
+		func(idx int) **uint { return &tasks[idx].AccountID }, nil)
+	if err != nil {
+		return nil, err
+	}
+	contactErrors, err := resolveOptionalReference(db, table, rowNumbers, contactEmailReference, "ContactID",
+		func(idx int) **uint { return &tasks[idx].ContactID },
+		func(idx int) uint { return optionalID(tasks[idx].AccountID) })
+	if err != nil {
+		return nil, err
+	}
+	ownerErrors, err := resolveOptionalReference(db, table, rowNumbers, ownerEmailReference, "EmployeeID",
+		func(idx int) **uint { return &tasks[idx].EmployeeID }, nil)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRowErrors(accountErrors, contactErrors, ownerErrors), nil
+}
+
+// resolveIssueReferences fills AccountID, ContactID and EmployeeID from AccountName, ContactEmail and OwnerEmail.
+func resolveIssueReferences(db *gorm.DB, table *database.Table, issues []models.Issue, rowNumbers []int) ([]database.RowError, error) {
+	accountErrors, err := resolveRequiredReference(db, table, rowNumbers, accountNameReference, "AccountID",
+		func(idx int) *uint { return &issues[idx].AccountID }, nil)
+	if err != nil {
+		return nil, err
+	}
+	contactErrors, err := resolveOptionalReference(db, table, rowNumbers, contactEmailReference, "ContactID",
+		func(idx int) **uint { return &issues[idx].ContactID },
+		func(idx int) uint { return issues[idx].AccountID })
+	if err != nil {
+		return nil, err
+	}
+	ownerErrors, err := resolveOptionalReference(db, table, rowNumbers, ownerEmailReference, "EmployeeID",
+		func(idx int) **uint { return &issues[idx].EmployeeID }, nil)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRowErrors(accountErrors, contactErrors, ownerErrors), nil
+}
+
+// resolveOpportunityReferences fills AccountID, ContactID and OwnerEmployeeID from AccountName, ContactEmail and OwnerEmail.
+func resolveOpportunityReferences(db *gorm.DB, table *database.Table, opportunities []models.Opportunity, rowNumbers []int) ([]database.RowError, error) {
+	accountErrors, err := resolveRequiredReference(db, table, rowNumbers, accountNameReference, "AccountID",
+		func(idx int) *uint { return &opportunities[idx].AccountID }, nil)
+	if err != nil {
+		return nil, err
+	}
+	contactErrors, err := resolveOptionalReference(db, table, rowNumbers, contactEmailReference, "ContactID",
+		func(idx int) **uint { return &opportunities[idx].ContactID },
+		func(idx int) uint { return opportunities[idx].AccountID })
+	if err != nil {
+		return nil, err
+	}
+	ownerErrors, err := resolveOptionalReference(db, table, rowNumbers, ownerEmailReference, "OwnerEmployeeID",
+		func(idx int) **uint { return &opportunities[idx].OwnerEmployeeID }, nil)
+	if err != nil {
+		return nil, err
+	}
+	return mergeRowErrors(accountErrors, contactErrors, ownerErrors), nil
+}
+
+func optionalID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// mergeRowErrors combines row errors from several checks, ordered by row.
+func mergeRowErrors(groups ...[]database.RowError) []database.RowError {
+	var merged []database.RowError
+	for _, group := range groups {
+		merged = append(merged, group...)
+	}
+	sortRowErrors(merged)
+	return merged
+}
+
+// rowsWithErrors returns the row numbers that have at least one error.
+func rowsWithErrors(rowErrors []database.RowError) map[int]struct{} {
+	rows := make(map[int]struct{}, len(rowErrors))
+	for _, rowError := range rowErrors {
+		rows[rowError.Row] = struct{}{}
+	}
+	return rows
+}
+
+func keysFromStringSet(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func sortRowErrors(rowErrors []database.RowError) {
+	sort.SliceStable(rowErrors, func(i, j int) bool {
+		return rowErrors[i].Row < rowErrors[j].Row
+	})
+}
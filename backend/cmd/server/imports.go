@@ -0,0 +1,1167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nlstn/go-odata"
+	"github.com/nlstn/my-crm/backend/database"
+	"github.com/nlstn/my-crm/backend/models"
+	"github.com/nlstn/my-crm/backend/workflows"
+	"gorm.io/gorm"
+)
+
+// errDryRunRollback aborts the preview transaction once every row has been checked.
+var errDryRunRollback = errors.New("import dry run rollback")
+
+// importSpec describes how one entity type is imported from CSV.
+type importSpec[T any] struct {
+	// EntitySet names the entity set, for example Accounts. Actions are named Import<EntitySet>CSV and Import<EntitySet>XLSX.
+	EntitySet string
+	// Label is the singular entity name used in messages, for example "account".
+	Label string
+	// Codec parses the rows of an uploaded file.
+	Codec database.CSVCodec[T]
+	// Fields lists the codec's columns followed by the natural key columns of References, and is filled in when
+	// the import is registered. Import mappings may only target these and dry runs suggest them for headers they
+	// do not recognise.
+	Fields []string
+	// Validate checks references to existing records and fills IDs given by natural key. It is optional.
+	Validate func(db *gorm.DB, opts importOptions, table *database.Table, records []T, rowNumbers []int) ([]database.RowError, error)
+	// References maps the natural key columns Validate resolves, such as AccountName, to the ID field they fill.
+	References map[string]string
+	// Warn reports rows that would import but look suspicious. It is optional and only used by dry runs. Records
+	// that match an existing record carry its ID, the others have none.
+	Warn func(db *gorm.DB, records []T, rowNumbers []int) ([]database.RowWarning, error)
+	// MatchKeys lists the natural keys rows can be matched by in update and upsert mode, in addition to ID.
+	MatchKeys map[string][]string
+}
+
+// parse reads the rows of table with the spec's codec. Update imports only change the columns the file has, so
+// the codec does not require the others.
+func (spec importSpec[T]) parse(table *database.Table, opts importOptions) ([]T, []int, []database.RowError, error) {
+	if opts.Mode == importModeUpdate {
+		return spec.Codec.ParseUpdate(table)
+	}
+	return spec.Codec.Parse(table)
+}
+
+// validate runs the spec's dependency checks. Update imports keep the stored references of columns the file does
+// not have, so errors about those columns are dropped; the updated record is still validated when it is saved.
+func (spec importSpec[T]) validate(db *gorm.DB, opts importOptions, table *database.Table, records []T, rowNumbers []int) ([]database.RowError, error) {
+	rowErrors, err := spec.Validate(db, opts, table, records, rowNumbers)
+	if err != nil || opts.Mode != importModeUpdate {
+		return rowErrors, err
+	}
+
+	provided := make(map[string]struct{})
+	for _, column := range table.Columns() {
+		provided[column] = struct{}{}
+		if field, ok := spec.References[column]; ok {
+			provided[field] = struct{}{}
+		}
+	}
+	kept := rowErrors[:0]
+	for _, rowError := range rowErrors {
+		if _, ok := provided[rowError.Field]; ok || rowError.Field == "" {
+			kept = append(kept, rowError)
+		}
+	}
+	return kept, nil
+}
+
+// importColumns returns the fields an import writes to the existing record matched by the row with the given number.
+type importColumns func(row int) []string
+
+// columns returns the fields written by an import of table. Natural key columns stand for the ID field they fill,
+// so updates through AccountName change AccountID. Empty cells of columns with a GORM default are parsed as the
+// default, so rows leave those columns out and keep the stored value rather than resetting it.
+func (spec importSpec[T]) columns(table *database.Table) importColumns {
+	columns := table.Columns()
+	blank := make(map[string]func(rowNumber int) string)
+	for _, column := range table.Columns() {
+		if field, ok := spec.References[column]; ok {
+			columns = append(columns, field)
+		}
+		if spec.Codec.HasDefault(column) {
+			blank[column] = table.Lookup(column)
+		}
+	}
+	if len(blank) == 0 {
+		return func(int) []string { return columns }
+	}
+
+	return func(row int) []string {
+		kept := make([]string, 0, len(columns))
+		for _, column := range columns {
+			if lookup, ok := blank[column]; ok && lookup(row) == "" {
+				continue
+			}
+			kept = append(kept, column)
+		}
+		return kept
+	}
+}
+
+// errImportRowsRejected rolls back an update or upsert import when rows cannot be matched.
+var errImportRowsRejected = errors.New("import rows rejected")
+
+// importMode selects how imported rows are written.
+type importMode string
+
+const (
+	importModeInsert importMode = "insert"
+	importModeUpdate importMode = "update"
+	importModeUpsert importMode = "upsert"
+)
+
+// importOptions holds the parameters shared by all import actions.
+type importOptions struct {
+	Mode     importMode
+	MatchKey string
+	// KeyFields are the model fields compared to find the existing record for a row.
+	KeyFields []string
+	DryRun    bool
+	// SkipInvalidRows imports the valid rows and reports the rest instead of rejecting the whole file.
+	SkipInvalidRows bool
+	// MappingID selects a saved import mapping applied to the file before it is parsed; zero uses the headers as they are.
+	MappingID uint
+	// CreateMissingTags creates the account tags a file names that do not exist yet instead of rejecting the rows.
+	CreateMissingTags bool
+}
+
+type rowOutcome int
+
+const (
+	rowInserted rowOutcome = iota + 1
+	rowUpdated
+	rowUnchanged
+)
+
+// importResult counts the outcome of an import and, for dry runs, the affected rows.
+type importResult struct {
+	Inserted     int
+	Updated      int
+	Unchanged    int
+	RowsToInsert []importPreviewRow
+	RowsToUpdate []importPreviewRow
+	Warnings     []database.RowWarning
+	// IDs maps the row numbers written by importTable to the primary key of their record.
+	IDs map[int]uint
+	// Matched maps the row numbers a dry run would update or leave unchanged to the ID of the record they match.
+	Matched map[int]uint
+}
+
+func (r *importResult) count(outcome rowOutcome) {
+	switch outcome {
+	case rowInserted:
+		r.Inserted++
+	case rowUpdated:
+		r.Updated++
+	case rowUnchanged:
+		r.Unchanged++
+	}
+}
+
+// importPreviewRow is a row that a dry run would insert or update.
+type importPreviewRow struct {
+	Row    int         `json:"row"`
+	Record interface{} `json:"record"`
+}
+
+// registerImportActions registers the Import*CSV and Import*XLSX actions of every entity supporting bulk import,
+// along with the actions that import whole workbooks and migration packages and run imports as background jobs.
+func registerImportActions(service *odata.Service, db *gorm.DB) error {
+	kinds := importKinds{}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.Account]{
+		EntitySet: "Accounts",
+		Label:     "account",
+		Codec:     database.AccountCSV,
+		Validate:  validateAccountDependencies,
+		MatchKeys: map[string][]string{"Name+Website": {"Name", "Website"}},
+		Warn: func(db *gorm.DB, accounts []models.Account, rowNumbers []int) ([]database.RowWarning, error) {
+			return importDuplicateWarnings(db, "account", accounts, rowNumbers)
+		},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.Contact]{
+		EntitySet:  "Contacts",
+		Label:      "contact",
+		Codec:      database.ContactCSV,
+		Validate:   validateContactDependencies,
+		References: map[string]string{"AccountName": "AccountID"},
+		MatchKeys:  map[string][]string{"Email": {"Email"}},
+		Warn: func(db *gorm.DB, contacts []models.Contact, rowNumbers []int) ([]database.RowWarning, error) {
+			return importDuplicateWarnings(db, "contact", contacts, rowNumbers)
+		},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.Lead]{
+		EntitySet: "Leads",
+		Label:     "lead",
+		Codec:     database.LeadCSV,
+		MatchKeys: map[string][]string{"Email": {"Email"}},
+		Warn: func(db *gorm.DB, leads []models.Lead, rowNumbers []int) ([]database.RowWarning, error) {
+			return importDuplicateWarnings(db, "lead", leads, rowNumbers)
+		},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.Activity]{
+		EntitySet:  "Activities",
+		Label:      "activity",
+		Codec:      database.ActivityCSV,
+		Validate:   validateActivityDependencies,
+		References: map[string]string{"AccountName": "AccountID", "ContactEmail": "ContactID", "OwnerEmail": "EmployeeID"},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.Issue]{
+		EntitySet:  "Issues",
+		Label:      "issue",
+		Codec:      database.IssueCSV,
+		Validate:   validateIssueDependencies,
+		References: map[string]string{"AccountName": "AccountID", "ContactEmail": "ContactID", "OwnerEmail": "EmployeeID"},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.Task]{
+		EntitySet:  "Tasks",
+		Label:      "task",
+		Codec:      database.TaskCSV,
+		Validate:   validateTaskDependencies,
+		References: map[string]string{"AccountName": "AccountID", "ContactEmail": "ContactID", "OwnerEmail": "EmployeeID"},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.Opportunity]{
+		EntitySet:  "Opportunities",
+		Label:      "opportunity",
+		Codec:      database.OpportunityCSV,
+		Validate:   validateOpportunityDependencies,
+		References: map[string]string{"AccountName": "AccountID", "ContactEmail": "ContactID", "OwnerEmail": "OwnerEmployeeID"},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.OpportunityLineItem]{
+		EntitySet:  "OpportunityLineItems",
+		Label:      "opportunity line item",
+		Codec:      database.OpportunityLineItemCSV,
+		Validate:   validateOpportunityLineItemDependencies,
+		References: map[string]string{"ProductSKU": "ProductID"},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.Employee]{
+		EntitySet: "Employees",
+		Label:     "employee",
+		Codec:     database.EmployeeCSV,
+		MatchKeys: map[string][]string{"Email": {"Email"}},
+		Warn: func(db *gorm.DB, employees []models.Employee, rowNumbers []int) ([]database.RowWarning, error) {
+			emails := make([]string, len(employees))
+			ids := make([]uint, len(employees))
+			for i, employee := range employees {
+				emails[i], ids[i] = employee.Email, employee.ID
+			}
+			return probableDuplicates(db, &models.Employee{}, "email", "Email", "employee", emails, ids, rowNumbers)
+		},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.Product]{
+		EntitySet: "Products",
+		Label:     "product",
+		Codec:     database.ProductCSV,
+		MatchKeys: map[string][]string{"SKU": {"SKU"}},
+		Warn: func(db *gorm.DB, products []models.Product, rowNumbers []int) ([]database.RowWarning, error) {
+			names := make([]string, len(products))
+			ids := make([]uint, len(products))
+			for i, product := range products {
+				names[i], ids[i] = product.Name, product.ID
+			}
+			return probableDuplicates(db, &models.Product{}, "name", "Name", "product", names, ids, rowNumbers)
+		},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.Tag]{
+		EntitySet: "Tags",
+		Label:     "tag",
+		Codec:     database.TagCSV,
+		MatchKeys: map[string][]string{"Name": {"Name"}},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.IssueUpdate]{
+		EntitySet: "IssueUpdates",
+		Label:     "issue update",
+		Codec:     database.IssueUpdateCSV,
+		Validate:  validateIssueUpdateDependencies,
+	}); err != nil {
+		return err
+	}
+
+	if err := registerImportAction(service, db, kinds, importSpec[models.WorkflowRule]{
+		EntitySet: "WorkflowRules",
+		Label:     "workflow rule",
+		Codec:     database.WorkflowRuleCSV,
+		MatchKeys: map[string][]string{"Name": {"Name"}},
+	}); err != nil {
+		return err
+	}
+
+	if err := registerWorkbookImportAction(service, db, kinds); err != nil {
+		return err
+	}
+	if err := registerMigrationPackageAction(service, db, kinds); err != nil {
+		return err
+	}
+	return registerImportJobActions(service, db, kinds)
+}
+
+// importFormat is a file format accepted by the import actions.
+type importFormat struct {
+	// Suffix ends the action name, for example CSV in ImportAccountsCSV.
+	Suffix string
+	// Parameter is the action parameter carrying the file.
+	Parameter string
+	Read      func(payload, entitySet string) (*database.Table, error)
+}
+
+var importFormats = []importFormat{
+	{Suffix: "CSV", Parameter: "Csv", Read: readCSVPayload},
+	{Suffix: "XLSX", Parameter: "Xlsx", Read: readXLSXPayload},
+}
+
+func readCSVPayload(payload, entitySet string) (*database.Table, error) {
+	return database.ReadCSV(strings.NewReader(payload))
+}
+
+// readXLSXPayload decodes a base64 encoded workbook and returns the sheet named after the entity set,
+// or the first sheet when there is none.
+func readXLSXPayload(payload, entitySet string) (*database.Table, error) {
+	tables, err := readXLSXWorkbook(payload)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		if strings.EqualFold(table.Sheet, entitySet) {
+			return table, nil
+		}
+	}
+	return tables[0], nil
+}
+
+func readXLSXWorkbook(payload string) ([]*database.Table, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+	if err != nil {
+		return nil, fmt.Errorf("Xlsx must be base64 encoded")
+	}
+	return database.ReadXLSX(bytes.NewReader(data))
+}
+
+// registerImportAction registers the CSV and XLSX import actions of one entity type.
+func registerImportAction[T any](service *odata.Service, db *gorm.DB, kinds importKinds, spec importSpec[T]) error {
+	fields := append([]string{}, spec.Codec.Headers...)
+	for column := range spec.References {
+		fields = append(fields, column)
+	}
+	sort.Strings(fields[len(spec.Codec.Headers):])
+	spec.Fields = fields
+	kinds[spec.EntitySet] = newImportKind(db, spec)
+
+	for _, format := range importFormats {
+		format := format
+		if err := service.RegisterAction(odata.ActionDefinition{
+			Name:      "Import" + spec.EntitySet + format.Suffix,
+			IsBound:   false,
+			EntitySet: "",
+			Parameters: []odata.ParameterDefinition{
+				{Name: format.Parameter, Type: reflect.TypeOf(""), Required: true},
+				{Name: "DryRun", Type: reflect.TypeOf(false), Required: false},
+				{Name: "Mode", Type: reflect.TypeOf(""), Required: false},
+				{Name: "MatchKey", Type: reflect.TypeOf(""), Required: false},
+				{Name: "SkipInvalidRows", Type: reflect.TypeOf(false), Required: false},
+				{Name: "MappingID", Type: reflect.TypeOf(uint(0)), Required: false},
+				{Name: "CreateMissingTags", Type: reflect.TypeOf(false), Required: false},
+			},
+			ReturnType: reflect.TypeOf(map[string]interface{}{}),
+			Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+				payload, ok := params[format.Parameter].(string)
+				if !ok || strings.TrimSpace(payload) == "" {
+					return writeJSONError(w, http.StatusBadRequest, format.Parameter+" parameter is required")
+				}
+
+				opts, err := parseImportOptions(spec, params)
+				if err != nil {
+					return writeJSONError(w, http.StatusBadRequest, err.Error())
+				}
+
+				table, err := format.Read(payload, spec.EntitySet)
+				if err != nil {
+					return writeJSONError(w, http.StatusBadRequest, err.Error())
+				}
+				if opts.MappingID != 0 {
+					table, err = applyImportMapping(db, opts.MappingID, spec.EntitySet, spec.Fields, table)
+					var invalid invalidMappingError
+					if errors.As(err, &invalid) {
+						return writeJSONError(w, http.StatusBadRequest, invalid.Error())
+					}
+					if err != nil {
+						return err
+					}
+				}
+
+				return handleImport(w, r, db, spec, opts, table)
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleImport parses, validates and writes the rows of an uploaded table according to the import options.
+func handleImport[T any](w http.ResponseWriter, r *http.Request, db *gorm.DB, spec importSpec[T], opts importOptions, table *database.Table) error {
+	columns := spec.columns(table)
+	records, rowNumbers, validationErrors, err := spec.parse(table, opts)
+	if err != nil {
+		if opts.DryRun {
+			// A misnamed required header fails parsing, which is exactly when suggestions help most.
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			return json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":             err.Error(),
+				"headerSuggestions": suggestHeaders(table, spec.Fields),
+			})
+		}
+		return writeJSONError(w, http.StatusBadRequest, err.Error())
+	}
+
+	var dependencyErrors []database.RowError
+	if spec.Validate != nil {
+		dependencyErrors, err = spec.validate(db, opts, table, records, rowNumbers)
+		if err != nil {
+			return err
+		}
+	}
+	combined := append(validationErrors, dependencyErrors...)
+
+	if opts.DryRun {
+		return previewImport(w, r, db, spec, opts, table, records, rowNumbers, combined)
+	}
+	if opts.SkipInvalidRows {
+		return importValidRows(w, db, spec, opts, table, records, rowNumbers, combined)
+	}
+
+	if len(combined) > 0 {
+		return writeValidationErrors(w, fmt.Sprintf("One or more %s rows could not be imported", spec.Label), withSheet(table, combined))
+	}
+	if len(records) == 0 {
+		return writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("No %s rows were found in the file", spec.Label))
+	}
+
+	var result importResult
+	if opts.Mode == importModeInsert {
+		for idx := range records {
+			clearPrimaryKey(&records[idx])
+		}
+		if err := db.Create(&records).Error; err != nil {
+			return err
+		}
+		result.Inserted = len(records)
+	} else {
+		var rowErrors []database.RowError
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for idx := range records {
+				outcome, _, rowErr, err := importRow(tx, &records[idx], opts, columns(rowNumbers[idx]))
+				if err != nil {
+					return err
+				}
+				if rowErr != nil {
+					rowErr.Row = rowNumbers[idx]
+					rowErrors = append(rowErrors, *rowErr)
+					continue
+				}
+				result.count(outcome)
+			}
+			if len(rowErrors) > 0 {
+				return errImportRowsRejected
+			}
+			return nil
+		})
+		if errors.Is(err, errImportRowsRejected) {
+			return writeValidationErrors(w, fmt.Sprintf("One or more %s rows could not be imported", spec.Label), withSheet(table, rowErrors))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"imported":  result.Inserted + result.Updated,
+		"inserted":  result.Inserted,
+		"updated":   result.Updated,
+		"unchanged": result.Unchanged,
+	})
+}
+
+// withSheet labels row errors with the sheet of the table they came from.
+func withSheet(table *database.Table, rowErrors []database.RowError) []database.RowError {
+	for idx := range rowErrors {
+		rowErrors[idx].Sheet = table.Sheet
+	}
+	return rowErrors
+}
+
+// importTable imports the rows of a table inside tx and returns row errors instead of writing a response.
+// It is used for imports that span several tables, which succeed or fail together.
+func importTable[T any](tx *gorm.DB, spec importSpec[T], opts importOptions, table *database.Table) (importResult, []database.RowError, error) {
+	result := importResult{IDs: make(map[int]uint)}
+
+	records, rowNumbers, rowErrors, err := spec.parse(table, opts)
+	if err != nil {
+		return result, nil, err
+	}
+	if spec.Validate != nil {
+		dependencyErrors, err := spec.validate(tx, opts, table, records, rowNumbers)
+		if err != nil {
+			return result, nil, err
+		}
+		rowErrors = append(rowErrors, dependencyErrors...)
+	}
+	if len(rowErrors) > 0 {
+		return result, withSheet(table, rowErrors), nil
+	}
+
+	if opts.Mode == importModeInsert {
+		for idx := range records {
+			clearPrimaryKey(&records[idx])
+		}
+		if len(records) > 0 {
+			if err := tx.CreateInBatches(&records, importJobBatchSize).Error; err != nil {
+				return result, nil, err
+			}
+		}
+		for idx := range records {
+			result.IDs[rowNumbers[idx]] = primaryKey(&records[idx])
+		}
+		result.Inserted = len(records)
+		return result, nil, nil
+	}
+
+	columns := spec.columns(table)
+	for idx := range records {
+		outcome, saved, rowErr, err := importRow(tx, &records[idx], opts, columns(rowNumbers[idx]))
+		if err != nil {
+			return result, nil, err
+		}
+		if rowErr != nil {
+			rowErr.Row = rowNumbers[idx]
+			rowErrors = append(rowErrors, *rowErr)
+			continue
+		}
+		result.count(outcome)
+		result.IDs[rowNumbers[idx]] = primaryKey(saved)
+	}
+	return result, withSheet(table, rowErrors), nil
+}
+
+// workbookImportOrder lists the entity sets of a workbook import so referenced records are written first.
+var workbookImportOrder = []string{
+	"Employees", "Products", "Tags", "Accounts", "Contacts", "Leads",
+	"Opportunities", "OpportunityLineItems", "Activities", "Issues", "IssueUpdates", "Tasks",
+	"WorkflowRules",
+}
+
+// registerWorkbookImportAction registers ImportWorkbookXLSX, which imports every sheet named after an entity set
+// in one transaction. Any row error rolls back the whole workbook.
+func registerWorkbookImportAction(service *odata.Service, db *gorm.DB, kinds importKinds) error {
+	return service.RegisterAction(odata.ActionDefinition{
+		Name:      "ImportWorkbookXLSX",
+		IsBound:   false,
+		EntitySet: "",
+		Parameters: []odata.ParameterDefinition{
+			{Name: "Xlsx", Type: reflect.TypeOf(""), Required: true},
+			{Name: "DryRun", Type: reflect.TypeOf(false), Required: false},
+			{Name: "Mode", Type: reflect.TypeOf(""), Required: false},
+			{Name: "CreateMissingTags", Type: reflect.TypeOf(false), Required: false},
+		},
+		ReturnType: reflect.TypeOf(map[string]interface{}{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			payload, ok := params["Xlsx"].(string)
+			if !ok || strings.TrimSpace(payload) == "" {
+				return writeJSONError(w, http.StatusBadRequest, "Xlsx parameter is required")
+			}
+			dryRun, _ := params["DryRun"].(bool)
+
+			tables, err := readXLSXWorkbook(payload)
+			if err != nil {
+				return writeJSONError(w, http.StatusBadRequest, err.Error())
+			}
+
+			bySheet := make(map[string]*database.Table, len(tables))
+			ignored := []string{}
+			for _, table := range tables {
+				if _, ok := kinds[table.Sheet]; ok {
+					bySheet[table.Sheet] = table
+				} else {
+					ignored = append(ignored, table.Sheet)
+				}
+			}
+			if len(bySheet) == 0 {
+				return writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("The workbook has no sheet named after an entity set such as %s", strings.Join(workbookImportOrder, ", ")))
+			}
+
+			type sheetResult struct {
+				Sheet     string `json:"sheet"`
+				Inserted  int    `json:"inserted"`
+				Updated   int    `json:"updated"`
+				Unchanged int    `json:"unchanged"`
+			}
+			results := []sheetResult{}
+			var rowErrors []database.RowError
+
+			txContext := r.Context()
+			if dryRun {
+				txContext = workflows.WithoutEvents(txContext)
+			}
+			err = db.WithContext(txContext).Transaction(func(tx *gorm.DB) error {
+				for _, entitySet := range workbookImportOrder {
+					table, ok := bySheet[entitySet]
+					if !ok {
+						continue
+					}
+					kind := kinds[entitySet]
+					opts, err := kind.options(map[string]interface{}{
+						"Mode":              params["Mode"],
+						"CreateMissingTags": params["CreateMissingTags"],
+					})
+					if err != nil {
+						return err
+					}
+
+					result, sheetErrors, err := kind.importTable(tx, opts, table)
+					if err != nil {
+						return fmt.Errorf("sheet %s: %w", entitySet, err)
+					}
+					rowErrors = append(rowErrors, sheetErrors...)
+					results = append(results, sheetResult{Sheet: entitySet, Inserted: result.Inserted, Updated: result.Updated, Unchanged: result.Unchanged})
+				}
+
+				if len(rowErrors) > 0 {
+					return errImportRowsRejected
+				}
+				if dryRun {
+					return errDryRunRollback
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errImportRowsRejected) && !errors.Is(err, errDryRunRollback) {
+				return err
+			}
+
+			if rowErrors == nil {
+				rowErrors = []database.RowError{}
+			}
+			if !dryRun && len(rowErrors) > 0 {
+				return writeValidationErrors(w, "One or more workbook rows could not be imported", rowErrors)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			return json.NewEncoder(w).Encode(map[string]interface{}{
+				"dryRun":        dryRun,
+				"sheets":        results,
+				"ignoredSheets": ignored,
+				"errors":        rowErrors,
+			})
+		},
+	})
+}
+
+// parseImportOptions reads the Mode, MatchKey, DryRun, SkipInvalidRows and MappingID parameters shared by all import actions.
+func parseImportOptions[T any](spec importSpec[T], params map[string]interface{}) (importOptions, error) {
+	opts := importOptions{Mode: importModeInsert, MatchKey: "ID"}
+	opts.DryRun, _ = params["DryRun"].(bool)
+	opts.SkipInvalidRows, _ = params["SkipInvalidRows"].(bool)
+	opts.CreateMissingTags, _ = params["CreateMissingTags"].(bool)
+	if rawMappingID, ok := params["MappingID"]; ok && rawMappingID != nil {
+		mappingID, err := parseUintParam(rawMappingID)
+		if err != nil {
+			return opts, fmt.Errorf("Invalid MappingID provided")
+		}
+		opts.MappingID = mappingID
+	}
+
+	if mode, ok := params["Mode"].(string); ok && strings.TrimSpace(mode) != "" {
+		switch importMode(strings.ToLower(strings.TrimSpace(mode))) {
+		case importModeInsert:
+		case importModeUpdate:
+			opts.Mode = importModeUpdate
+		case importModeUpsert:
+			opts.Mode = importModeUpsert
+		default:
+			return opts, fmt.Errorf("Mode must be one of insert, update, upsert")
+		}
+	}
+
+	if matchKey, ok := params["MatchKey"].(string); ok && strings.TrimSpace(matchKey) != "" {
+		opts.MatchKey = strings.TrimSpace(matchKey)
+	}
+	if opts.MatchKey == "ID" {
+		opts.KeyFields = []string{"ID"}
+	} else {
+		fields, ok := spec.MatchKeys[opts.MatchKey]
+		if !ok {
+			allowed := []string{"ID"}
+			for key := range spec.MatchKeys {
+				allowed = append(allowed, key)
+			}
+			sort.Strings(allowed[1:])
+			return opts, fmt.Errorf("MatchKey for %s imports must be one of %s", spec.Label, strings.Join(allowed, ", "))
+		}
+		opts.KeyFields = fields
+	}
+
+	return opts, nil
+}
+
+// previewImport imports every row that passed validation inside a transaction that is always rolled back,
+// so matching, database constraints and model hooks are checked without persisting anything. Each row runs
+// in its own savepoint so one failing row does not hide problems in the rows after it.
+func previewImport[T any](w http.ResponseWriter, r *http.Request, db *gorm.DB, spec importSpec[T], opts importOptions, table *database.Table, records []T, rowNumbers []int, rowErrors []database.RowError) error {
+	columns := spec.columns(table)
+	failedRows := make(map[int]struct{}, len(rowErrors))
+	for _, rowError := range rowErrors {
+		failedRows[rowError.Row] = struct{}{}
+	}
+
+	result := importResult{
+		RowsToInsert: []importPreviewRow{},
+		RowsToUpdate: []importPreviewRow{},
+		Warnings:     []database.RowWarning{},
+		Matched:      make(map[int]uint),
+	}
+	// The dry run assigns IDs to the rows it inserts, so the warnings look at the records as they were parsed
+	warnRecords := append([]T(nil), records...)
+
+	err := db.WithContext(workflows.WithoutEvents(r.Context())).Transaction(func(tx *gorm.DB) error {
+		var err error
+		rowErrors, err = importRowsIndividually(tx, opts, columns, records, rowNumbers, failedRows, rowErrors, &result, true)
+		if err != nil {
+			return err
+		}
+		return errDryRunRollback
+	})
+	if err != nil && !errors.Is(err, errDryRunRollback) {
+		return err
+	}
+
+	if spec.Warn != nil {
+		// Rows that update a record carry its ID, so they are not reported as duplicates of the record itself
+		for i := range warnRecords {
+			setPrimaryKey(&warnRecords[i], result.Matched[rowNumbers[i]])
+		}
+		warnings, err := spec.Warn(db, warnRecords, rowNumbers)
+		if err != nil {
+			return err
+		}
+		result.Warnings = append(result.Warnings, warnings...)
+	}
+
+	if rowErrors == nil {
+		rowErrors = []database.RowError{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"dryRun":            true,
+		"mode":              opts.Mode,
+		"inserted":          result.Inserted,
+		"updated":           result.Updated,
+		"unchanged":         result.Unchanged,
+		"rowsToInsert":      result.RowsToInsert,
+		"rowsToUpdate":      result.RowsToUpdate,
+		"rowsWithErrors":    len(failedRows),
+		"errors":            withSheet(table, rowErrors),
+		"warnings":          result.Warnings,
+		"headerSuggestions": suggestHeaders(table, spec.Fields),
+	})
+}
+
+// importValidRows imports every row that passed validation in one transaction and skips the rest. Rows that
+// fail while being written are skipped as well. The response carries the row errors and a CSV error report
+// holding the original failed rows, so they can be corrected and uploaded again on their own.
+func importValidRows[T any](w http.ResponseWriter, db *gorm.DB, spec importSpec[T], opts importOptions, table *database.Table, records []T, rowNumbers []int, rowErrors []database.RowError) error {
+	columns := spec.columns(table)
+	failedRows := make(map[int]struct{}, len(rowErrors))
+	for _, rowError := range rowErrors {
+		failedRows[rowError.Row] = struct{}{}
+	}
+
+	var result importResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rowErrors, err = importRowsIndividually(tx, opts, columns, records, rowNumbers, failedRows, rowErrors, &result, false)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	response := map[string]interface{}{
+		"imported":  result.Inserted + result.Updated,
+		"inserted":  result.Inserted,
+		"updated":   result.Updated,
+		"unchanged": result.Unchanged,
+		"skipped":   len(failedRows),
+		"errors":    []database.RowError{},
+	}
+	if len(rowErrors) > 0 {
+		report, err := database.BuildErrorReport(table, rowErrors)
+		if err != nil {
+			return err
+		}
+		response["errors"] = withSheet(table, rowErrors)
+		response["errorReport"] = string(report)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(response)
+}
+
+// importRowsIndividually writes each record that is not in failedRows inside its own savepoint, so a row
+// rejected by matching, a constraint or a model hook is recorded in rowErrors and failedRows without
+// aborting the surrounding transaction. When preview is set the written records are collected in result.
+func importRowsIndividually[T any](tx *gorm.DB, opts importOptions, columns importColumns, records []T, rowNumbers []int, failedRows map[int]struct{}, rowErrors []database.RowError, result *importResult, preview bool) ([]database.RowError, error) {
+	for idx := range records {
+		row := rowNumbers[idx]
+		if _, failed := failedRows[row]; failed {
+			continue
+		}
+
+		if err := tx.SavePoint("import_row").Error; err != nil {
+			return rowErrors, err
+		}
+		outcome, saved, rowErr, err := importRow(tx, &records[idx], opts, columns(rowNumbers[idx]))
+		if err != nil {
+			if rollbackErr := tx.RollbackTo("import_row").Error; rollbackErr != nil {
+				return rowErrors, rollbackErr
+			}
+			rowErr = &database.RowError{Message: err.Error()}
+		}
+		if rowErr != nil {
+			rowErr.Row = row
+			rowErrors = append(rowErrors, *rowErr)
+			failedRows[row] = struct{}{}
+			continue
+		}
+
+		result.count(outcome)
+		if !preview {
+			continue
+		}
+		switch outcome {
+		case rowInserted:
+			clearPrimaryKey(saved)
+			result.RowsToInsert = append(result.RowsToInsert, importPreviewRow{Row: row, Record: saved})
+		case rowUpdated:
+			result.Matched[row] = primaryKey(saved)
+			result.RowsToUpdate = append(result.RowsToUpdate, importPreviewRow{Row: row, Record: saved})
+		case rowUnchanged:
+			result.Matched[row] = primaryKey(saved)
+		}
+	}
+	return rowErrors, nil
+}
+
+// importRow writes a single record according to the import mode. Row level problems such as a missing
+// or ambiguous match are returned as a RowError; database failures are returned as an error.
+func importRow[T any](tx *gorm.DB, record *T, opts importOptions, columns []string) (rowOutcome, *T, *database.RowError, error) {
+	if opts.Mode == importModeInsert {
+		clearPrimaryKey(record)
+		if err := tx.Create(record).Error; err != nil {
+			return 0, nil, nil, err
+		}
+		return rowInserted, record, nil, nil
+	}
+
+	matches, err := findImportMatches(tx, record, opts.KeyFields)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	switch len(matches) {
+	case 0:
+		if opts.Mode == importModeUpdate {
+			return 0, nil, &database.RowError{Field: opts.MatchKey, Message: "no existing record matches this row"}, nil
+		}
+		clearPrimaryKey(record)
+		if err := tx.Create(record).Error; err != nil {
+			return 0, nil, nil, err
+		}
+		return rowInserted, record, nil, nil
+	case 1:
+		existing := &matches[0]
+		changed := copyImportColumns(existing, record, columns)
+		associations, err := copyImportAssociations(tx, existing, record, columns)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		if !changed && len(associations) == 0 {
+			return rowUnchanged, existing, nil, nil
+		}
+		if err := tx.Save(existing).Error; err != nil {
+			return 0, nil, nil, err
+		}
+		// Save only adds links, so members dropped from the file are removed here.
+		for _, name := range associations {
+			members := reflect.ValueOf(existing).Elem().FieldByName(name).Interface()
+			if err := tx.Model(existing).Association(name).Replace(members); err != nil {
+				return 0, nil, nil, err
+			}
+		}
+		return rowUpdated, existing, nil, nil
+	default:
+		return 0, nil, &database.RowError{Field: opts.MatchKey, Message: fmt.Sprintf("matches %d existing records", len(matches))}, nil
+	}
+}
+
+// findImportMatches loads up to two existing records whose key fields equal the record's values.
+// Text keys are compared case-insensitively. A record without an ID never matches by ID.
+func findImportMatches[T any](tx *gorm.DB, record *T, keyFields []string) ([]T, error) {
+	value := reflect.ValueOf(record).Elem()
+	query := tx.Model(new(T))
+	for _, name := range keyFields {
+		field := value.FieldByName(name)
+		if !field.IsValid() {
+			return nil, fmt.Errorf("unknown match field %s", name)
+		}
+		column := tx.NamingStrategy.ColumnName("", name)
+
+		if field.Kind() == reflect.String {
+			text := strings.TrimSpace(field.String())
+			if text == "" {
+				query = query.Where(fmt.Sprintf("COALESCE(%s, '') = ''", column))
+			} else {
+				query = query.Where(fmt.Sprintf("LOWER(%s) = LOWER(?)", column), text)
+			}
+			continue
+		}
+
+		if field.IsZero() {
+			return nil, nil
+		}
+		query = query.Where(fmt.Sprintf("%s = ?", column), field.Interface())
+	}
+
+	var matches []T
+	if err := query.Limit(2).Find(&matches).Error; err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// copyImportColumns copies the fields named by the CSV columns from src to dst and reports whether anything changed.
+// Columns that were not part of the CSV keep their stored values. Associations are left to copyImportAssociations.
+func copyImportColumns[T any](dst, src *T, columns []string) bool {
+	target := reflect.ValueOf(dst).Elem()
+	source := reflect.ValueOf(src).Elem()
+	timeType := reflect.TypeOf(time.Time{})
+
+	changed := false
+	for _, column := range columns {
+		if column == "ID" {
+			continue
+		}
+		to := target.FieldByName(column)
+		from := source.FieldByName(column)
+		if !to.IsValid() || !to.CanSet() {
+			continue
+		}
+
+		kind := to.Type()
+		if kind.Kind() == reflect.Pointer {
+			kind = kind.Elem()
+		}
+		if kind.Kind() == reflect.Slice || kind.Kind() == reflect.Map || (kind.Kind() == reflect.Struct && kind != timeType) {
+			continue
+		}
+
+		if importValuesEqual(to, from) {
+			continue
+		}
+		to.Set(from)
+		changed = true
+	}
+	return changed
+}
+
+// copyImportAssociations copies the many-to-many associations named by the CSV columns, such as account tags,
+// from src to dst and returns the names of those whose members changed. Members are compared by ID.
+func copyImportAssociations[T any](tx *gorm.DB, dst, src *T, columns []string) ([]string, error) {
+	statement := &gorm.Statement{DB: tx}
+	if err := statement.Parse(dst); err != nil {
+		return nil, err
+	}
+	target := reflect.ValueOf(dst).Elem()
+	source := reflect.ValueOf(src).Elem()
+
+	var changed []string
+	for _, column := range columns {
+		relationship, ok := statement.Schema.Relationships.Relations[column]
+		if !ok || relationship.JoinTable == nil {
+			continue
+		}
+
+		current := reflect.New(target.FieldByName(column).Type())
+		if err := tx.Model(dst).Association(column).Find(current.Interface()); err != nil {
+			return nil, err
+		}
+		members := source.FieldByName(column)
+		if sameImportMembers(current.Elem(), members) {
+			continue
+		}
+		target.FieldByName(column).Set(members)
+		changed = append(changed, column)
+	}
+	return changed, nil
+}
+
+// sameImportMembers reports whether two association slices hold the same records. Records without an ID
+// are about to be created and never match.
+func sameImportMembers(a, b reflect.Value) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	ids := make(map[uint]struct{}, a.Len())
+	for idx := 0; idx < a.Len(); idx++ {
+		ids[primaryKey(a.Index(idx).Addr().Interface())] = struct{}{}
+	}
+	for idx := 0; idx < b.Len(); idx++ {
+		id := primaryKey(b.Index(idx).Addr().Interface())
+		if _, ok := ids[id]; id == 0 || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func importValuesEqual(a, b reflect.Value) bool {
+	if a.Kind() == reflect.Pointer {
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return importValuesEqual(a.Elem(), b.Elem())
+	}
+	if at, ok := a.Interface().(time.Time); ok {
+		return at.Equal(b.Interface().(time.Time))
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// clearPrimaryKey resets the ID of a record so it is inserted with a generated key,
+// and so previews do not show identifiers assigned by a rolled back insert.
+func clearPrimaryKey(record interface{}) {
+	value := reflect.ValueOf(record).Elem()
+	if field := value.FieldByName("ID"); field.IsValid() && field.CanSet() {
+		field.Set(reflect.Zero(field.Type()))
+	}
+}
+
+// setPrimaryKey sets the ID of a record, zero clears it.
+func setPrimaryKey(record interface{}, id uint) {
+	if field := reflect.ValueOf(record).Elem().FieldByName("ID"); field.IsValid() && field.CanSet() && field.CanUint() {
+		field.SetUint(uint64(id))
+	}
+}
+
+// primaryKey returns the ID of a record.
+func primaryKey(record interface{}) uint {
+	if field := reflect.ValueOf(record).Elem().FieldByName("ID"); field.IsValid() && field.CanUint() {
+		return uint(field.Uint())
+	}
+	return 0
+}
+
+// probableDuplicates warns about rows whose value in column matches an existing record or an earlier row, ignoring case.
+// ids holds the ID of the record each row matches, a row is never reported as a duplicate of its own record.
+func probableDuplicates(db *gorm.DB, model interface{}, column, field, label string, values []string, ids []uint, rowNumbers []int) ([]database.RowWarning, error) {
+	normalized := make([]string, len(values))
+	lookup := make([]string, 0, len(values))
+	for i, value := range values {
+		normalized[i] = strings.ToLower(strings.TrimSpace(value))
+		if normalized[i] != "" {
+			lookup = append(lookup, normalized[i])
+		}
+	}
+	if len(lookup) == 0 {
+		return nil, nil
+	}
+
+	var existing []struct {
+		ID    uint
+		Value string
+	}
+	if err := db.Model(model).Select(fmt.Sprintf("id, LOWER(%s) AS value", column)).
+		Where(fmt.Sprintf("LOWER(%s) IN ?", column), lookup).Scan(&existing).Error; err != nil {
+		return nil, err
+	}
+	existingIDs := make(map[string][]uint, len(existing))
+	for _, record := range existing {
+		existingIDs[record.Value] = append(existingIDs[record.Value], record.ID)
+	}
+
+	var warnings []database.RowWarning
+	firstRow := make(map[string]int, len(values))
+	for i, value := range normalized {
+		if value == "" {
+			continue
+		}
+		if slices.ContainsFunc(existingIDs[value], func(id uint) bool { return id != ids[i] }) {
+			warnings = append(warnings, database.RowWarning{
+				Row:     rowNumbers[i],
+				Field:   field,
+				Message: fmt.Sprintf("a %s with %s %q already exists", label, strings.ToLower(field), values[i]),
+			})
+		}
+		if first, ok := firstRow[value]; ok {
+			warnings = append(warnings, database.RowWarning{
+				Row:     rowNumbers[i],
+				Field:   field,
+				Message: fmt.Sprintf("%s %q also appears on row %d", strings.ToLower(field), values[i], first),
+			})
+			continue
+		}
+		firstRow[value] = rowNumbers[i]
+	}
+	return warnings, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nlstn/my-crm/backend/database"
+	"github.com/nlstn/my-crm/backend/models"
+)
+
+func TestImportSpecParse(t *testing.T) {
+	spec := importSpec[models.Contact]{EntitySet: "Contacts", Label: "contact", Codec: database.ContactCSV}
+	partial := &database.Table{
+		Headers: []string{"ID", "Phone"},
+		Rows:    [][]string{{"7", "+49 30 123456"}},
+	}
+
+	t.Run("insert", func(t *testing.T) {
+		full := &database.Table{
+			Headers: []string{"AccountID", "FirstName", "LastName"},
+			Rows:    [][]string{{"1", "Ada", "Lovelace"}},
+		}
+		contacts, _, rowErrors, err := spec.parse(full, importOptions{Mode: importModeInsert})
+		if err != nil {
+			t.Fatalf("parse returned error: %v", err)
+		}
+		if len(rowErrors) > 0 {
+			t.Fatalf("parse returned row errors: %+v", rowErrors)
+		}
+		if len(contacts) != 1 || contacts[0].FirstName != "Ada" {
+			t.Fatalf("parse returned %+v, want the contact Ada", contacts)
+		}
+
+		// Inserted records need every required column
+		if _, _, rowErrors, err := spec.parse(partial, importOptions{Mode: importModeInsert}); err == nil && len(rowErrors) == 0 {
+			t.Errorf("parse accepted a file without the required columns")
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		contacts, _, rowErrors, err := spec.parse(partial, importOptions{Mode: importModeUpdate})
+		if err != nil {
+			t.Fatalf("parse returned error: %v", err)
+		}
+		if len(rowErrors) > 0 {
+			t.Fatalf("parse returned row errors: %+v", rowErrors)
+		}
+		if len(contacts) != 1 || contacts[0].ID != 7 || contacts[0].Phone != "+49 30 123456" {
+			t.Fatalf("parse returned %+v, want contact 7 with the new phone number", contacts)
+		}
+	})
+}
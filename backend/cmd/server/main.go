@@ -14,6 +14,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/nlstn/go-odata"
 	"github.com/nlstn/my-crm/backend/database"
+	"github.com/nlstn/my-crm/backend/duplicates"
 	"github.com/nlstn/my-crm/backend/models"
 	"github.com/nlstn/my-crm/backend/workflows"
 	"gorm.io/gorm"
@@ -35,6 +36,11 @@ func main() {
 		log.Fatal("Failed to run migrations:", err)
 	}
 
+	// Enable trigram matching for duplicate detection
+	if err := duplicates.Migrate(db); err != nil {
+		log.Fatal("Failed to prepare duplicate detection:", err)
+	}
+
 	// Seed database with sample data
 	if err := database.SeedData(db); err != nil {
 		log.Fatal("Failed to seed database:", err)
@@ -44,12 +50,16 @@ func main() {
 	service := odata.NewService(db)
 
 	// Initialize workflow automation engine
-	workflowEngine := workflows.NewEngine(db)
+	workflowEngine := workflows.NewEngine(db, workflows.ConfigFromEnv())
 	if err := workflowEngine.RegisterCallbacks(db); err != nil {
 		log.Fatal("Failed to register workflow callbacks:", err)
 	}
 	workflowEngine.Start()
 
+	// Initialize the scheduled duplicate scan
+	duplicateDetector := duplicates.NewDetector(db, duplicates.ConfigFromEnv())
+	duplicateDetector.Start()
+
 	// Set custom namespace
 	if err := service.SetNamespace("CRM"); err != nil {
 		log.Fatal("Failed to set namespace:", err)
@@ -57,44 +67,19 @@ func main() {
 
 	// Register enums for Issue Status and Priority
 	// NOTE: Starting at 1 to work around go-odata validation bug with zero values
-	if err := odata.RegisterEnumType(models.IssueStatus(1), map[string]int64{
-		"New":        1,
-		"InProgress": 2,
-		"Pending":    3,
-		"Resolved":   4,
-		"Closed":     5,
-	}); err != nil {
+	if err := odata.RegisterEnumType(models.IssueStatus(1), models.IssueStatus(1).EnumMembers()); err != nil {
 		log.Fatal("Failed to register IssueStatus enum:", err)
 	}
 
-	if err := odata.RegisterEnumType(models.IssuePriority(1), map[string]int64{
-		"Low":      1,
-		"Medium":   2,
-		"High":     3,
-		"Critical": 4,
-	}); err != nil {
+	if err := odata.RegisterEnumType(models.IssuePriority(1), models.IssuePriority(1).EnumMembers()); err != nil {
 		log.Fatal("Failed to register IssuePriority enum:", err)
 	}
 
-	if err := odata.RegisterEnumType(models.OpportunityStage(1), map[string]int64{
-		"Prospecting":   int64(models.OpportunityStageProspecting),
-		"Qualification": int64(models.OpportunityStageQualification),
-		"NeedsAnalysis": int64(models.OpportunityStageNeedsAnalysis),
-		"Proposal":      int64(models.OpportunityStageProposal),
-		"Negotiation":   int64(models.OpportunityStageNegotiation),
-		"ClosedWon":     int64(models.OpportunityStageClosedWon),
-		"ClosedLost":    int64(models.OpportunityStageClosedLost),
-	}); err != nil {
+	if err := odata.RegisterEnumType(models.OpportunityStage(1), models.OpportunityStage(1).EnumMembers()); err != nil {
 		log.Fatal("Failed to register OpportunityStage enum:", err)
 	}
 
-	if err := odata.RegisterEnumType(models.TaskStatus(1), map[string]int64{
-		"NotStarted": 1,
-		"InProgress": 2,
-		"Completed":  3,
-		"Deferred":   4,
-		"Cancelled":  5,
-	}); err != nil {
+	if err := odata.RegisterEnumType(models.TaskStatus(1), models.TaskStatus(1).EnumMembers()); err != nil {
 		log.Fatal("Failed to register TaskStatus enum:", err)
 	}
 
@@ -151,6 +136,10 @@ func main() {
 		log.Fatal("Failed to register OpportunityStageHistory entity:", err)
 	}
 
+	if err := service.RegisterEntity(&models.LeadStatusHistory{}); err != nil {
+		log.Fatal("Failed to register LeadStatusHistory entity:", err)
+	}
+
 	if err := service.RegisterEntity(&models.WorkflowRule{}); err != nil {
 		log.Fatal("Failed to register WorkflowRule entity:", err)
 	}
@@ -159,782 +148,207 @@ func main() {
 		log.Fatal("Failed to register WorkflowExecution entity:", err)
 	}
 
-	if err := registerBulkDataActions(service, db); err != nil {
-		log.Fatal("Failed to register bulk data actions:", err)
+	if err := service.RegisterEntity(&models.WorkflowRuleStatistic{}); err != nil {
+		log.Fatal("Failed to register WorkflowRuleStatistic entity:", err)
 	}
 
-	if err := registerLeadConversionAction(service, db); err != nil {
-		log.Fatal("Failed to register lead conversion action:", err)
+	if err := service.RegisterEntity(&models.WorkflowRetentionPolicy{}); err != nil {
+		log.Fatal("Failed to register WorkflowRetentionPolicy entity:", err)
 	}
 
-	if err := registerGlobalSearchFunction(service, db); err != nil {
-		log.Fatal("Failed to register global search function:", err)
+	if err := service.RegisterEntity(&models.AssignmentRule{}); err != nil {
+		log.Fatal("Failed to register AssignmentRule entity:", err)
 	}
 
-	// Register fake authentication action (DEVELOPMENT ONLY)
-	// TODO: Replace with proper authentication provider integration in production
-	if err := registerDevAuthAction(service, db); err != nil {
-		log.Fatal("Failed to register authentication action:", err)
+	if err := service.RegisterEntity(&models.ImportJob{}); err != nil {
+		log.Fatal("Failed to register ImportJob entity:", err)
 	}
 
-	// Create HTTP server with logging and CORS middleware
-	mux := http.NewServeMux()
-	mux.Handle("/", loggingMiddleware(corsMiddleware(service)))
-
-	// Health check endpoint
-	mux.HandleFunc("/health", loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"healthy"}`))
-	})).ServeHTTP)
-
-	// Start server
-	port := "8080"
-	fmt.Println("🚀 CRM Backend Server Starting...")
-	fmt.Println("========================================")
-	fmt.Println("Service Document:  http://localhost:" + port + "/")
-	fmt.Println("Metadata:          http://localhost:" + port + "/$metadata")
-	fmt.Println("Accounts:          http://localhost:" + port + "/Accounts")
-	fmt.Println("Contacts:          http://localhost:" + port + "/Contacts")
-	fmt.Println("Leads:             http://localhost:" + port + "/Leads")
-	fmt.Println("Issues:            http://localhost:" + port + "/Issues")
-	fmt.Println("Activities:        http://localhost:" + port + "/Activities")
-	fmt.Println("Tasks:             http://localhost:" + port + "/Tasks")
-	fmt.Println("Opportunities:     http://localhost:" + port + "/Opportunities")
-	fmt.Println("Opportunity Items: http://localhost:" + port + "/OpportunityLineItems")
-	fmt.Println("Stage History:     http://localhost:" + port + "/OpportunityStageHistory")
-	fmt.Println("Employees:         http://localhost:" + port + "/Employees")
-	fmt.Println("Products:          http://localhost:" + port + "/Products")
-	fmt.Println("========================================")
-	fmt.Println("All APIs are built using go-odata (OData v4 compliant)")
-	fmt.Println("Health Check:      http://localhost:" + port + "/health")
-	fmt.Println("")
-
-	log.Fatal(http.ListenAndServe(":"+port, mux))
-}
-
-// responseWriter wraps http.ResponseWriter to capture the status code
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
-	rw.ResponseWriter.WriteHeader(code)
-}
-
-// loggingMiddleware logs every request with its response code and time taken
-func loggingMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		// Wrap the ResponseWriter to capture the status code
-		wrapped := &responseWriter{
-			ResponseWriter: w,
-			statusCode:     http.StatusOK, // Default status code
-		}
-
-		// Call the next handler
-		next.ServeHTTP(wrapped, r)
-
-		// Calculate duration
-		duration := time.Since(start)
-
-		// Log the request
-		log.Printf("%s %s - %d - %v", r.Method, r.URL.Path, wrapped.statusCode, duration)
-	})
-}
-
-// corsMiddleware adds CORS headers to allow frontend access
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, OData-Version, Prefer")
-		w.Header().Set("Access-Control-Expose-Headers", "OData-Version, OData-EntityId")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
-func registerBulkDataActions(service *odata.Service, db *gorm.DB) error {
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:      "ImportAccountsCSV",
-		IsBound:   false,
-		EntitySet: "",
-		Parameters: []odata.ParameterDefinition{
-			{Name: "Csv", Type: reflect.TypeOf(""), Required: true},
-		},
-		ReturnType: reflect.TypeOf(map[string]interface{}{}),
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			csvPayload, ok := params["Csv"].(string)
-			if !ok || strings.TrimSpace(csvPayload) == "" {
-				return writeJSONError(w, http.StatusBadRequest, "Csv parameter is required")
-			}
-
-			accounts, _, validationErrors, err := database.ParseAccountsCSV(strings.NewReader(csvPayload))
-			if err != nil {
-				return writeJSONError(w, http.StatusBadRequest, err.Error())
-			}
-			if len(validationErrors) > 0 {
-				return writeValidationErrors(w, "One or more account rows could not be imported", validationErrors)
-			}
-			if len(accounts) == 0 {
-				return writeJSONError(w, http.StatusBadRequest, "No account rows were found in the CSV file")
-			}
-
-			if err := db.Create(&accounts).Error; err != nil {
-				return err
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"imported": len(accounts),
-			})
-		},
-	}); err != nil {
-		return err
+	if err := service.RegisterEntity(&models.ImportMapping{}); err != nil {
+		log.Fatal("Failed to register ImportMapping entity:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:       "ExportAccountsCSV",
-		IsBound:    false,
-		EntitySet:  "",
-		Parameters: nil,
-		ReturnType: nil,
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			var accounts []models.Account
-			if err := db.Order("id ASC").Find(&accounts).Error; err != nil {
-				return err
-			}
-
-			csvData, err := database.AccountsToCSV(accounts)
-			if err != nil {
-				return err
-			}
-
-			return writeCSVResponse(w, "accounts", csvData)
-		},
-	}); err != nil {
-		return err
+	if err := service.RegisterEntity(&models.ImportMappingColumn{}); err != nil {
+		log.Fatal("Failed to register ImportMappingColumn entity:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:      "ImportContactsCSV",
-		IsBound:   false,
-		EntitySet: "",
-		Parameters: []odata.ParameterDefinition{
-			{Name: "Csv", Type: reflect.TypeOf(""), Required: true},
-		},
-		ReturnType: reflect.TypeOf(map[string]interface{}{}),
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			csvPayload, ok := params["Csv"].(string)
-			if !ok || strings.TrimSpace(csvPayload) == "" {
-				return writeJSONError(w, http.StatusBadRequest, "Csv parameter is required")
-			}
-
-			contacts, contactRows, validationErrors, err := database.ParseContactsCSV(strings.NewReader(csvPayload))
-			if err != nil {
-				return writeJSONError(w, http.StatusBadRequest, err.Error())
-			}
-			dependencyErrors, depErr := validateContactDependencies(db, contacts, contactRows)
-			if depErr != nil {
-				return depErr
-			}
-
-			if len(validationErrors) > 0 || len(dependencyErrors) > 0 {
-				combined := append(validationErrors, dependencyErrors...)
-				return writeValidationErrors(w, "One or more contact rows could not be imported", combined)
-			}
-			if len(contacts) == 0 {
-				return writeJSONError(w, http.StatusBadRequest, "No contact rows were found in the CSV file")
-			}
-
-			if err := db.Create(&contacts).Error; err != nil {
-				return err
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"imported": len(contacts),
-			})
-		},
-	}); err != nil {
-		return err
+	if err := service.RegisterEntity(&models.ExternalReference{}); err != nil {
+		log.Fatal("Failed to register ExternalReference entity:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:       "ExportContactsCSV",
-		IsBound:    false,
-		EntitySet:  "",
-		Parameters: nil,
-		ReturnType: nil,
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			var contacts []models.Contact
-			if err := db.Order("id ASC").Find(&contacts).Error; err != nil {
-				return err
-			}
-
-			csvData, err := database.ContactsToCSV(contacts)
-			if err != nil {
-				return err
-			}
-
-			return writeCSVResponse(w, "contacts", csvData)
-		},
-	}); err != nil {
-		return err
+	if err := service.RegisterEntity(&models.DuplicateRule{}); err != nil {
+		log.Fatal("Failed to register DuplicateRule entity:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:      "ImportLeadsCSV",
-		IsBound:   false,
-		EntitySet: "",
-		Parameters: []odata.ParameterDefinition{
-			{Name: "Csv", Type: reflect.TypeOf(""), Required: true},
-		},
-		ReturnType: reflect.TypeOf(map[string]interface{}{}),
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			csvPayload, ok := params["Csv"].(string)
-			if !ok || strings.TrimSpace(csvPayload) == "" {
-				return writeJSONError(w, http.StatusBadRequest, "Csv parameter is required")
-			}
-
-			leads, _, validationErrors, err := database.ParseLeadsCSV(strings.NewReader(csvPayload))
-			if err != nil {
-				return writeJSONError(w, http.StatusBadRequest, err.Error())
-			}
-			if len(validationErrors) > 0 {
-				return writeValidationErrors(w, "One or more lead rows could not be imported", validationErrors)
-			}
-			if len(leads) == 0 {
-				return writeJSONError(w, http.StatusBadRequest, "No lead rows were found in the CSV file")
-			}
-
-			if err := db.Create(&leads).Error; err != nil {
-				return err
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"imported": len(leads),
-			})
-		},
-	}); err != nil {
-		return err
+	if err := service.RegisterEntity(&models.DuplicateCandidate{}); err != nil {
+		log.Fatal("Failed to register DuplicateCandidate entity:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:       "ExportLeadsCSV",
-		IsBound:    false,
-		EntitySet:  "",
-		Parameters: nil,
-		ReturnType: nil,
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			var leads []models.Lead
-			if err := db.Order("id ASC").Find(&leads).Error; err != nil {
-				return err
-			}
-
-			csvData, err := database.LeadsToCSV(leads)
-			if err != nil {
-				return err
-			}
-
-			return writeCSVResponse(w, "leads", csvData)
-		},
-	}); err != nil {
-		return err
+	if err := service.RegisterEntity(&models.AuditEntry{}); err != nil {
+		log.Fatal("Failed to register AuditEntry entity:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:      "ImportActivitiesCSV",
-		IsBound:   false,
-		EntitySet: "",
-		Parameters: []odata.ParameterDefinition{
-			{Name: "Csv", Type: reflect.TypeOf(""), Required: true},
-		},
-		ReturnType: reflect.TypeOf(map[string]interface{}{}),
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			csvPayload, ok := params["Csv"].(string)
-			if !ok || strings.TrimSpace(csvPayload) == "" {
-				return writeJSONError(w, http.StatusBadRequest, "Csv parameter is required")
-			}
-
-			activities, rowNumbers, validationErrors, err := database.ParseActivitiesCSV(strings.NewReader(csvPayload))
-			if err != nil {
-				return writeJSONError(w, http.StatusBadRequest, err.Error())
-			}
-
-			dependencyErrors, depErr := validateActivityDependencies(db, activities, rowNumbers)
-			if depErr != nil {
-				return depErr
-			}
-
-			if len(validationErrors) > 0 || len(dependencyErrors) > 0 {
-				combined := append(validationErrors, dependencyErrors...)
-				return writeValidationErrors(w, "One or more activity rows could not be imported", combined)
-			}
-
-			if len(activities) == 0 {
-				return writeJSONError(w, http.StatusBadRequest, "No activity rows were found in the CSV file")
-			}
-
-			if err := db.Create(&activities).Error; err != nil {
-				return err
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"imported": len(activities),
-			})
-		},
-	}); err != nil {
-		return err
+	if err := service.RegisterEntity(&models.LeadScoringRule{}); err != nil {
+		log.Fatal("Failed to register LeadScoringRule entity:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:       "ExportActivitiesCSV",
-		IsBound:    false,
-		EntitySet:  "",
-		Parameters: nil,
-		ReturnType: nil,
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			var activities []models.Activity
-			if err := db.Order("id ASC").Find(&activities).Error; err != nil {
-				return err
-			}
-
-			csvData, err := database.ActivitiesToCSV(activities)
-			if err != nil {
-				return err
-			}
-
-			return writeCSVResponse(w, "activities", csvData)
-		},
-	}); err != nil {
-		return err
+	if err := service.RegisterEntity(&models.WebForm{}); err != nil {
+		log.Fatal("Failed to register WebForm entity:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:      "ImportIssuesCSV",
-		IsBound:   false,
-		EntitySet: "",
-		Parameters: []odata.ParameterDefinition{
-			{Name: "Csv", Type: reflect.TypeOf(""), Required: true},
-		},
-		ReturnType: reflect.TypeOf(map[string]interface{}{}),
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			csvPayload, ok := params["Csv"].(string)
-			if !ok || strings.TrimSpace(csvPayload) == "" {
-				return writeJSONError(w, http.StatusBadRequest, "Csv parameter is required")
-			}
-
-			issues, rowNumbers, validationErrors, err := database.ParseIssuesCSV(strings.NewReader(csvPayload))
-			if err != nil {
-				return writeJSONError(w, http.StatusBadRequest, err.Error())
-			}
-
-			dependencyErrors, depErr := validateIssueDependencies(db, issues, rowNumbers)
-			if depErr != nil {
-				return depErr
-			}
-
-			if len(validationErrors) > 0 || len(dependencyErrors) > 0 {
-				combined := append(validationErrors, dependencyErrors...)
-				return writeValidationErrors(w, "One or more issue rows could not be imported", combined)
-			}
-
-			if len(issues) == 0 {
-				return writeJSONError(w, http.StatusBadRequest, "No issue rows were found in the CSV file")
-			}
-
-			if err := db.Create(&issues).Error; err != nil {
-				return err
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"imported": len(issues),
-			})
-		},
-	}); err != nil {
-		return err
+	if err := service.RegisterEntity(&models.WebFormField{}); err != nil {
+		log.Fatal("Failed to register WebFormField entity:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:       "ExportIssuesCSV",
-		IsBound:    false,
-		EntitySet:  "",
-		Parameters: nil,
-		ReturnType: nil,
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			var issues []models.Issue
-			if err := db.Order("id ASC").Find(&issues).Error; err != nil {
-				return err
-			}
-
-			csvData, err := database.IssuesToCSV(issues)
-			if err != nil {
-				return err
-			}
-
-			return writeCSVResponse(w, "issues", csvData)
-		},
-	}); err != nil {
-		return err
+	if err := registerBulkDataActions(service, db); err != nil {
+		log.Fatal("Failed to register bulk data actions:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:      "ImportTasksCSV",
-		IsBound:   false,
-		EntitySet: "",
-		Parameters: []odata.ParameterDefinition{
-			{Name: "Csv", Type: reflect.TypeOf(""), Required: true},
-		},
-		ReturnType: reflect.TypeOf(map[string]interface{}{}),
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			csvPayload, ok := params["Csv"].(string)
-			if !ok || strings.TrimSpace(csvPayload) == "" {
-				return writeJSONError(w, http.StatusBadRequest, "Csv parameter is required")
-			}
-
-			tasks, rowNumbers, validationErrors, err := database.ParseTasksCSV(strings.NewReader(csvPayload))
-			if err != nil {
-				return writeJSONError(w, http.StatusBadRequest, err.Error())
-			}
-
-			dependencyErrors, depErr := validateTaskDependencies(db, tasks, rowNumbers)
-			if depErr != nil {
-				return depErr
-			}
-
-			if len(validationErrors) > 0 || len(dependencyErrors) > 0 {
-				combined := append(validationErrors, dependencyErrors...)
-				return writeValidationErrors(w, "One or more task rows could not be imported", combined)
-			}
-
-			if len(tasks) == 0 {
-				return writeJSONError(w, http.StatusBadRequest, "No task rows were found in the CSV file")
-			}
-
-			if err := db.Create(&tasks).Error; err != nil {
-				return err
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"imported": len(tasks),
-			})
-		},
-	}); err != nil {
-		return err
+	if err := registerLeadConversionAction(service, db); err != nil {
+		log.Fatal("Failed to register lead conversion action:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:       "ExportTasksCSV",
-		IsBound:    false,
-		EntitySet:  "",
-		Parameters: nil,
-		ReturnType: nil,
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			var tasks []models.Task
-			if err := db.Order("id ASC").Find(&tasks).Error; err != nil {
-				return err
-			}
-
-			csvData, err := database.TasksToCSV(tasks)
-			if err != nil {
-				return err
-			}
-
-			return writeCSVResponse(w, "tasks", csvData)
-		},
-	}); err != nil {
-		return err
+	if err := registerConversionCandidatesFunction(service, db); err != nil {
+		log.Fatal("Failed to register conversion candidates function:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:      "ImportOpportunitiesCSV",
-		IsBound:   false,
-		EntitySet: "",
-		Parameters: []odata.ParameterDefinition{
-			{Name: "Csv", Type: reflect.TypeOf(""), Required: true},
-		},
-		ReturnType: reflect.TypeOf(map[string]interface{}{}),
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			csvPayload, ok := params["Csv"].(string)
-			if !ok || strings.TrimSpace(csvPayload) == "" {
-				return writeJSONError(w, http.StatusBadRequest, "Csv parameter is required")
-			}
-
-			opportunities, rowNumbers, validationErrors, err := database.ParseOpportunitiesCSV(strings.NewReader(csvPayload))
-			if err != nil {
-				return writeJSONError(w, http.StatusBadRequest, err.Error())
-			}
-
-			dependencyErrors, depErr := validateOpportunityDependencies(db, opportunities, rowNumbers)
-			if depErr != nil {
-				return depErr
-			}
-
-			if len(validationErrors) > 0 || len(dependencyErrors) > 0 {
-				combined := append(validationErrors, dependencyErrors...)
-				return writeValidationErrors(w, "One or more opportunity rows could not be imported", combined)
-			}
-
-			if len(opportunities) == 0 {
-				return writeJSONError(w, http.StatusBadRequest, "No opportunity rows were found in the CSV file")
-			}
-
-			if err := db.Create(&opportunities).Error; err != nil {
-				return err
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"imported": len(opportunities),
-			})
-		},
-	}); err != nil {
-		return err
+	if err := registerWorkflowRuleActions(service, workflowEngine); err != nil {
+		log.Fatal("Failed to register workflow rule actions:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:       "ExportOpportunitiesCSV",
-		IsBound:    false,
-		EntitySet:  "",
-		Parameters: nil,
-		ReturnType: nil,
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			var opportunities []models.Opportunity
-			if err := db.Order("id ASC").Find(&opportunities).Error; err != nil {
-				return err
-			}
-
-			csvData, err := database.OpportunitiesToCSV(opportunities)
-			if err != nil {
-				return err
-			}
-
-			return writeCSVResponse(w, "opportunities", csvData)
-		},
-	}); err != nil {
-		return err
+	if err := registerWorkflowCatalogFunction(service); err != nil {
+		log.Fatal("Failed to register workflow catalog function:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:      "ImportOpportunityLineItemsCSV",
-		IsBound:   false,
-		EntitySet: "",
-		Parameters: []odata.ParameterDefinition{
-			{Name: "Csv", Type: reflect.TypeOf(""), Required: true},
-		},
-		ReturnType: reflect.TypeOf(map[string]interface{}{}),
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			csvPayload, ok := params["Csv"].(string)
-			if !ok || strings.TrimSpace(csvPayload) == "" {
-				return writeJSONError(w, http.StatusBadRequest, "Csv parameter is required")
-			}
-
-			items, rowNumbers, validationErrors, err := database.ParseOpportunityLineItemsCSV(strings.NewReader(csvPayload))
-			if err != nil {
-				return writeJSONError(w, http.StatusBadRequest, err.Error())
-			}
-
-			dependencyErrors, depErr := validateOpportunityLineItemDependencies(db, items, rowNumbers)
-			if depErr != nil {
-				return depErr
-			}
-
-			if len(validationErrors) > 0 || len(dependencyErrors) > 0 {
-				combined := append(validationErrors, dependencyErrors...)
-				return writeValidationErrors(w, "One or more opportunity line item rows could not be imported", combined)
-			}
+	if err := registerWorkflowRetentionActions(service, workflowEngine); err != nil {
+		log.Fatal("Failed to register workflow retention actions:", err)
+	}
 
-			if len(items) == 0 {
-				return writeJSONError(w, http.StatusBadRequest, "No opportunity line item rows were found in the CSV file")
-			}
+	if err := registerGlobalSearchFunction(service, db); err != nil {
+		log.Fatal("Failed to register global search function:", err)
+	}
 
-			if err := db.Create(&items).Error; err != nil {
-				return err
-			}
+	if err := registerDuplicateActions(service, db, duplicateDetector); err != nil {
+		log.Fatal("Failed to register duplicate detection actions:", err)
+	}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"imported": len(items),
-			})
-		},
-	}); err != nil {
-		return err
+	if err := registerMergeActions(service, db); err != nil {
+		log.Fatal("Failed to register merge actions:", err)
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:       "ExportOpportunityLineItemsCSV",
-		IsBound:    false,
-		EntitySet:  "",
-		Parameters: nil,
-		ReturnType: nil,
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			var items []models.OpportunityLineItem
-			if err := db.Order("id ASC").Find(&items).Error; err != nil {
-				return err
-			}
+	// Register fake authentication action (DEVELOPMENT ONLY)
+	// TODO: Replace with proper authentication provider integration in production
+	if err := registerDevAuthAction(service, db); err != nil {
+		log.Fatal("Failed to register authentication action:", err)
+	}
 
-			csvData, err := database.OpportunityLineItemsToCSV(items)
-			if err != nil {
-				return err
-			}
+	// Create HTTP server with logging and CORS middleware
+	mux := http.NewServeMux()
+	mux.Handle("/", loggingMiddleware(corsMiddleware(duplicateWarningMiddleware(db, service))))
 
-			return writeCSVResponse(w, "opportunity-line-items", csvData)
-		},
-	}); err != nil {
-		return err
-	}
+	// Health check endpoint
+	mux.HandleFunc("/health", loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"healthy"}`))
+	})).ServeHTTP)
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:      "ImportEmployeesCSV",
-		IsBound:   false,
-		EntitySet: "",
-		Parameters: []odata.ParameterDefinition{
-			{Name: "Csv", Type: reflect.TypeOf(""), Required: true},
-		},
-		ReturnType: reflect.TypeOf(map[string]interface{}{}),
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			csvPayload, ok := params["Csv"].(string)
-			if !ok || strings.TrimSpace(csvPayload) == "" {
-				return writeJSONError(w, http.StatusBadRequest, "Csv parameter is required")
-			}
+	// Public web form submissions, which create leads without authentication
+	registerWebFormEndpoint(mux, db)
 
-			employees, _, validationErrors, err := database.ParseEmployeesCSV(strings.NewReader(csvPayload))
-			if err != nil {
-				return writeJSONError(w, http.StatusBadRequest, err.Error())
-			}
+	// Start server
+	port := "8080"
+	fmt.Println("🚀 CRM Backend Server Starting...")
+	fmt.Println("========================================")
+	fmt.Println("Service Document:  http://localhost:" + port + "/")
+	fmt.Println("Metadata:          http://localhost:" + port + "/$metadata")
+	fmt.Println("Accounts:          http://localhost:" + port + "/Accounts")
+	fmt.Println("Contacts:          http://localhost:" + port + "/Contacts")
+	fmt.Println("Leads:             http://localhost:" + port + "/Leads")
+	fmt.Println("Issues:            http://localhost:" + port + "/Issues")
+	fmt.Println("Activities:        http://localhost:" + port + "/Activities")
+	fmt.Println("Tasks:             http://localhost:" + port + "/Tasks")
+	fmt.Println("Opportunities:     http://localhost:" + port + "/Opportunities")
+	fmt.Println("Opportunity Items: http://localhost:" + port + "/OpportunityLineItems")
+	fmt.Println("Stage History:     http://localhost:" + port + "/OpportunityStageHistory")
+	fmt.Println("Employees:         http://localhost:" + port + "/Employees")
+	fmt.Println("Products:          http://localhost:" + port + "/Products")
+	fmt.Println("========================================")
+	fmt.Println("All APIs are built using go-odata (OData v4 compliant)")
+	fmt.Println("Health Check:      http://localhost:" + port + "/health")
+	fmt.Println("Web Forms:         http://localhost:" + port + "/forms/{key}")
+	fmt.Println("")
 
-			if len(validationErrors) > 0 {
-				return writeValidationErrors(w, "One or more employee rows could not be imported", validationErrors)
-			}
+	log.Fatal(http.ListenAndServe(":"+port, mux))
+}
 
-			if len(employees) == 0 {
-				return writeJSONError(w, http.StatusBadRequest, "No employee rows were found in the CSV file")
-			}
+// responseWriter wraps http.ResponseWriter to capture the status code
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
 
-			if err := db.Create(&employees).Error; err != nil {
-				return err
-			}
+func (rw *responseWriter) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"imported": len(employees),
-			})
-		},
-	}); err != nil {
-		return err
+// Flush lets streaming handlers such as CSV exports push buffered output to the client
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
 	}
+}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:       "ExportEmployeesCSV",
-		IsBound:    false,
-		EntitySet:  "",
-		Parameters: nil,
-		ReturnType: nil,
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			var employees []models.Employee
-			if err := db.Order("id ASC").Find(&employees).Error; err != nil {
-				return err
-			}
+// loggingMiddleware logs every request with its response code and time taken
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
 
-			csvData, err := database.EmployeesToCSV(employees)
-			if err != nil {
-				return err
-			}
+		// Wrap the ResponseWriter to capture the status code
+		wrapped := &responseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK, // Default status code
+		}
 
-			return writeCSVResponse(w, "employees", csvData)
-		},
-	}); err != nil {
-		return err
-	}
+		// Call the next handler
+		next.ServeHTTP(wrapped, r)
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:      "ImportProductsCSV",
-		IsBound:   false,
-		EntitySet: "",
-		Parameters: []odata.ParameterDefinition{
-			{Name: "Csv", Type: reflect.TypeOf(""), Required: true},
-		},
-		ReturnType: reflect.TypeOf(map[string]interface{}{}),
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			csvPayload, ok := params["Csv"].(string)
-			if !ok || strings.TrimSpace(csvPayload) == "" {
-				return writeJSONError(w, http.StatusBadRequest, "Csv parameter is required")
-			}
+		// Calculate duration
+		duration := time.Since(start)
 
-			products, _, validationErrors, err := database.ParseProductsCSV(strings.NewReader(csvPayload))
-			if err != nil {
-				return writeJSONError(w, http.StatusBadRequest, err.Error())
-			}
+		// Log the request
+		log.Printf("%s %s - %d - %v", r.Method, r.URL.Path, wrapped.statusCode, duration)
+	})
+}
 
-			if len(validationErrors) > 0 {
-				return writeValidationErrors(w, "One or more product rows could not be imported", validationErrors)
-			}
+// corsMiddleware adds CORS headers to allow frontend access
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, OData-Version, Prefer")
+		w.Header().Set("Access-Control-Expose-Headers", "OData-Version, OData-EntityId, "+duplicateWarningsHeader)
 
-			if len(products) == 0 {
-				return writeJSONError(w, http.StatusBadRequest, "No product rows were found in the CSV file")
-			}
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
 
-			if err := db.Create(&products).Error; err != nil {
-				return err
-			}
+		next.ServeHTTP(w, r)
+	})
+}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"imported": len(products),
-			})
-		},
-	}); err != nil {
+func registerBulkDataActions(service *odata.Service, db *gorm.DB) error {
+	if err := registerImportActions(service, db); err != nil {
 		return err
 	}
 
-	if err := service.RegisterAction(odata.ActionDefinition{
-		Name:       "ExportProductsCSV",
-		IsBound:    false,
-		EntitySet:  "",
-		Parameters: nil,
-		ReturnType: nil,
-		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
-			var products []models.Product
-			if err := db.Order("id ASC").Find(&products).Error; err != nil {
-				return err
-			}
-
-			csvData, err := database.ProductsToCSV(products)
-			if err != nil {
-				return err
-			}
-
-			return writeCSVResponse(w, "products", csvData)
-		},
-	}); err != nil {
+	if err := registerExportActions(service, db); err != nil {
 		return err
 	}
 
-	return nil
+	return registerBackupActions(service, db)
 }
 
 func writeValidationErrors(w http.ResponseWriter, message string, details []database.RowError) error {
@@ -947,16 +361,61 @@ func writeValidationErrors(w http.ResponseWriter, message string, details []data
 	})
 }
 
-func writeCSVResponse(w http.ResponseWriter, prefix string, data []byte) error {
-	filename := fmt.Sprintf("%s-%s.csv", prefix, time.Now().UTC().Format("20060102-150405"))
-	w.Header().Set("Content-Type", "text/csv")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	w.WriteHeader(http.StatusOK)
-	_, err := w.Write(data)
-	return err
+// validateAccountDependencies matches the tags named by each row to existing tags, ignoring case. Unknown tags
+// are rejected unless CreateMissingTags is set; then they keep no ID and are created when the account is saved.
+func validateAccountDependencies(db *gorm.DB, opts importOptions, _ *database.Table, accounts []models.Account, rowNumbers []int) ([]database.RowError, error) {
+	nameSet := make(map[string]struct{})
+	for _, account := range accounts {
+		for _, tag := range account.Tags {
+			nameSet[strings.ToLower(tag.Name)] = struct{}{}
+		}
+	}
+	if len(nameSet) == 0 {
+		return nil, nil
+	}
+
+	var tags []models.Tag
+	if err := db.Where("LOWER(name) IN ?", keysFromStringSet(nameSet)).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	existing := make(map[string]models.Tag, len(tags))
+	for _, tag := range tags {
+		existing[strings.ToLower(tag.Name)] = tag
+	}
+
+	var errors []database.RowError
+	for idx := range accounts {
+		for tagIdx := range accounts[idx].Tags {
+			tag := &accounts[idx].Tags[tagIdx]
+			if found, ok := existing[strings.ToLower(tag.Name)]; ok {
+				*tag = found
+				continue
+			}
+
+			var message string
+			switch {
+			case !opts.CreateMissingTags:
+				message = fmt.Sprintf("tag %q does not exist; set CreateMissingTags to create it", tag.Name)
+			case len(tag.Name) > 100:
+				message = fmt.Sprintf("tag %q is longer than 100 characters", tag.Name)
+			default:
+				continue
+			}
+			errors = append(errors, database.RowError{Row: rowNumbers[idx], Field: "Tags", Message: message})
+		}
+	}
+
+	return errors, nil
 }
 
-func validateContactDependencies(db *gorm.DB, contacts []models.Contact, rowNumbers []int) ([]database.RowError, error) {
+func validateContactDependencies(db *gorm.DB, _ importOptions, table *database.Table, contacts []models.Contact, rowNumbers []int) ([]database.RowError, error) {
+	errors, err := resolveRequiredReference(db, table, rowNumbers, accountNameReference, "AccountID",
+		func(idx int) *uint { return &contacts[idx].AccountID }, nil)
+	if err != nil {
+		return nil, err
+	}
+	unresolved := rowsWithErrors(errors)
+
 	accountIDSet := make(map[uint]struct{})
 	for _, contact := range contacts {
 		accountIDSet[contact.AccountID] = struct{}{}
@@ -967,8 +426,10 @@ func validateContactDependencies(db *gorm.DB, contacts []models.Contact, rowNumb
 		return nil, err
 	}
 
-	var errors []database.RowError
 	for idx, contact := range contacts {
+		if _, skip := unresolved[rowNumbers[idx]]; skip {
+			continue
+		}
 		if _, ok := existingAccounts[contact.AccountID]; !ok {
 			errors = append(errors, database.RowError{
 				Row:     rowNumbers[idx],
@@ -981,7 +442,13 @@ func validateContactDependencies(db *gorm.DB, contacts []models.Contact, rowNumb
 	return errors, nil
 }
 
-func validateActivityDependencies(db *gorm.DB, activities []models.Activity, rowNumbers []int) ([]database.RowError, error) {
+func validateActivityDependencies(db *gorm.DB, _ importOptions, table *database.Table, activities []models.Activity, rowNumbers []int) ([]database.RowError, error) {
+	errors, err := resolveActivityReferences(db, table, activities, rowNumbers)
+	if err != nil {
+		return nil, err
+	}
+	unresolved := rowsWithErrors(errors)
+
 	accountIDSet := make(map[uint]struct{})
 	leadIDSet := make(map[uint]struct{})
 	contactIDSet := make(map[uint]struct{})
@@ -1031,9 +498,11 @@ func validateActivityDependencies(db *gorm.DB, activities []models.Activity, row
 		return nil, err
 	}
 
-	var errors []database.RowError
 	for idx, activity := range activities {
 		row := rowNumbers[idx]
+		if _, skip := unresolved[row]; skip {
+			continue
+		}
 
 		if activity.AccountID != nil {
 			if _, ok := existingAccounts[*activity.AccountID]; !ok {
@@ -1079,7 +548,13 @@ func validateActivityDependencies(db *gorm.DB, activities []models.Activity, row
 	return errors, nil
 }
 
-func validateIssueDependencies(db *gorm.DB, issues []models.Issue, rowNumbers []int) ([]database.RowError, error) {
+func validateIssueDependencies(db *gorm.DB, _ importOptions, table *database.Table, issues []models.Issue, rowNumbers []int) ([]database.RowError, error) {
+	errors, err := resolveIssueReferences(db, table, issues, rowNumbers)
+	if err != nil {
+		return nil, err
+	}
+	unresolved := rowsWithErrors(errors)
+
 	accountIDSet := make(map[uint]struct{})
 	contactIDSet := make(map[uint]struct{})
 	employeeIDSet := make(map[uint]struct{})
@@ -1109,9 +584,11 @@ func validateIssueDependencies(db *gorm.DB, issues []models.Issue, rowNumbers []
 		return nil, err
 	}
 
-	var errors []database.RowError
 	for idx, issue := range issues {
 		row := rowNumbers[idx]
+		if _, skip := unresolved[row]; skip {
+			continue
+		}
 		if _, ok := existingAccounts[issue.AccountID]; !ok {
 			errors = append(errors, database.RowError{Row: row, Field: "AccountID", Message: fmt.Sprintf("account %d does not exist", issue.AccountID)})
 		}
@@ -1135,7 +612,13 @@ func validateIssueDependencies(db *gorm.DB, issues []models.Issue, rowNumbers []
 	return errors, nil
 }
 
-func validateTaskDependencies(db *gorm.DB, tasks []models.Task, rowNumbers []int) ([]database.RowError, error) {
+func validateTaskDependencies(db *gorm.DB, _ importOptions, table *database.Table, tasks []models.Task, rowNumbers []int) ([]database.RowError, error) {
+	errors, err := resolveTaskReferences(db, table, tasks, rowNumbers)
+	if err != nil {
+		return nil, err
+	}
+	unresolved := rowsWithErrors(errors)
+
 	accountIDSet := make(map[uint]struct{})
 	leadIDSet := make(map[uint]struct{})
 	contactIDSet := make(map[uint]struct{})
@@ -1185,9 +668,11 @@ func validateTaskDependencies(db *gorm.DB, tasks []models.Task, rowNumbers []int
 		return nil, err
 	}
 
-	var errors []database.RowError
 	for idx, task := range tasks {
 		row := rowNumbers[idx]
+		if _, skip := unresolved[row]; skip {
+			continue
+		}
 
 		if task.AccountID != nil {
 			if _, ok := existingAccounts[*task.AccountID]; !ok {
@@ -1233,7 +718,13 @@ func validateTaskDependencies(db *gorm.DB, tasks []models.Task, rowNumbers []int
 	return errors, nil
 }
 
-func validateOpportunityDependencies(db *gorm.DB, opportunities []models.Opportunity, rowNumbers []int) ([]database.RowError, error) {
+func validateOpportunityDependencies(db *gorm.DB, _ importOptions, table *database.Table, opportunities []models.Opportunity, rowNumbers []int) ([]database.RowError, error) {
+	errors, err := resolveOpportunityReferences(db, table, opportunities, rowNumbers)
+	if err != nil {
+		return nil, err
+	}
+	unresolved := rowsWithErrors(errors)
+
 	accountIDSet := make(map[uint]struct{})
 	contactIDSet := make(map[uint]struct{})
 	ownerIDSet := make(map[uint]struct{})
@@ -1268,9 +759,11 @@ func validateOpportunityDependencies(db *gorm.DB, opportunities []models.Opportu
 		return nil, err
 	}
 
-	var errors []database.RowError
 	for idx, opportunity := range opportunities {
 		row := rowNumbers[idx]
+		if _, skip := unresolved[row]; skip {
+			continue
+		}
 		if _, ok := existingAccounts[opportunity.AccountID]; !ok {
 			errors = append(errors, database.RowError{Row: row, Field: "AccountID", Message: fmt.Sprintf("account %d does not exist", opportunity.AccountID)})
 		}
@@ -1300,7 +793,14 @@ func validateOpportunityDependencies(db *gorm.DB, opportunities []models.Opportu
 	return errors, nil
 }
 
-func validateOpportunityLineItemDependencies(db *gorm.DB, items []models.OpportunityLineItem, rowNumbers []int) ([]database.RowError, error) {
+func validateOpportunityLineItemDependencies(db *gorm.DB, _ importOptions, table *database.Table, items []models.OpportunityLineItem, rowNumbers []int) ([]database.RowError, error) {
+	errors, err := resolveRequiredReference(db, table, rowNumbers, productSKUReference, "ProductID",
+		func(idx int) *uint { return &items[idx].ProductID }, nil)
+	if err != nil {
+		return nil, err
+	}
+	unresolved := rowsWithErrors(errors)
+
 	opportunityIDSet := make(map[uint]struct{})
 	productIDSet := make(map[uint]struct{})
 
@@ -1319,9 +819,11 @@ func validateOpportunityLineItemDependencies(db *gorm.DB, items []models.Opportu
 		return nil, err
 	}
 
-	var errors []database.RowError
 	for idx, item := range items {
 		row := rowNumbers[idx]
+		if _, skip := unresolved[row]; skip {
+			continue
+		}
 		if _, ok := existingOpportunities[item.OpportunityID]; !ok {
 			errors = append(errors, database.RowError{Row: row, Field: "OpportunityID", Message: fmt.Sprintf("opportunity %d does not exist", item.OpportunityID)})
 		}
@@ -1333,6 +835,43 @@ func validateOpportunityLineItemDependencies(db *gorm.DB, items []models.Opportu
 	return errors, nil
 }
 
+func validateIssueUpdateDependencies(db *gorm.DB, _ importOptions, _ *database.Table, updates []models.IssueUpdate, rowNumbers []int) ([]database.RowError, error) {
+	issueIDSet := make(map[uint]struct{})
+	employeeIDSet := make(map[uint]struct{})
+
+	for _, update := range updates {
+		issueIDSet[update.IssueID] = struct{}{}
+		if update.EmployeeID != nil {
+			employeeIDSet[*update.EmployeeID] = struct{}{}
+		}
+	}
+
+	existingIssues, err := fetchExistingIDs(db, &models.Issue{}, keysFromSet(issueIDSet))
+	if err != nil {
+		return nil, err
+	}
+
+	existingEmployees, err := fetchExistingIDs(db, &models.Employee{}, keysFromSet(employeeIDSet))
+	if err != nil {
+		return nil, err
+	}
+
+	var errors []database.RowError
+	for idx, update := range updates {
+		row := rowNumbers[idx]
+		if _, ok := existingIssues[update.IssueID]; !ok {
+			errors = append(errors, database.RowError{Row: row, Field: "IssueID", Message: fmt.Sprintf("issue %d does not exist", update.IssueID)})
+		}
+		if update.EmployeeID != nil {
+			if _, ok := existingEmployees[*update.EmployeeID]; !ok {
+				errors = append(errors, database.RowError{Row: row, Field: "EmployeeID", Message: fmt.Sprintf("employee %d does not exist", *update.EmployeeID)})
+			}
+		}
+	}
+
+	return errors, nil
+}
+
 func fetchExistingIDs(db *gorm.DB, model interface{}, ids []uint) (map[uint]struct{}, error) {
 	result := make(map[uint]struct{})
 	if len(ids) == 0 {
@@ -1425,6 +964,13 @@ func registerLeadConversionAction(service *odata.Service, db *gorm.DB) error {
 			{Name: "AccountName", Type: reflect.TypeOf(""), Required: false},
 			{Name: "ExistingAccountID", Type: reflect.TypeOf(uint(0)), Required: false},
 			{Name: "ExistingContactID", Type: reflect.TypeOf(uint(0)), Required: false},
+			{Name: "OnDuplicate", Type: reflect.TypeOf(""), Required: false},
+			{Name: "CreateOpportunity", Type: reflect.TypeOf(false), Required: false},
+			{Name: "OpportunityName", Type: reflect.TypeOf(""), Required: false},
+			{Name: "OpportunityAmount", Type: reflect.TypeOf(float64(0)), Required: false},
+			{Name: "ExpectedCloseDate", Type: reflect.TypeOf(""), Required: false},
+			{Name: "OpportunityStage", Type: reflect.TypeOf(""), Required: false},
+			{Name: "MigrateHistory", Type: reflect.TypeOf(false), Required: false},
 		},
 		ReturnType: reflect.TypeOf(map[string]interface{}{}),
 		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
@@ -1453,6 +999,10 @@ func registerLeadConversionAction(service *odata.Service, db *gorm.DB) error {
 				})
 			}
 
+			if currentLead.Status == models.LeadStatusDisqualified {
+				return writeJSONError(w, http.StatusBadRequest, "Disqualified leads must be reopened before they can be converted")
+			}
+
 			var existingAccountID *uint
 			if rawAccountID, ok := params["ExistingAccountID"]; ok {
 				parsedID, err := parseUintParam(rawAccountID)
@@ -1471,14 +1021,82 @@ func registerLeadConversionAction(service *odata.Service, db *gorm.DB) error {
 				existingContactID = &parsedID
 			}
 
-			accountName := strings.TrimSpace(currentLead.Company)
-			if overrideName, ok := params["AccountName"].(string); ok {
-				if trimmed := strings.TrimSpace(overrideName); trimmed != "" {
-					accountName = trimmed
+			onDuplicate := conversionCreate
+			if rawOnDuplicate, ok := params["OnDuplicate"].(string); ok && strings.TrimSpace(rawOnDuplicate) != "" {
+				onDuplicate = strings.TrimSpace(rawOnDuplicate)
+				if onDuplicate != conversionCreate && onDuplicate != conversionFail && onDuplicate != conversionLink {
+					return writeJSONError(w, http.StatusBadRequest, "OnDuplicate must be Create, Fail or Link")
+				}
+			}
+
+			overrideName, _ := params["AccountName"].(string)
+			accountName := conversionAccountName(&currentLead, overrideName)
+
+			var opportunity *models.Opportunity
+			if createOpportunity, _ := params["CreateOpportunity"].(bool); createOpportunity {
+				opportunity = &models.Opportunity{
+					Name:            accountName,
+					OwnerEmployeeID: currentLead.OwnerEmployeeID,
+					Stage:           models.OpportunityStageProspecting,
+					Description:     currentLead.Notes,
+				}
+				if name, ok := params["OpportunityName"].(string); ok && strings.TrimSpace(name) != "" {
+					opportunity.Name = strings.TrimSpace(name)
+				}
+				if amount, ok := params["OpportunityAmount"].(float64); ok {
+					if amount < 0 {
+						return writeJSONError(w, http.StatusBadRequest, "OpportunityAmount must not be negative")
+					}
+					opportunity.Amount = amount
+				}
+				if rawDate, ok := params["ExpectedCloseDate"].(string); ok && strings.TrimSpace(rawDate) != "" {
+					closeDate, err := parseConversionDate(strings.TrimSpace(rawDate))
+					if err != nil {
+						return writeJSONError(w, http.StatusBadRequest, "ExpectedCloseDate must be a date such as 2024-06-30")
+					}
+					opportunity.ExpectedCloseDate = &closeDate
+				}
+				if rawStage, ok := params["OpportunityStage"].(string); ok && strings.TrimSpace(rawStage) != "" {
+					stage, ok := openOpportunityStage(strings.TrimSpace(rawStage))
+					if !ok {
+						return writeJSONError(w, http.StatusBadRequest, "OpportunityStage must be Prospecting, Qualification, NeedsAnalysis, Proposal or Negotiation")
+					}
+					opportunity.Stage = stage
 				}
 			}
-			if accountName == "" {
-				accountName = currentLead.Name
+			migrateHistory, _ := params["MigrateHistory"].(bool)
+
+			// Strong matches only matter for the account and contact the conversion would otherwise create
+			if onDuplicate != conversionCreate && existingContactID == nil {
+				candidates, err := findConversionCandidates(db.WithContext(r.Context()), &currentLead, accountName)
+				if err != nil {
+					return err
+				}
+
+				var matchedAccount *conversionCandidate
+				contactAccountID := uint(0)
+				if existingAccountID != nil {
+					contactAccountID = *existingAccountID
+				} else if matchedAccount = candidates.strongAccount(); matchedAccount != nil {
+					contactAccountID = matchedAccount.ID
+				}
+				matchedContact := candidates.strongContact(contactAccountID)
+
+				if onDuplicate == conversionFail && (matchedAccount != nil || matchedContact != nil) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusConflict)
+					return json.NewEncoder(w).Encode(map[string]interface{}{
+						"error":    "Lead matches an existing account or contact",
+						"Accounts": candidates.Accounts,
+						"Contacts": candidates.Contacts,
+					})
+				}
+				if matchedAccount != nil {
+					existingAccountID = &matchedAccount.ID
+				}
+				if matchedContact != nil {
+					existingContactID = &matchedContact.ID
+				}
 			}
 
 			firstName, lastName := splitLeadName(currentLead.Name)
@@ -1487,6 +1105,7 @@ func registerLeadConversionAction(service *odata.Service, db *gorm.DB) error {
 			var contact models.Contact
 			var reusedAccount bool
 			var reusedContact bool
+			var activitiesMoved, tasksMoved int64
 
 			var (
 				errAccountNotFound        = errors.New("existing account not found")
@@ -1558,14 +1177,29 @@ func registerLeadConversionAction(service *odata.Service, db *gorm.DB) error {
 					}
 				}
 
+				if opportunity != nil {
+					opportunity.AccountID = account.ID
+					opportunity.ContactID = &contact.ID
+					if err := tx.Create(opportunity).Error; err != nil {
+						return err
+					}
+				}
+
+				if migrateHistory {
+					var err error
+					activitiesMoved, tasksMoved, err = migrateLeadHistory(tx, currentLead.ID, account.ID, contact.ID, opportunity)
+					if err != nil {
+						return err
+					}
+				}
+
 				now := time.Now().UTC()
 				currentLead.Status = models.LeadStatusConverted
 				currentLead.ConvertedAt = &now
 				currentLead.ConvertedAccountID = &account.ID
 				currentLead.ConvertedContactID = &contact.ID
 
-				if err := tx.Model(&models.Lead{}).
-					Where("id = ?", currentLead.ID).
+				if err := models.ForLeadConversion(tx).Model(&currentLead).
 					Updates(map[string]interface{}{
 						"status":               currentLead.Status,
 						"converted_at":         currentLead.ConvertedAt,
@@ -1590,14 +1224,22 @@ func registerLeadConversionAction(service *odata.Service, db *gorm.DB) error {
 				}
 			}
 
+			var opportunityID *uint
+			if opportunity != nil {
+				opportunityID = &opportunity.ID
+			}
+
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			return json.NewEncoder(w).Encode(map[string]interface{}{
-				"LeadID":        currentLead.ID,
-				"AccountID":     account.ID,
-				"ContactID":     contact.ID,
-				"AccountReused": reusedAccount,
-				"ContactReused": reusedContact,
+				"LeadID":          currentLead.ID,
+				"AccountID":       account.ID,
+				"ContactID":       contact.ID,
+				"OpportunityID":   opportunityID,
+				"AccountReused":   reusedAccount,
+				"ContactReused":   reusedContact,
+				"ActivitiesMoved": activitiesMoved,
+				"TasksMoved":      tasksMoved,
 			})
 		},
 	})
@@ -1702,6 +1344,68 @@ func registerGlobalSearchFunction(service *odata.Service, db *gorm.DB) error {
 	})
 }
 
+// conversionAccountName returns the name of the account created when converting a lead: the override if given,
+// else the lead's company, else the lead's name.
+func conversionAccountName(lead *models.Lead, override string) string {
+	if trimmed := strings.TrimSpace(override); trimmed != "" {
+		return trimmed
+	}
+	if company := strings.TrimSpace(lead.Company); company != "" {
+		return company
+	}
+	return lead.Name
+}
+
+// migrateLeadHistory links the activities and open tasks of a converted lead to its account, contact and
+// opportunity, if one was created. Records already linked to an account are left alone. The records keep their
+// LeadID, so they still show up on the lead.
+func migrateLeadHistory(tx *gorm.DB, leadID, accountID, contactID uint, opportunity *models.Opportunity) (int64, int64, error) {
+	updates := map[string]interface{}{
+		"account_id": accountID,
+		"contact_id": contactID,
+		"updated_at": time.Now().UTC(),
+	}
+	if opportunity != nil {
+		updates["opportunity_id"] = opportunity.ID
+	}
+
+	// The records are moved with plain statements, their hooks would reject the empty models GORM updates through
+	activities := tx.Table(models.Activity{}.TableName()).
+		Where("lead_id = ? AND account_id IS NULL", leadID).
+		Updates(updates)
+	if activities.Error != nil {
+		return 0, 0, activities.Error
+	}
+
+	tasks := tx.Table(models.Task{}.TableName()).
+		Where("lead_id = ? AND account_id IS NULL AND status IN ?", leadID,
+			[]models.TaskStatus{models.TaskStatusNotStarted, models.TaskStatusInProgress, models.TaskStatusDeferred}).
+		Updates(updates)
+	if tasks.Error != nil {
+		return 0, 0, tasks.Error
+	}
+
+	return activities.RowsAffected, tasks.RowsAffected, nil
+}
+
+// openOpportunityStage parses the name of an opportunity stage that is not closed.
+func openOpportunityStage(name string) (models.OpportunityStage, bool) {
+	value, ok := models.OpportunityStage(0).EnumMembers()[name]
+	stage := models.OpportunityStage(value)
+	if !ok || stage == models.OpportunityStageClosedWon || stage == models.OpportunityStageClosedLost {
+		return 0, false
+	}
+	return stage, true
+}
+
+// parseConversionDate parses a date such as 2024-06-30 or an RFC 3339 timestamp.
+func parseConversionDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 func splitLeadName(fullName string) (string, string) {
 	trimmed := strings.TrimSpace(fullName)
 	if trimmed == "" {
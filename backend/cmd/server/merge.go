@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/nlstn/go-odata"
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+// mergeReference is a column of another table that refers to the records of a mergeable entity set.
+type mergeReference struct {
+	Table  string
+	Column string
+}
+
+// mergeEntitySet is an entity set whose duplicates can be merged with MergeInto.
+type mergeEntitySet struct {
+	EntitySet  string
+	EntityType string
+	// Fields are the fields the caller may take from the merged record instead of the target.
+	Fields []string
+	// References are re-pointed from the merged record to the target before the merged record is deleted.
+	References []mergeReference
+	New        func() interface{}
+	// Validate rejects merges the references cannot follow.
+	Validate func(source, target interface{}) error
+	// Merge moves what References cannot, such as join table rows, and returns how many rows it moved by table.
+	Merge func(tx *gorm.DB, sourceID, targetID uint) (map[string]int64, error)
+}
+
+var (
+	errMergeTargetNotFound = errors.New("merge target not found")
+	errMergeSameRecord     = errors.New("a record cannot be merged into itself")
+	errMergeContactAccount = errors.New("contacts of different accounts cannot be merged")
+)
+
+var mergeEntitySets = []mergeEntitySet{
+	{
+		EntitySet:  "Accounts",
+		EntityType: "Account",
+		Fields: []string{"Name", "Industry", "Website", "Phone", "Email", "Address", "City", "State", "Country",
+			"PostalCode", "Description", "EmployeeID", "LifecycleStage"},
+		References: []mergeReference{
+			{Table: "contacts", Column: "account_id"},
+			{Table: "issues", Column: "account_id"},
+			{Table: "activities", Column: "account_id"},
+			{Table: "tasks", Column: "account_id"},
+			{Table: "opportunities", Column: "account_id"},
+			{Table: "leads", Column: "converted_account_id"},
+		},
+		New:   func() interface{} { return &models.Account{} },
+		Merge: mergeAccountTags,
+	},
+	{
+		EntitySet:  "Contacts",
+		EntityType: "Contact",
+		Fields:     []string{"FirstName", "LastName", "Title", "Email", "Phone", "Mobile", "IsPrimary", "Notes"},
+		References: []mergeReference{
+			{Table: "issues", Column: "contact_id"},
+			{Table: "activities", Column: "contact_id"},
+			{Table: "tasks", Column: "contact_id"},
+			{Table: "opportunities", Column: "contact_id"},
+			{Table: "leads", Column: "converted_contact_id"},
+		},
+		New: func() interface{} { return &models.Contact{} },
+		// Records of a contact must belong to its account, so moving them to a contact of another account would
+		// leave them inconsistent
+		Validate: func(source, target interface{}) error {
+			if source.(*models.Contact).AccountID != target.(*models.Contact).AccountID {
+				return errMergeContactAccount
+			}
+			return nil
+		},
+	},
+}
+
+// registerMergeActions registers the MergeInto action of every entity set whose duplicates can be merged.
+func registerMergeActions(service *odata.Service, db *gorm.DB) error {
+	for _, set := range mergeEntitySets {
+		set := set
+		// MergeInto merges the bound record into the record given by TargetID and deletes it. The target keeps its
+		// own field values except for the fields listed in SourceFields, which are taken from the merged record.
+		if err := service.RegisterAction(odata.ActionDefinition{
+			Name:      "MergeInto",
+			IsBound:   true,
+			EntitySet: set.EntitySet,
+			Parameters: []odata.ParameterDefinition{
+				{Name: "TargetID", Type: reflect.TypeOf(uint(0)), Required: true},
+				{Name: "SourceFields", Type: reflect.TypeOf([]string{}), Required: false},
+			},
+			ReturnType: reflect.TypeOf(map[string]interface{}{}),
+			Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+				sourceID, ok := recordID(ctx)
+				if !ok {
+					return fmt.Errorf("invalid %s context for merge", strings.ToLower(set.EntityType))
+				}
+
+				targetID, err := parseUintParam(params["TargetID"])
+				if err != nil {
+					return writeJSONError(w, http.StatusBadRequest, "Invalid TargetID provided")
+				}
+
+				sourceFields, _ := params["SourceFields"].([]string)
+				for _, field := range sourceFields {
+					if !containsField(set.Fields, field) {
+						return writeJSONError(w, http.StatusBadRequest,
+							fmt.Sprintf("SourceFields contains %q, which is not one of %s", field, strings.Join(set.Fields, ", ")))
+					}
+				}
+
+				result, err := mergeRecords(db.WithContext(r.Context()), set, sourceID, targetID, sourceFields)
+				if err != nil {
+					switch {
+					case errors.Is(err, gorm.ErrRecordNotFound):
+						return writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s %d could not be found", set.EntityType, sourceID))
+					case errors.Is(err, errMergeTargetNotFound):
+						return writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s %d could not be found", set.EntityType, targetID))
+					case errors.Is(err, errMergeSameRecord):
+						return writeJSONError(w, http.StatusBadRequest, "TargetID must differ from the merged record")
+					case errors.Is(err, errMergeContactAccount):
+						return writeJSONError(w, http.StatusBadRequest, "Contacts of different accounts cannot be merged, merge the accounts first")
+					default:
+						return err
+					}
+				}
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				return json.NewEncoder(w).Encode(result)
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeRecords merges the record sourceID into targetID in one transaction: it copies sourceFields to the target,
+// re-points every reference to the source, marks their duplicate candidate as merged, records the merge in the
+// audit trail and deletes the source.
+func mergeRecords(db *gorm.DB, set mergeEntitySet, sourceID, targetID uint, sourceFields []string) (map[string]interface{}, error) {
+	if sourceID == targetID {
+		return nil, errMergeSameRecord
+	}
+
+	var result map[string]interface{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		source := set.New()
+		if err := tx.First(source, sourceID).Error; err != nil {
+			return err
+		}
+		target := set.New()
+		if err := tx.First(target, targetID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errMergeTargetNotFound
+			}
+			return err
+		}
+		if set.Validate != nil {
+			if err := set.Validate(source, target); err != nil {
+				return err
+			}
+		}
+
+		if len(sourceFields) > 0 {
+			sourceValue := reflect.ValueOf(source).Elem()
+			targetValue := reflect.ValueOf(target).Elem()
+			for _, field := range sourceFields {
+				targetValue.FieldByName(field).Set(sourceValue.FieldByName(field))
+			}
+			if err := tx.Model(target).Select(sourceFields).Updates(target).Error; err != nil {
+				return err
+			}
+		}
+
+		// References are moved with plain statements, the child records themselves do not change
+		moved := make(map[string]int64)
+		for _, reference := range set.References {
+			update := tx.Table(reference.Table).Where(reference.Column+" = ?", sourceID).Update(reference.Column, targetID)
+			if update.Error != nil {
+				return update.Error
+			}
+			if update.RowsAffected > 0 {
+				moved[reference.Table] += update.RowsAffected
+			}
+		}
+		if set.Merge != nil {
+			extra, err := set.Merge(tx, sourceID, targetID)
+			if err != nil {
+				return err
+			}
+			for table, count := range extra {
+				moved[table] += count
+			}
+		}
+
+		update := tx.Table(models.ExternalReference{}.TableName()).Where("entity_set = ? AND entity_id = ?", set.EntitySet, sourceID).
+			Update("entity_id", targetID)
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected > 0 {
+			moved["external_references"] = update.RowsAffected
+		}
+
+		if err := resolveMergedCandidates(tx, set.EntityType, sourceID, targetID); err != nil {
+			return err
+		}
+
+		details, err := json.Marshal(map[string]interface{}{
+			"Merged":       source,
+			"SourceFields": sourceFields,
+			"Moved":        moved,
+		})
+		if err != nil {
+			return err
+		}
+		entry := models.AuditEntry{
+			EntityType: set.EntityType,
+			EntityID:   targetID,
+			Action:     models.AuditActionMerge,
+			RelatedID:  &sourceID,
+			Summary:    fmt.Sprintf("Merged %s %d %q", strings.ToLower(set.EntityType), sourceID, recordName(source)),
+			Details:    string(details),
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(source).Error; err != nil {
+			return err
+		}
+
+		result = map[string]interface{}{
+			"TargetID":     targetID,
+			"MergedID":     sourceID,
+			"Moved":        moved,
+			"AuditEntryID": entry.ID,
+		}
+		return nil
+	})
+	return result, err
+}
+
+// mergeAccountTags gives the target account the tags of the merged account it does not have yet.
+func mergeAccountTags(tx *gorm.DB, sourceID, targetID uint) (map[string]int64, error) {
+	insert := tx.Exec(`INSERT INTO account_tags (account_id, tag_id, created_at)
+		SELECT ?, tag_id, created_at FROM account_tags WHERE account_id = ?
+		ON CONFLICT DO NOTHING`, targetID, sourceID)
+	if insert.Error != nil {
+		return nil, insert.Error
+	}
+	if err := tx.Where("account_id = ?", sourceID).Delete(&models.AccountTag{}).Error; err != nil {
+		return nil, err
+	}
+	return map[string]int64{"account_tags": insert.RowsAffected}, nil
+}
+
+// resolveMergedCandidates marks the duplicate candidate of a merged pair as merged and removes the other candidates
+// of the merged record, which no longer exists.
+func resolveMergedCandidates(tx *gorm.DB, entityType string, sourceID, targetID uint) error {
+	// Scans store each pair with the lower ID first
+	recordID, duplicateID := sourceID, targetID
+	if recordID > duplicateID {
+		recordID, duplicateID = duplicateID, recordID
+	}
+
+	var candidate models.DuplicateCandidate
+	err := tx.Where("entity_type = ? AND record_id = ? AND duplicate_id = ?", entityType, recordID, duplicateID).Take(&candidate).Error
+	switch {
+	case err == nil:
+		if err := tx.Model(&candidate).Updates(map[string]interface{}{"status": models.DuplicateCandidateMerged}).Error; err != nil {
+			return err
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	return tx.Where("entity_type = ? AND (record_id = ? OR duplicate_id = ?) AND id <> ?", entityType, sourceID, sourceID, candidate.ID).
+		Delete(&models.DuplicateCandidate{}).Error
+}
+
+// recordID returns the ID of the record bound to an action.
+func recordID(ctx interface{}) (uint, bool) {
+	switch record := ctx.(type) {
+	case *models.Account:
+		if record != nil {
+			return record.ID, true
+		}
+	case *models.Contact:
+		if record != nil {
+			return record.ID, true
+		}
+	}
+	return 0, false
+}
+
+// recordName returns the display name of an account or contact.
+func recordName(record interface{}) string {
+	switch value := record.(type) {
+	case *models.Account:
+		return value.Name
+	case *models.Contact:
+		return strings.TrimSpace(value.FirstName + " " + value.LastName)
+	}
+	return ""
+}
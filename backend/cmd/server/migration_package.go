@@ -0,0 +1,402 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/nlstn/go-odata"
+	"github.com/nlstn/my-crm/backend/database"
+	"github.com/nlstn/my-crm/backend/models"
+	"github.com/nlstn/my-crm/backend/workflows"
+	"gorm.io/gorm"
+)
+
+// migrationPackageOrder lists the entity sets a migration package may contain, in the order they are imported
+// so every file can refer to records from the files before it.
+var migrationPackageOrder = []string{
+	"Accounts", "Contacts", "Leads", "Opportunities", "OpportunityLineItems", "Tasks", "Activities",
+}
+
+// migrationPackageMaxFileSize limits the uncompressed size of each file in a migration package.
+const migrationPackageMaxFileSize = 64 << 20
+
+// defaultSourceSystem names the source system of packages imported without a SourceSystem.
+const defaultSourceSystem = "default"
+
+// externalReferenceColumns are the columns that refer to a record by the ID it had in the source system.
+// Each fills the ID column of the same name without "External", for example AccountExternalID fills AccountID.
+var externalReferenceColumns = []struct {
+	Column    string
+	EntitySet string
+	Field     string
+	Label     string
+}{
+	{Column: "AccountExternalID", EntitySet: "Accounts", Field: "AccountID", Label: "account"},
+	{Column: "ContactExternalID", EntitySet: "Contacts", Field: "ContactID", Label: "contact"},
+	{Column: "LeadExternalID", EntitySet: "Leads", Field: "LeadID", Label: "lead"},
+	{Column: "OpportunityExternalID", EntitySet: "Opportunities", Field: "OpportunityID", Label: "opportunity"},
+}
+
+// migrationFile is a CSV file of a migration package.
+type migrationFile struct {
+	Name  string
+	Table *database.Table
+}
+
+// registerMigrationPackageAction registers ImportMigrationPackage, which imports a ZIP archive holding one CSV file
+// per entity set in dependency order and in a single transaction. Rows carry the ID they had in the source system in
+// an ExternalID column, and refer to each other through columns such as AccountExternalID, so records can be linked
+// across files before their new IDs are known.
+func registerMigrationPackageAction(service *odata.Service, db *gorm.DB, kinds importKinds) error {
+	return service.RegisterAction(odata.ActionDefinition{
+		Name:      "ImportMigrationPackage",
+		IsBound:   false,
+		EntitySet: "",
+		Parameters: []odata.ParameterDefinition{
+			{Name: "Zip", Type: reflect.TypeOf(""), Required: true},
+			{Name: "SourceSystem", Type: reflect.TypeOf(""), Required: false},
+			{Name: "DryRun", Type: reflect.TypeOf(false), Required: false},
+			{Name: "CreateMissingTags", Type: reflect.TypeOf(false), Required: false},
+		},
+		ReturnType: reflect.TypeOf(map[string]interface{}{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			payload, ok := params["Zip"].(string)
+			if !ok || strings.TrimSpace(payload) == "" {
+				return writeJSONError(w, http.StatusBadRequest, "Zip parameter is required")
+			}
+			data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(payload))
+			if err != nil {
+				return writeJSONError(w, http.StatusBadRequest, "Zip must be base64 encoded")
+			}
+			dryRun, _ := params["DryRun"].(bool)
+			createMissingTags, _ := params["CreateMissingTags"].(bool)
+
+			sourceSystem := defaultSourceSystem
+			if value, ok := params["SourceSystem"].(string); ok && strings.TrimSpace(value) != "" {
+				sourceSystem = strings.TrimSpace(value)
+			}
+			if len(sourceSystem) > 100 {
+				return writeJSONError(w, http.StatusBadRequest, "SourceSystem must be at most 100 characters")
+			}
+
+			files, ignored, err := readMigrationPackage(data)
+			if err != nil {
+				return writeJSONError(w, http.StatusBadRequest, err.Error())
+			}
+			if len(files) == 0 {
+				return writeJSONError(w, http.StatusBadRequest, "The package has no CSV file named after an entity set, such as Accounts.csv or Contacts.csv")
+			}
+
+			type fileResult struct {
+				File      string `json:"file"`
+				EntitySet string `json:"entitySet"`
+				Inserted  int    `json:"inserted"`
+				Updated   int    `json:"updated"`
+				Unchanged int    `json:"unchanged"`
+			}
+			results := []fileResult{}
+			var rowErrors []database.RowError
+
+			txContext := r.Context()
+			if dryRun {
+				txContext = workflows.WithoutEvents(txContext)
+			}
+			err = db.WithContext(txContext).Transaction(func(tx *gorm.DB) error {
+				for _, entitySet := range migrationPackageOrder {
+					file, ok := files[entitySet]
+					if !ok {
+						continue
+					}
+
+					result, fileErrors, err := importMigrationFile(tx, kinds[entitySet], sourceSystem, entitySet, file.Table, createMissingTags)
+					if err != nil {
+						return fmt.Errorf("%s: %w", file.Name, err)
+					}
+					for idx := range fileErrors {
+						fileErrors[idx].File = file.Name
+					}
+					rowErrors = append(rowErrors, fileErrors...)
+					results = append(results, fileResult{File: file.Name, EntitySet: entitySet, Inserted: result.Inserted, Updated: result.Updated, Unchanged: result.Unchanged})
+				}
+
+				if len(rowErrors) > 0 {
+					return errImportRowsRejected
+				}
+				if dryRun {
+					return errDryRunRollback
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errImportRowsRejected) && !errors.Is(err, errDryRunRollback) {
+				return err
+			}
+
+			if rowErrors == nil {
+				rowErrors = []database.RowError{}
+			}
+			if !dryRun && len(rowErrors) > 0 {
+				return writeValidationErrors(w, "One or more rows of the migration package could not be imported", rowErrors)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			return json.NewEncoder(w).Encode(map[string]interface{}{
+				"dryRun":       dryRun,
+				"sourceSystem": sourceSystem,
+				"files":        results,
+				"ignoredFiles": ignored,
+				"errors":       rowErrors,
+			})
+		},
+	})
+}
+
+// readMigrationPackage reads the CSV files of a ZIP archive by entity set. File names are matched ignoring case
+// and punctuation, so accounts.csv and opportunity_line_items.csv are recognised; other files are ignored.
+func readMigrationPackage(data []byte) (map[string]migrationFile, []string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Zip is not a valid ZIP archive")
+	}
+
+	files := make(map[string]migrationFile)
+	ignored := []string{}
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		name := path.Base(entry.Name)
+		extension := path.Ext(name)
+
+		entitySet := ""
+		if strings.EqualFold(extension, ".csv") && !strings.HasPrefix(entry.Name, "__MACOSX/") {
+			stem := normalizeHeader(strings.TrimSuffix(name, extension))
+			for _, candidate := range migrationPackageOrder {
+				if normalizeHeader(candidate) == stem {
+					entitySet = candidate
+					break
+				}
+			}
+		}
+		if entitySet == "" {
+			ignored = append(ignored, entry.Name)
+			continue
+		}
+		if existing, ok := files[entitySet]; ok {
+			return nil, nil, fmt.Errorf("The package contains both %s and %s for %s", existing.Name, entry.Name, entitySet)
+		}
+
+		content, err := readZipEntry(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		table, err := database.ReadCSV(bytes.NewReader(content))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		files[entitySet] = migrationFile{Name: entry.Name, Table: table}
+	}
+	return files, ignored, nil
+}
+
+func readZipEntry(entry *zip.File) ([]byte, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%s could not be read: %w", entry.Name, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, migrationPackageMaxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s could not be read: %w", entry.Name, err)
+	}
+	if len(content) > migrationPackageMaxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", entry.Name, migrationPackageMaxFileSize>>20)
+	}
+	return content, nil
+}
+
+// importMigrationFile replaces the external IDs of a file with the IDs they were imported as, then upserts its rows:
+// rows whose ExternalID was imported before update that record, the others are inserted. The ExternalID of every
+// inserted row is recorded so later files and packages can refer to it. The ID column of the file is ignored.
+func importMigrationFile(tx *gorm.DB, kind importKind, sourceSystem, entitySet string, source *database.Table, createMissingTags bool) (importResult, []database.RowError, error) {
+	var result importResult
+
+	headers := append([]string{}, source.Headers...)
+	columnIndex := indexColumns(headers)
+	ensureColumn := func(name string) int {
+		if idx, ok := columnIndex[name]; ok {
+			return idx
+		}
+		headers = append(headers, name)
+		columnIndex[name] = len(headers) - 1
+		return len(headers) - 1
+	}
+	idColumn := ensureColumn("ID")
+
+	rows := make([][]string, len(source.Rows))
+	for idx, row := range source.Rows {
+		rows[idx] = make([]string, len(headers))
+		copy(rows[idx], row)
+		rows[idx][idColumn] = ""
+	}
+	table := &database.Table{Headers: headers, Rows: rows}
+
+	var rowErrors []database.RowError
+	externalIDs := make(map[int]string)
+	firstRow := make(map[string]int)
+	lookup := source.Lookup("ExternalID")
+	for idx := range rows {
+		row := idx + 2
+		externalID := lookup(row)
+		if externalID == "" {
+			continue
+		}
+		if first, ok := firstRow[externalID]; ok {
+			rowErrors = append(rowErrors, database.RowError{Row: row, Field: "ExternalID", Message: fmt.Sprintf("%q also appears on row %d", externalID, first)})
+			continue
+		}
+		firstRow[externalID] = row
+		externalIDs[row] = externalID
+	}
+
+	existing, err := loadExternalReferences(tx, sourceSystem, entitySet, externalIDs)
+	if err != nil {
+		return result, nil, err
+	}
+	for row, externalID := range externalIDs {
+		if id, ok := existing[externalID]; ok {
+			rows[row-2][idColumn] = strconv.FormatUint(uint64(id), 10)
+		}
+	}
+
+	for _, reference := range externalReferenceColumns {
+		if _, ok := columnIndex[reference.Column]; !ok {
+			continue
+		}
+		referenceLookup := source.Lookup(reference.Column)
+		fieldColumn := ensureColumn(reference.Field)
+
+		values := make(map[int]string)
+		for idx := range rows {
+			for len(rows[idx]) < len(headers) {
+				rows[idx] = append(rows[idx], "")
+			}
+			row := idx + 2
+			if strings.TrimSpace(rows[idx][fieldColumn]) != "" {
+				continue
+			}
+			if value := referenceLookup(row); value != "" {
+				values[row] = value
+			}
+		}
+
+		resolved, err := loadExternalReferences(tx, sourceSystem, reference.EntitySet, values)
+		if err != nil {
+			return result, nil, err
+		}
+		for row, value := range values {
+			id, ok := resolved[value]
+			if !ok {
+				rowErrors = append(rowErrors, database.RowError{
+					Row:     row,
+					Field:   reference.Column,
+					Message: fmt.Sprintf("no %s with external ID %q was imported from %s", reference.Label, value, sourceSystem),
+				})
+				continue
+			}
+			rows[row-2][fieldColumn] = strconv.FormatUint(uint64(id), 10)
+		}
+	}
+	if len(rowErrors) > 0 {
+		sortRowErrors(rowErrors)
+		return result, rowErrors, nil
+	}
+
+	opts, err := kind.options(map[string]interface{}{
+		"Mode":              string(importModeUpsert),
+		"CreateMissingTags": createMissingTags,
+	})
+	if err != nil {
+		return result, nil, err
+	}
+	result, rowErrors, err = kind.importTable(tx, opts, table)
+	if err != nil || len(rowErrors) > 0 {
+		return result, rowErrors, err
+	}
+
+	var references []models.ExternalReference
+	for row, externalID := range externalIDs {
+		id, ok := result.IDs[row]
+		if !ok || id == 0 {
+			continue
+		}
+		if previous, ok := existing[externalID]; ok {
+			// The record imported before was deleted since, so the row was inserted again.
+			if previous != id {
+				if err := tx.Model(&models.ExternalReference{}).
+					Where("source_system = ? AND entity_set = ? AND external_id = ?", sourceSystem, entitySet, externalID).
+					UpdateColumn("entity_id", id).Error; err != nil {
+					return result, nil, err
+				}
+			}
+			continue
+		}
+		references = append(references, models.ExternalReference{
+			SourceSystem: sourceSystem,
+			EntitySet:    entitySet,
+			ExternalID:   externalID,
+			EntityID:     id,
+		})
+	}
+	if len(references) > 0 {
+		if err := tx.CreateInBatches(&references, importJobBatchSize).Error; err != nil {
+			return result, nil, err
+		}
+	}
+	return result, nil, nil
+}
+
+// loadExternalReferences returns the IDs that external IDs of an entity set were imported as, by external ID.
+func loadExternalReferences(tx *gorm.DB, sourceSystem, entitySet string, values map[int]string) (map[string]uint, error) {
+	result := make(map[string]uint)
+	if len(values) == 0 {
+		return result, nil
+	}
+
+	unique := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		unique[value] = struct{}{}
+	}
+
+	var references []models.ExternalReference
+	if err := tx.Where("source_system = ? AND entity_set = ? AND external_id IN ?", sourceSystem, entitySet, keysFromStringSet(unique)).
+		Find(&references).Error; err != nil {
+		return nil, err
+	}
+	for _, reference := range references {
+		result[reference.ExternalID] = reference.EntityID
+	}
+	return result, nil
+}
+
+// indexColumns maps trimmed header names to their position.
+func indexColumns(headers []string) map[string]int {
+	index := make(map[string]int, len(headers))
+	for idx, header := range headers {
+		if trimmed := strings.TrimSpace(header); trimmed != "" {
+			index[trimmed] = idx
+		}
+	}
+	return index
+}
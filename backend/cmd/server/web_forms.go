@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// webFormMaxBodyBytes bounds the size of a submission, forms never need more
+	webFormMaxBodyBytes = 64 << 10
+	webFormRateWindow   = time.Minute
+	// webFormMaxRequestsPerIP bounds the submissions one address makes to all forms, including unknown keys. It is
+	// checked before the form is loaded, so guessing keys does not cost a query per request.
+	webFormMaxRequestsPerIP = 60
+	// webFormActivityType is the type of the activity recorded on the lead for every submission
+	webFormActivityType = "Web Form"
+	webFormSource       = "Website"
+)
+
+// webFormHandler accepts website form submissions at /forms/{key} without authentication and turns them into
+// leads, merging them into the open lead with the same email address when there is one.
+type webFormHandler struct {
+	db      *gorm.DB
+	limiter *webFormLimiter
+	// trustForwardedFor takes the client address from X-Forwarded-For, which is only safe behind a proxy that
+	// sets it
+	trustForwardedFor bool
+}
+
+// registerWebFormEndpoint registers the public form submission endpoint. Set WEB_FORM_TRUST_FORWARDED_FOR=true
+// when the backend runs behind a reverse proxy, otherwise every submission appears to come from the proxy.
+func registerWebFormEndpoint(mux *http.ServeMux, db *gorm.DB) {
+	handler := &webFormHandler{
+		db:                db,
+		limiter:           &webFormLimiter{hits: make(map[string][]time.Time)},
+		trustForwardedFor: strings.EqualFold(os.Getenv("WEB_FORM_TRUST_FORWARDED_FOR"), "true"),
+	}
+	mux.Handle("/forms/{key}", loggingMiddleware(corsMiddleware(handler)))
+}
+
+func (h *webFormHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "Forms are submitted with POST")
+		return
+	}
+
+	ip := h.clientIP(r)
+	if !h.limiter.allow("ip|"+ip, webFormMaxRequestsPerIP, time.Now()) {
+		w.Header().Set("Retry-After", fmt.Sprint(int(webFormRateWindow/time.Second)))
+		writeJSONError(w, http.StatusTooManyRequests, "Too many submissions, please try again later")
+		return
+	}
+
+	var form models.WebForm
+	if err := h.db.WithContext(r.Context()).Preload("Fields").
+		Where("key = ? AND is_active = ?", r.PathValue("key"), true).Take(&form).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeJSONError(w, http.StatusNotFound, "Form not found")
+			return
+		}
+		log.Printf("failed to load web form %q: %v", r.PathValue("key"), err)
+		writeJSONError(w, http.StatusInternalServerError, "The form could not be submitted")
+		return
+	}
+
+	limit := models.DefaultWebFormSubmissionsPerMinute
+	if form.MaxSubmissionsPerMinute != nil {
+		limit = *form.MaxSubmissionsPerMinute
+	}
+	if !h.limiter.allow(fmt.Sprintf("%d|%s", form.ID, ip), limit, time.Now()) {
+		w.Header().Set("Retry-After", fmt.Sprint(int(webFormRateWindow/time.Second)))
+		writeJSONError(w, http.StatusTooManyRequests, "Too many submissions, please try again later")
+		return
+	}
+
+	values, isJSON, err := parseWebFormValues(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Bots fill every field they find; answer as if the submission was accepted so they do not adapt
+	if form.HoneypotField != "" && strings.TrimSpace(values[form.HoneypotField]) != "" {
+		log.Printf("web form %d dropped a submission from %s that filled the honeypot field", form.ID, ip)
+		respondWebFormAccepted(w, r, &form, isJSON)
+		return
+	}
+
+	fields, err := mapWebFormFields(&form, values)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	leadID, merged, err := submitWebForm(h.db.WithContext(r.Context()), &form, fields)
+	if err != nil {
+		log.Printf("web form %d failed to store a submission: %v", form.ID, err)
+		writeJSONError(w, http.StatusInternalServerError, "The form could not be submitted")
+		return
+	}
+	if merged {
+		log.Printf("web form %d merged a submission into lead %d", form.ID, leadID)
+	} else {
+		log.Printf("web form %d created lead %d", form.ID, leadID)
+	}
+
+	respondWebFormAccepted(w, r, &form, isJSON)
+}
+
+// clientIP returns the address rate limits are counted against.
+func (h *webFormHandler) clientIP(r *http.Request) string {
+	if h.trustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// parseWebFormValues reads a JSON object or a URL encoded or multipart form and returns the first value of every
+// field, and whether the submission was JSON.
+func parseWebFormValues(w http.ResponseWriter, r *http.Request) (map[string]string, bool, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, webFormMaxBodyBytes)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	values := make(map[string]string)
+	switch mediaType {
+	case "application/json":
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return nil, true, fmt.Errorf("invalid JSON body")
+		}
+		for name, value := range body {
+			switch v := value.(type) {
+			case string:
+				values[name] = v
+			case nil:
+			default:
+				values[name] = fmt.Sprint(v)
+			}
+		}
+		return values, true, nil
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(webFormMaxBodyBytes); err != nil {
+			return nil, false, fmt.Errorf("invalid form body")
+		}
+	default:
+		if err := r.ParseForm(); err != nil {
+			return nil, false, fmt.Errorf("invalid form body")
+		}
+	}
+	for name, list := range r.PostForm {
+		if len(list) > 0 {
+			values[name] = list[0]
+		}
+	}
+	return values, false, nil
+}
+
+// mapWebFormFields fills the lead fields from the submitted values using the form's field mapping. Forms without
+// a mapping take fields named like the lead fields, ignoring case.
+func mapWebFormFields(form *models.WebForm, values map[string]string) (map[string]string, error) {
+	mapping := form.Fields
+	if len(mapping) == 0 {
+		for _, leadField := range models.WebFormLeadFields {
+			for name := range values {
+				if strings.EqualFold(name, leadField) {
+					mapping = append(mapping, models.WebFormField{FormField: name, LeadField: leadField})
+				}
+			}
+		}
+	}
+
+	fields := make(map[string]string)
+	for _, field := range mapping {
+		value := strings.TrimSpace(values[field.FormField])
+		if value == "" {
+			if field.Required {
+				return nil, fmt.Errorf("%s is required", field.FormField)
+			}
+			continue
+		}
+		if existing := fields[field.LeadField]; existing != "" {
+			separator := " "
+			if field.LeadField == "Notes" {
+				separator = "\n"
+			}
+			value = existing + separator + value
+		}
+		fields[field.LeadField] = value
+	}
+
+	address, err := mail.ParseAddress(fields["Email"])
+	if err != nil {
+		return nil, fmt.Errorf("a valid email address is required")
+	}
+	fields["Email"] = address.Address
+	if fields["Name"] == "" {
+		fields["Name"] = address.Address
+	}
+	if fields["Source"] == "" {
+		fields["Source"] = form.DefaultSource
+		if fields["Source"] == "" {
+			fields["Source"] = webFormSource
+		}
+	}
+	return fields, nil
+}
+
+// submitWebForm stores a submission in one transaction. It merges it into the most recently updated lead with
+// the same email address that is not converted, filling the fields the lead lacks and appending the notes, or
+// creates a new lead, which the assignment rules route when the form has no owner. Either way it records a web
+// form activity on the lead. The lead and the activity are written with GORM, so their workflow events fire and
+// follow-up rules run.
+func submitWebForm(db *gorm.DB, form *models.WebForm, fields map[string]string) (uint, bool, error) {
+	now := time.Now().UTC()
+	var leadID uint
+	merged := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var lead models.Lead
+		err := tx.Where("LOWER(email) = LOWER(?) AND status <> ?", fields["Email"], models.LeadStatusConverted).
+			Order("updated_at DESC, id DESC").Take(&lead).Error
+		switch {
+		case err == nil:
+			merged = true
+			// The lead is updated as a struct, updates given as a map would not emit a workflow event
+			var columns []string
+			for _, field := range []string{"Phone", "Company", "Title", "Website"} {
+				if fields[field] != "" && fillLeadField(&lead, field, fields[field]) {
+					columns = append(columns, field)
+				}
+			}
+			if fields["Notes"] != "" {
+				notes := fmt.Sprintf("%s (%s):\n%s", form.Name, now.Format("2006-01-02"), fields["Notes"])
+				if lead.Notes != "" {
+					notes = lead.Notes + "\n\n" + notes
+				}
+				lead.Notes = notes
+				columns = append(columns, "Notes")
+			}
+			if lead.OwnerEmployeeID == nil && form.OwnerEmployeeID != nil {
+				lead.OwnerEmployeeID = form.OwnerEmployeeID
+				columns = append(columns, "OwnerEmployeeID")
+			}
+			if len(columns) > 0 {
+				if err := tx.Model(&lead).Select(columns).Updates(&lead).Error; err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			lead = models.Lead{
+				Name:            fields["Name"],
+				Email:           fields["Email"],
+				Phone:           fields["Phone"],
+				Company:         fields["Company"],
+				Title:           fields["Title"],
+				Website:         fields["Website"],
+				Source:          fields["Source"],
+				Status:          models.LeadStatusNew,
+				Notes:           fields["Notes"],
+				OwnerEmployeeID: form.OwnerEmployeeID,
+			}
+			if err := tx.Create(&lead).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		activity := models.Activity{
+			LeadID:       &lead.ID,
+			EmployeeID:   lead.OwnerEmployeeID,
+			ActivityType: webFormActivityType,
+			Subject:      "Submitted " + form.Name,
+			Notes:        fields["Notes"],
+			ActivityTime: now,
+		}
+		if err := tx.Create(&activity).Error; err != nil {
+			return err
+		}
+
+		leadID = lead.ID
+		return nil
+	})
+	return leadID, merged, err
+}
+
+// fillLeadField sets one of the fields submissions may fill in when the lead has no value for it, and reports
+// whether it did.
+func fillLeadField(lead *models.Lead, field, value string) bool {
+	var target *string
+	switch field {
+	case "Phone":
+		target = &lead.Phone
+	case "Company":
+		target = &lead.Company
+	case "Title":
+		target = &lead.Title
+	case "Website":
+		target = &lead.Website
+	default:
+		return false
+	}
+	if *target != "" {
+		return false
+	}
+	*target = value
+	return true
+}
+
+// respondWebFormAccepted redirects browsers to the form's RedirectURL, or answers JSON submissions and forms
+// without one with a JSON confirmation. The response never includes the lead, the endpoint is public.
+func respondWebFormAccepted(w http.ResponseWriter, r *http.Request, form *models.WebForm, isJSON bool) {
+	if form.RedirectURL != "" && !isJSON {
+		http.Redirect(w, r, form.RedirectURL, http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]bool{"Accepted": true})
+}
+
+// webFormLimiter counts submissions per key within a sliding window.
+type webFormLimiter struct {
+	mu   sync.Mutex
+	hits map[string][]time.Time
+	// pruned is when the counters of clients that went quiet were last dropped
+	pruned time.Time
+}
+
+// allow records a submission for key and reports whether it stays within limit. A limit of zero is unlimited.
+func (l *webFormLimiter) allow(key string, limit int, now time.Time) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-webFormRateWindow)
+	// Drop the counters of clients that went quiet so the map does not grow with every address seen. Once per
+	// window is enough, sweeping on every submission would make each one cost as much as all clients together.
+	if now.Sub(l.pruned) >= webFormRateWindow {
+		for other, hits := range l.hits {
+			if len(hits) == 0 || !hits[len(hits)-1].After(cutoff) {
+				delete(l.hits, other)
+			}
+		}
+		l.pruned = now
+	}
+
+	recent := l.hits[key][:0]
+	for _, hit := range l.hits[key] {
+		if hit.After(cutoff) {
+			recent = append(recent, hit)
+		}
+	}
+	if len(recent) >= limit {
+		l.hits[key] = recent
+		return false
+	}
+	l.hits[key] = append(recent, now)
+	return true
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/nlstn/go-odata"
+	"github.com/nlstn/my-crm/backend/models"
+	"github.com/nlstn/my-crm/backend/workflows"
+)
+
+// registerWorkflowRuleActions exposes bound actions for inspecting and operating workflow rules
+func registerWorkflowRuleActions(service *odata.Service, engine *workflows.Engine) error {
+	if err := service.RegisterAction(odata.ActionDefinition{
+		Name:      "Test",
+		IsBound:   true,
+		EntitySet: "WorkflowRules",
+		Parameters: []odata.ParameterDefinition{
+			{Name: "EntityID", Type: reflect.TypeOf(uint(0)), Required: false},
+			{Name: "EventType", Type: reflect.TypeOf(""), Required: false},
+			{Name: "OldState", Type: reflect.TypeOf(map[string]interface{}{}), Required: false},
+			{Name: "NewState", Type: reflect.TypeOf(map[string]interface{}{}), Required: false},
+		},
+		ReturnType: reflect.TypeOf(map[string]interface{}{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			rule, ok := ctx.(*models.WorkflowRule)
+			if !ok || rule == nil {
+				return fmt.Errorf("invalid workflow rule context for test")
+			}
+
+			var input workflows.RuleTestInput
+			if rawEntityID, ok := params["EntityID"]; ok {
+				entityID, err := parseUintParam(rawEntityID)
+				if err != nil {
+					return writeJSONError(w, http.StatusBadRequest, "Invalid EntityID provided")
+				}
+				input.EntityID = &entityID
+			}
+
+			if eventType, ok := params["EventType"].(string); ok && strings.TrimSpace(eventType) != "" {
+				switch workflows.EventType(strings.TrimSpace(eventType)) {
+				case workflows.EventTypeCreated, workflows.EventTypeUpdated, workflows.EventTypeDeleted, workflows.EventTypeScheduled:
+					input.EventType = workflows.EventType(strings.TrimSpace(eventType))
+				default:
+					return writeJSONError(w, http.StatusBadRequest, "EventType must be one of Created, Updated, Deleted, Scheduled")
+				}
+			}
+
+			if oldState, ok := params["OldState"].(map[string]interface{}); ok {
+				input.OldState = oldState
+			}
+			if newState, ok := params["NewState"].(map[string]interface{}); ok {
+				input.NewState = newState
+			}
+
+			if input.EntityID == nil && input.NewState == nil {
+				return writeJSONError(w, http.StatusBadRequest, "Either EntityID or NewState must be provided")
+			}
+
+			result, err := engine.TestRule(r.Context(), rule, input)
+			if err != nil {
+				if errors.Is(err, workflows.ErrEntityNotFound) {
+					return writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s could not be found", rule.EntityType))
+				}
+				return err
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			return json.NewEncoder(w).Encode(result)
+		},
+	}); err != nil {
+		return err
+	}
+
+	return service.RegisterAction(odata.ActionDefinition{
+		Name:      "RunOnExisting",
+		IsBound:   true,
+		EntitySet: "WorkflowRules",
+		Parameters: []odata.ParameterDefinition{
+			{Name: "MaxRecords", Type: reflect.TypeOf(int64(0)), Required: false},
+			{Name: "BatchSize", Type: reflect.TypeOf(int64(0)), Required: false},
+		},
+		ReturnType: reflect.TypeOf(map[string]interface{}{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			rule, ok := ctx.(*models.WorkflowRule)
+			if !ok || rule == nil {
+				return fmt.Errorf("invalid workflow rule context for backfill")
+			}
+
+			opts := workflows.BackfillOptions{
+				OnProgress: func(progress workflows.BackfillProgress) {
+					log.Printf("workflow rule %d backfill batch %d: scanned=%d executed=%d failed=%d skipped=%d",
+						rule.ID, progress.Batches, progress.Scanned, progress.Executed, progress.Failed, progress.Skipped)
+				},
+			}
+			if maxRecords, ok := params["MaxRecords"].(int64); ok {
+				if maxRecords <= 0 {
+					return writeJSONError(w, http.StatusBadRequest, "MaxRecords must be greater than zero")
+				}
+				opts.MaxRecords = int(maxRecords)
+			}
+			if batchSize, ok := params["BatchSize"].(int64); ok {
+				if batchSize <= 0 {
+					return writeJSONError(w, http.StatusBadRequest, "BatchSize must be greater than zero")
+				}
+				opts.BatchSize = int(batchSize)
+			}
+
+			result, err := engine.RunOnExisting(r.Context(), rule, opts)
+			if err != nil {
+				return err
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			return json.NewEncoder(w).Encode(result)
+		},
+	})
+}
+
+// registerWorkflowCatalogFunction exposes the supported triggers and actions with their config schemas
+func registerWorkflowCatalogFunction(service *odata.Service) error {
+	return service.RegisterFunction(odata.FunctionDefinition{
+		Name:       "GetWorkflowCatalog",
+		IsBound:    false,
+		Parameters: []odata.ParameterDefinition{},
+		ReturnType: reflect.TypeOf(map[string]interface{}{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) (interface{}, error) {
+			triggers := make([]map[string]interface{}, 0)
+			for _, trigger := range models.WorkflowTriggerDefinitions() {
+				triggers = append(triggers, map[string]interface{}{
+					"type":         trigger.Type,
+					"description":  trigger.Description,
+					"entityTypes":  trigger.EntityTypes,
+					"configSchema": trigger.Config.JSONSchema(),
+				})
+			}
+
+			actions := make([]map[string]interface{}, 0)
+			for _, action := range models.WorkflowActionDefinitions() {
+				actions = append(actions, map[string]interface{}{
+					"type":         action.Type,
+					"description":  action.Description,
+					"configSchema": action.Config.JSONSchema(),
+				})
+			}
+
+			entities := make(map[string][]models.WorkflowEntityField)
+			for _, entityType := range models.WorkflowEntityTypes() {
+				entities[entityType] = models.WorkflowEntityFields(entityType)
+			}
+
+			return map[string]interface{}{
+				"triggers": triggers,
+				"actions":  actions,
+				"entities": entities,
+			}, nil
+		},
+	})
+}
+
+// registerWorkflowRetentionActions exposes manual runs of execution retention policies
+func registerWorkflowRetentionActions(service *odata.Service, engine *workflows.Engine) error {
+	return service.RegisterAction(odata.ActionDefinition{
+		Name:       "Run",
+		IsBound:    true,
+		EntitySet:  "WorkflowRetentionPolicies",
+		Parameters: []odata.ParameterDefinition{},
+		ReturnType: reflect.TypeOf(map[string]interface{}{}),
+		Handler: func(w http.ResponseWriter, r *http.Request, ctx interface{}, params map[string]interface{}) error {
+			policy, ok := ctx.(*models.WorkflowRetentionPolicy)
+			if !ok || policy == nil {
+				return fmt.Errorf("invalid retention policy context")
+			}
+
+			result, err := engine.PruneExecutions(r.Context(), policy)
+			if err != nil {
+				if errors.Is(err, workflows.ErrArchiveDirNotConfigured) {
+					return writeJSONError(w, http.StatusConflict, "Archiving requires WORKFLOW_ARCHIVE_DIR to be configured")
+				}
+				return err
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			return json.NewEncoder(w).Encode(result)
+		},
+	})
+}
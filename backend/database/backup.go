@@ -0,0 +1,402 @@
+package database
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BackupFormatVersion identifies the layout of backup archives. RestoreBackup rejects archives of other versions.
+const BackupFormatVersion = 1
+
+// SchemaVersion identifies the tables AutoMigrate creates. Increase it whenever a column is added, removed or
+// changed. Archives of older versions are restored into the columns they hold, so added columns take their
+// defaults, and archives of newer versions are rejected.
+const SchemaVersion = 6
+
+// BackupManifestFile names the manifest inside a backup archive.
+const BackupManifestFile = "manifest.json"
+
+// backupBatchSize is the number of rows read or inserted per statement.
+const backupBatchSize = 500
+
+// backupMaxLineSize limits the size of one row in a backup archive.
+const backupMaxLineSize = 16 << 20
+
+// ErrDatabaseNotEmpty is returned by RestoreBackup when a table already holds rows.
+var ErrDatabaseNotEmpty = errors.New("database is not empty")
+
+// BackupManifest describes the contents of a backup archive.
+type BackupManifest struct {
+	FormatVersion int       `json:"formatVersion"`
+	SchemaVersion int       `json:"schemaVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// Tables lists the tables of the archive in the order they can be restored in.
+	Tables []BackupTable `json:"tables"`
+}
+
+// BackupTable is one table of a backup archive, stored as JSON Lines with one row per line.
+type BackupTable struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Rows int64  `json:"rows"`
+}
+
+// backupTable is a table backed up by WriteBackup.
+type backupTable struct {
+	Name string
+	// PrimaryKey orders the rows, so rows referring to earlier rows of the same table are restored after them.
+	PrimaryKey []string
+}
+
+// backupTables returns the tables of all models, ordered so every table comes after the tables it references.
+func backupTables(db *gorm.DB) ([]backupTable, error) {
+	tables := make([]backupTable, 0, len(Models))
+	known := make(map[string]struct{}, len(Models))
+	for _, model := range Models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+		tables = append(tables, backupTable{Name: stmt.Schema.Table, PrimaryKey: stmt.Schema.PrimaryFieldDBNames})
+		known[stmt.Schema.Table] = struct{}{}
+	}
+
+	var references []struct {
+		Child  string
+		Parent string
+	}
+	err := db.Raw(`SELECT child.relname AS child, parent.relname AS parent
+		FROM pg_constraint c
+		JOIN pg_class child ON child.oid = c.conrelid
+		JOIN pg_class parent ON parent.oid = c.confrelid
+		JOIN pg_namespace n ON n.oid = child.relnamespace
+		WHERE c.contype = 'f' AND n.nspname = current_schema()`).Scan(&references).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foreign keys: %w", err)
+	}
+
+	parents := make(map[string]map[string]struct{})
+	for _, reference := range references {
+		_, childKnown := known[reference.Child]
+		_, parentKnown := known[reference.Parent]
+		if !childKnown || !parentKnown || reference.Child == reference.Parent {
+			continue
+		}
+		if parents[reference.Child] == nil {
+			parents[reference.Child] = make(map[string]struct{})
+		}
+		parents[reference.Child][reference.Parent] = struct{}{}
+	}
+
+	// Repeatedly take the first remaining table whose parents are all placed, keeping the order of Models otherwise
+	ordered := make([]backupTable, 0, len(tables))
+	placed := make(map[string]struct{}, len(tables))
+	for len(ordered) < len(tables) {
+		progress := false
+		for _, table := range tables {
+			if _, done := placed[table.Name]; done {
+				continue
+			}
+			ready := true
+			for parent := range parents[table.Name] {
+				if _, ok := placed[parent]; !ok {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, table)
+				placed[table.Name] = struct{}{}
+				progress = true
+			}
+		}
+		if !progress {
+			var cyclic []string
+			for _, table := range tables {
+				if _, done := placed[table.Name]; !done {
+					cyclic = append(cyclic, table.Name)
+				}
+			}
+			sort.Strings(cyclic)
+			return nil, fmt.Errorf("tables %s reference each other", strings.Join(cyclic, ", "))
+		}
+	}
+	return ordered, nil
+}
+
+// WriteBackup writes every table to a ZIP archive holding one JSON Lines file per table and a manifest with the
+// schema version and row counts. All tables are read from one snapshot, so the archive is consistent even while
+// the database is in use.
+func WriteBackup(ctx context.Context, db *gorm.DB, w io.Writer) (*BackupManifest, error) {
+	tables, err := backupTables(db)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BackupManifest{
+		FormatVersion: BackupFormatVersion,
+		SchemaVersion: SchemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		Tables:        make([]BackupTable, 0, len(tables)),
+	}
+	archive := zip.NewWriter(w)
+
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range tables {
+			entry := BackupTable{Name: table.Name, File: path.Join("tables", table.Name+".jsonl")}
+			file, err := archive.Create(entry.File)
+			if err != nil {
+				return err
+			}
+			if entry.Rows, err = writeBackupTable(tx, table, file); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", table.Name, err)
+			}
+			manifest.Tables = append(manifest.Tables, entry)
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := archive.Create(BackupManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeBackupTable writes the rows of a table as JSON objects keyed by column name, one per line.
+func writeBackupTable(tx *gorm.DB, table backupTable, w io.Writer) (int64, error) {
+	order := make([]string, len(table.PrimaryKey))
+	for i, column := range table.PrimaryKey {
+		order[i] = quoteIdentifier(column)
+	}
+	query := fmt.Sprintf("SELECT row_to_json(t)::text FROM %s t", quoteIdentifier(table.Name))
+	if len(order) > 0 {
+		query += " ORDER BY " + strings.Join(order, ", ")
+	}
+
+	rows, err := tx.Raw(query).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	writer := bufio.NewWriter(w)
+	var count int64
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return count, err
+		}
+		if _, err := writer.WriteString(line); err != nil {
+			return count, err
+		}
+		if err := writer.WriteByte('\n'); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, writer.Flush()
+}
+
+// ReadBackupManifest reads and checks the manifest of a backup archive.
+func ReadBackupManifest(archive *zip.Reader) (*BackupManifest, error) {
+	file, err := archive.Open(BackupManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("the archive has no %s", BackupManifestFile)
+	}
+	defer file.Close()
+
+	var manifest BackupManifest
+	if err := json.NewDecoder(file).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%s is not valid JSON: %w", BackupManifestFile, err)
+	}
+	if manifest.FormatVersion != BackupFormatVersion {
+		return nil, fmt.Errorf("the archive has format version %d, but only version %d can be restored", manifest.FormatVersion, BackupFormatVersion)
+	}
+	if manifest.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("the archive was taken from schema version %d, but the database only has schema version %d", manifest.SchemaVersion, SchemaVersion)
+	}
+	return &manifest, nil
+}
+
+// RestoreBackup loads a backup archive into tx. Every table must be empty. Rows keep their IDs, and the sequences
+// of serial columns are moved past the restored IDs so new records do not collide with them. Rows are inserted
+// with plain SQL, so model hooks and workflow callbacks do not run.
+func RestoreBackup(tx *gorm.DB, archive *zip.Reader, manifest *BackupManifest) error {
+	tables, err := backupTables(tx)
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]BackupTable, len(manifest.Tables))
+	for _, entry := range manifest.Tables {
+		entries[entry.Name] = entry
+	}
+	known := make(map[string]struct{}, len(tables))
+	for _, table := range tables {
+		known[table.Name] = struct{}{}
+	}
+	for _, entry := range manifest.Tables {
+		if _, ok := known[entry.Name]; !ok {
+			return fmt.Errorf("the archive contains unknown table %s", entry.Name)
+		}
+	}
+
+	var filled []string
+	for _, table := range tables {
+		var exists bool
+		if err := tx.Raw(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s)", quoteIdentifier(table.Name))).Scan(&exists).Error; err != nil {
+			return err
+		}
+		if exists {
+			filled = append(filled, table.Name)
+		}
+	}
+	if len(filled) > 0 {
+		return fmt.Errorf("%w: %s already contain rows", ErrDatabaseNotEmpty, strings.Join(filled, ", "))
+	}
+
+	for _, table := range tables {
+		entry, ok := entries[table.Name]
+		if !ok {
+			continue
+		}
+		count, err := restoreBackupTable(tx, archive, table, entry)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", table.Name, err)
+		}
+		if count != entry.Rows {
+			return fmt.Errorf("%s holds %d rows, but the manifest lists %d", entry.File, count, entry.Rows)
+		}
+		if err := resetSequences(tx, table.Name); err != nil {
+			return fmt.Errorf("failed to reset the sequences of %s: %w", table.Name, err)
+		}
+	}
+	return nil
+}
+
+// restoreBackupTable inserts the rows of one JSON Lines file in batches and returns how many it inserted. Only the
+// columns of the first row are inserted, every row of a file has the same columns, so columns added after the
+// archive was taken take their defaults and columns that were dropped since are ignored.
+func restoreBackupTable(tx *gorm.DB, archive *zip.Reader, table backupTable, entry BackupTable) (int64, error) {
+	file, err := archive.Open(entry.File)
+	if err != nil {
+		return 0, fmt.Errorf("the archive has no %s", entry.File)
+	}
+	defer file.Close()
+
+	columnTypes, err := tx.Migrator().ColumnTypes(table.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	var insert string
+	var batch bytes.Buffer
+	var pending, count int64
+	flush := func() error {
+		if pending == 0 {
+			return nil
+		}
+		batch.WriteByte(']')
+		if err := tx.Exec(insert, batch.String()).Error; err != nil {
+			return err
+		}
+		count += pending
+		pending = 0
+		batch.Reset()
+		return nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), backupMaxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		row := bytes.TrimSpace(scanner.Bytes())
+		if len(row) == 0 {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(row, &fields); err != nil || row[0] != '{' {
+			return count, fmt.Errorf("line %d of %s is not a JSON object", line, entry.File)
+		}
+		if insert == "" {
+			var columns []string
+			for _, columnType := range columnTypes {
+				if _, ok := fields[columnType.Name()]; ok {
+					columns = append(columns, quoteIdentifier(columnType.Name()))
+				}
+			}
+			if len(columns) == 0 {
+				return count, fmt.Errorf("line %d of %s holds none of the columns of %s", line, entry.File, table.Name)
+			}
+			insert = fmt.Sprintf("INSERT INTO %[1]s (%[2]s) SELECT %[2]s FROM json_populate_recordset(NULL::%[1]s, ?::json)",
+				quoteIdentifier(table.Name), strings.Join(columns, ", "))
+		}
+		if pending == 0 {
+			batch.WriteByte('[')
+		} else {
+			batch.WriteByte(',')
+		}
+		batch.Write(row)
+		pending++
+		if pending == backupBatchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return count, fmt.Errorf("failed to read %s: %w", entry.File, err)
+	}
+	return count, flush()
+}
+
+// resetSequences moves the sequence of every serial column of a table past the largest value in the column.
+func resetSequences(tx *gorm.DB, table string) error {
+	var columns []string
+	err := tx.Raw(`SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ? AND column_default LIKE 'nextval(%'`, table).
+		Scan(&columns).Error
+	if err != nil {
+		return err
+	}
+
+	for _, column := range columns {
+		query := fmt.Sprintf("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE(MAX(%[1]s), 0) + 1, false) FROM %[2]s",
+			quoteIdentifier(column), quoteIdentifier(table))
+		if err := tx.Exec(query, table, column).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,476 @@
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVCodec reads and writes records of one model as table rows. Its columns are derived from the model's
+// fields by NewCSVCodec, so new fields are imported and exported without further changes.
+type CSVCodec[T any] struct {
+	Headers []string
+	columns []codecColumn
+	checks  []CSVCheck[T]
+}
+
+// CSVCheck validates a parsed record before it is accepted, for rules spanning several columns or values
+// that must come from a fixed list. It may normalise the record. cell reads any column of the row, including
+// natural key columns the model has no field for.
+type CSVCheck[T any] func(record *T, cell func(column string) string) *RowError
+
+// codecColumn is one column of a codec and the model field it reads and writes.
+type codecColumn struct {
+	name  string
+	index int
+	// required columns must be present and non-empty. A column with a natural key may instead be left
+	// empty when the natural key column has a value; the ID is then resolved while validating dependencies.
+	required   bool
+	naturalKey string
+	// fallback is the GORM default of the field, used for empty cells.
+	fallback    string
+	hasFallback bool
+	// names marks a many-to-many navigation property written as a list of the related records' names.
+	names bool
+}
+
+// enumMembers is implemented by integer enumerations that can be given by name, such as IssueStatus.
+type enumMembers interface {
+	EnumMembers() map[string]int64
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	enumMembersType = reflect.TypeOf((*enumMembers)(nil)).Elem()
+)
+
+// NewCSVCodec derives the columns of a model from its exported fields, in declaration order. The struct tags
+// decide how each field is handled:
+//
+//   - fields tagged csv:"-", gorm:"-", autoCreateTime or autoUpdateTime are left out, and so are navigation
+//     properties unless tagged csv:"names", which writes the Name of each related record separated by ";"
+//   - fields tagged odata:"required" without a GORM default must have a value
+//   - csv:"key=AccountName" lets a required ID be left empty when the named natural key column is given
+//   - empty cells take the GORM default of the field
+//
+// Integer enumerations with an EnumMembers method are written and read by name, maps as JSON and times in
+// RFC3339. NewCSVCodec panics on fields of other types that are not left out, so they are caught at startup.
+func NewCSVCodec[T any](checks ...CSVCheck[T]) CSVCodec[T] {
+	model := reflect.TypeOf((*T)(nil)).Elem()
+	codec := CSVCodec[T]{checks: checks}
+
+	for index := 0; index < model.NumField(); index++ {
+		field := model.Field(index)
+		if !field.IsExported() {
+			continue
+		}
+		csvTag := tagOptions(field.Tag.Get("csv"), ",")
+		gormTag := tagOptions(field.Tag.Get("gorm"), ";")
+		odataTag := tagOptions(field.Tag.Get("odata"), ",")
+		if _, skip := csvTag["-"]; skip {
+			continue
+		}
+		if _, skip := gormTag["-"]; skip {
+			continue
+		}
+		if _, ok := gormTag["autocreatetime"]; ok {
+			continue
+		}
+		if _, ok := gormTag["autoupdatetime"]; ok {
+			continue
+		}
+
+		column := codecColumn{name: field.Name, index: index}
+		_, column.names = csvTag["names"]
+		if _, navigation := odataTag["navigation"]; navigation && !column.names {
+			continue
+		}
+		if column.names && !isNameList(field.Type) {
+			panic(fmt.Sprintf("database: %s.%s is tagged csv:\"names\" but its records have no Name", model.Name(), field.Name))
+		}
+		if !column.names && !supportedCSVType(field.Type) {
+			panic(fmt.Sprintf("database: %s.%s has type %s, which CSV codecs do not support; tag it csv:\"-\"", model.Name(), field.Name, field.Type))
+		}
+
+		column.fallback, column.hasFallback = gormTag["default"]
+		column.fallback = strings.Trim(column.fallback, "'")
+		_, required := odataTag["required"]
+		column.required = required && !column.hasFallback
+		column.naturalKey = csvTag["key"]
+
+		codec.columns = append(codec.columns, column)
+		codec.Headers = append(codec.Headers, column.name)
+	}
+	return codec
+}
+
+// tagOptions splits a struct tag into its options. Keys are lower-cased; options without a value map to "".
+func tagOptions(tag, separator string) map[string]string {
+	options := make(map[string]string)
+	for _, option := range strings.Split(tag, separator) {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(option, ":")
+		if !strings.Contains(option, ":") {
+			key, value, _ = strings.Cut(option, "=")
+		}
+		options[strings.ToLower(key)] = value
+	}
+	return options
+}
+
+func isNameList(fieldType reflect.Type) bool {
+	if fieldType.Kind() != reflect.Slice || fieldType.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	name, ok := fieldType.Elem().FieldByName("Name")
+	return ok && name.Type.Kind() == reflect.String
+}
+
+func supportedCSVType(fieldType reflect.Type) bool {
+	if fieldType.Kind() == reflect.Pointer {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType == timeType {
+		return true
+	}
+	switch fieldType.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Map:
+		return fieldType.Key().Kind() == reflect.String
+	}
+	return false
+}
+
+// Parse reads the rows of a table read from a CSV file or an XLSX sheet. It returns the records that parsed
+// with their row numbers, and a row error for every other row. Missing required headers fail the whole table.
+func (c CSVCodec[T]) Parse(table *Table) ([]T, []int, []RowError, error) {
+	return c.parse(table, false)
+}
+
+// ParseUpdate reads the rows of a table whose records update existing ones, which only change the columns the
+// table has. Columns the table does not have are not required, and checks failing on such a column are left to
+// the validation of the updated record.
+func (c CSVCodec[T]) ParseUpdate(table *Table) ([]T, []int, []RowError, error) {
+	return c.parse(table, true)
+}
+
+// HasDefault reports whether empty cells of column take the GORM default of its field.
+func (c CSVCodec[T]) HasDefault(column string) bool {
+	for _, candidate := range c.columns {
+		if candidate.name == column {
+			return candidate.hasFallback
+		}
+	}
+	return false
+}
+
+// EnumMembers returns the members of column when its field is an integer enumeration written by name.
+func (c CSVCodec[T]) EnumMembers(column string) (map[string]int64, bool) {
+	model := reflect.TypeOf((*T)(nil)).Elem()
+	for _, candidate := range c.columns {
+		if candidate.name != column || candidate.names {
+			continue
+		}
+		fieldType := model.Field(candidate.index).Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if !fieldType.Implements(enumMembersType) {
+			return nil, false
+		}
+		return reflect.Zero(fieldType).Interface().(enumMembers).EnumMembers(), true
+	}
+	return nil, false
+}
+
+func (c CSVCodec[T]) parse(table *Table, update bool) ([]T, []int, []RowError, error) {
+	headerIndex := indexHeaders(table.Headers)
+	present := func(column string) bool {
+		_, ok := headerIndex[column]
+		return ok
+	}
+	for _, column := range c.columns {
+		if !column.required || update {
+			continue
+		}
+		if present(column.name) {
+			continue
+		}
+		if column.naturalKey == "" {
+			return nil, nil, nil, fmt.Errorf("CSV is missing required header: %s", column.name)
+		}
+		if !present(column.naturalKey) {
+			return nil, nil, nil, fmt.Errorf("CSV is missing required header: %s (or %s)", column.name, column.naturalKey)
+		}
+	}
+
+	var (
+		records    []T
+		rowErrors  []RowError
+		rowNumbers []int
+	)
+	for rowIndex, row := range table.Rows {
+		currentRow := rowIndex + 2 // account for header row
+		cell := func(column string) string {
+			return valueFor(row, headerIndex, column)
+		}
+
+		var record T
+		rowErr := c.parseRow(reflect.ValueOf(&record).Elem(), cell, present, update)
+		for _, check := range c.checks {
+			if rowErr != nil {
+				break
+			}
+			rowErr = check(&record, cell)
+			if rowErr != nil && update && rowErr.Field != "" && !present(rowErr.Field) {
+				rowErr = nil
+			}
+		}
+		if rowErr != nil {
+			rowErr.Row = currentRow
+			rowErrors = append(rowErrors, *rowErr)
+			continue
+		}
+
+		records = append(records, record)
+		rowNumbers = append(rowNumbers, currentRow)
+	}
+	return records, rowNumbers, rowErrors, nil
+}
+
+// parseRow sets the fields of record from the cells of a row. For updates, required columns the table does not
+// have may stay empty.
+func (c CSVCodec[T]) parseRow(record reflect.Value, cell func(column string) string, present func(column string) bool, update bool) *RowError {
+	for _, column := range c.columns {
+		field := record.Field(column.index)
+		text := cell(column.name)
+
+		if column.names {
+			for _, name := range splitNameList(text) {
+				item := reflect.New(field.Type().Elem()).Elem()
+				item.FieldByName("Name").SetString(name)
+				field.Set(reflect.Append(field, item))
+			}
+			continue
+		}
+
+		if text == "" {
+			if column.naturalKey != "" && cell(column.naturalKey) != "" {
+				continue
+			}
+			// Updates keep the stored value of columns the table does not have
+			notProvided := update && !present(column.name) && (column.naturalKey == "" || !present(column.naturalKey))
+			if column.required && !notProvided {
+				message := "is required"
+				if column.naturalKey != "" {
+					message = fmt.Sprintf("is required unless %s is given", column.naturalKey)
+				}
+				return &RowError{Field: column.name, Message: message}
+			}
+			if !column.hasFallback {
+				continue
+			}
+			if message := setCSVFallback(field, column.fallback); message != "" {
+				return &RowError{Field: column.name, Message: message}
+			}
+			continue
+		}
+
+		if message := parseCSVValue(field, text); message != "" {
+			return &RowError{Field: column.name, Message: message}
+		}
+	}
+	return nil
+}
+
+// setCSVFallback sets field to the GORM default of its column. Enumerations store their default as a number rather
+// than a member name, so it is set as one.
+func setCSVFallback(field reflect.Value, fallback string) string {
+	target := field
+	if target.Kind() == reflect.Pointer {
+		target = reflect.New(field.Type().Elem()).Elem()
+	}
+	if !target.Type().Implements(enumMembersType) {
+		return parseCSVValue(field, fallback)
+	}
+
+	value, err := strconv.ParseInt(fallback, 10, target.Type().Bits())
+	if err != nil {
+		return fmt.Sprintf("has an invalid default %q", fallback)
+	}
+	target.SetInt(value)
+	if field.Kind() == reflect.Pointer {
+		field.Set(target.Addr())
+	}
+	return ""
+}
+
+// parseCSVValue sets field from the text of a non-empty cell and returns a message describing why the text
+// is not a valid value, or an empty string.
+func parseCSVValue(field reflect.Value, text string) string {
+	if field.Kind() == reflect.Pointer {
+		value := reflect.New(field.Type().Elem())
+		if message := parseCSVValue(value.Elem(), text); message != "" {
+			return message
+		}
+		field.Set(value)
+		return ""
+	}
+
+	if field.Type() == timeType {
+		parsed, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return "must be in RFC3339 format"
+		}
+		field.Set(reflect.ValueOf(parsed.UTC()))
+		return ""
+	}
+
+	if field.Type().Implements(enumMembersType) {
+		members := field.Interface().(enumMembers).EnumMembers()
+		for name, value := range members {
+			if strings.EqualFold(name, text) {
+				field.SetInt(value)
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(EnumNames(members), ", ")
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Bool:
+		switch strings.ToLower(text) {
+		case "true", "1", "yes", "y":
+			field.SetBool(true)
+		case "false", "0", "no", "n":
+			field.SetBool(false)
+		default:
+			return "must be true or false"
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		parsed, err := strconv.ParseInt(text, 10, field.Type().Bits())
+		if err != nil {
+			return "must be a whole number"
+		}
+		field.SetInt(parsed)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		parsed, err := strconv.ParseUint(text, 10, field.Type().Bits())
+		if err != nil {
+			return "must be a positive whole number"
+		}
+		if parsed == 0 {
+			return "must be greater than zero"
+		}
+		field.SetUint(parsed)
+	case reflect.Float32, reflect.Float64:
+		parsed, err := strconv.ParseFloat(text, field.Type().Bits())
+		if err != nil {
+			return "must be a valid number"
+		}
+		field.SetFloat(parsed)
+	case reflect.Map:
+		value := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(text), value.Interface()); err != nil {
+			return "must be a JSON object"
+		}
+		field.Set(value.Elem())
+	}
+	return ""
+}
+
+// EnumNames returns the names of an enumeration ordered by value.
+func EnumNames(members map[string]int64) []string {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return members[names[i]] < members[names[j]] })
+	return names
+}
+
+// Record returns the CSV text of a record, one value per header.
+func (c CSVCodec[T]) Record(item T) []string {
+	value := reflect.ValueOf(item)
+	record := make([]string, len(c.columns))
+	for idx, column := range c.columns {
+		field := value.Field(column.index)
+		if column.names {
+			record[idx] = joinNameList(field)
+			continue
+		}
+		record[idx] = formatCSVValue(field)
+	}
+	return record
+}
+
+func formatCSVValue(field reflect.Value) string {
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return ""
+		}
+		field = field.Elem()
+	}
+	if field.Type() == timeType {
+		return field.Interface().(time.Time).UTC().Format(time.RFC3339)
+	}
+	if field.Type().Implements(enumMembersType) {
+		return field.Interface().(fmt.Stringer).String()
+	}
+
+	switch field.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return formatFloat(field.Float())
+	case reflect.Map:
+		if field.IsNil() {
+			return ""
+		}
+		encoded, err := json.Marshal(field.Interface())
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	}
+	return field.String()
+}
+
+// Encode writes the header row followed by one row per record.
+func (c CSVCodec[T]) Encode(records []T) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+
+	if err := writer.Write(c.Headers); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if err := writer.Write(c.Record(record)); err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/nlstn/my-crm/backend/models"
+)
+
+func TestIssueCSVDefaultsMissingEnums(t *testing.T) {
+	tables := map[string]*Table{
+		"missing columns": {
+			Headers: []string{"AccountID", "Title"},
+			Rows:    [][]string{{"1", "Printer jammed"}},
+		},
+		"empty cells": {
+			Headers: []string{"AccountID", "Title", "Status", "Priority"},
+			Rows:    [][]string{{"1", "Printer jammed", "", ""}},
+		},
+	}
+
+	for name, table := range tables {
+		t.Run(name, func(t *testing.T) {
+			issues, _, rowErrors, err := IssueCSV.Parse(table)
+			if err != nil {
+				t.Fatalf("Parse returned error: %v", err)
+			}
+			if len(rowErrors) > 0 {
+				t.Fatalf("Parse returned row errors: %+v", rowErrors)
+			}
+			if len(issues) != 1 {
+				t.Fatalf("Parse returned %d issues, want 1", len(issues))
+			}
+			if issues[0].Status != models.IssueStatusNew {
+				t.Errorf("Status = %v, want %v", issues[0].Status, models.IssueStatusNew)
+			}
+			if issues[0].Priority != models.IssuePriorityMedium {
+				t.Errorf("Priority = %v, want %v", issues[0].Priority, models.IssuePriorityMedium)
+			}
+		})
+	}
+}
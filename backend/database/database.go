@@ -36,30 +36,45 @@ func Connect() (*gorm.DB, error) {
 	return db, nil
 }
 
+// Models lists every model AutoMigrate creates a table for, including join tables and workflow history.
+var Models = []interface{}{
+	&models.Account{},
+	&models.Tag{},
+	&models.AccountTag{},
+	&models.Contact{},
+	&models.Lead{},
+	&models.Issue{},
+	&models.IssueUpdate{},
+	&models.Activity{},
+	&models.Task{},
+	&models.Employee{},
+	&models.Product{},
+	&models.Opportunity{},
+	&models.OpportunityLineItem{},
+	&models.OpportunityStageHistory{},
+	&models.WorkflowRule{},
+	&models.WorkflowExecution{},
+	&models.WorkflowRuleStatistic{},
+	&models.WorkflowRetentionPolicy{},
+	&models.AssignmentRule{},
+	&models.ImportJob{},
+	&models.ImportMapping{},
+	&models.ImportMappingColumn{},
+	&models.ExternalReference{},
+	&models.DuplicateRule{},
+	&models.DuplicateCandidate{},
+	&models.LeadScoringRule{},
+	&models.LeadStatusHistory{},
+	&models.WebForm{},
+	&models.WebFormField{},
+	&models.AuditEntry{},
+}
+
 // AutoMigrate runs automatic migrations for all models
 func AutoMigrate(db *gorm.DB) error {
 	log.Println("Running database migrations...")
 
-	err := db.AutoMigrate(
-		&models.Account{},
-		&models.Tag{},
-		&models.AccountTag{},
-		&models.Contact{},
-		&models.Lead{},
-		&models.Issue{},
-		&models.IssueUpdate{},
-		&models.Activity{},
-		&models.Task{},
-		&models.Employee{},
-		&models.Product{},
-		&models.Opportunity{},
-		&models.OpportunityLineItem{},
-		&models.OpportunityStageHistory{},
-		&models.WorkflowRule{},
-		&models.WorkflowExecution{},
-	)
-
-	if err != nil {
+	if err := db.AutoMigrate(Models...); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
@@ -69,6 +84,12 @@ func AutoMigrate(db *gorm.DB) error {
 
 // SeedData populates the database with initial sample data
 func SeedData(db *gorm.DB) error {
+	// Databases that are about to receive a backup through RestoreData must stay empty
+	if getEnv("SEED_DATA", "true") == "false" {
+		log.Println("SEED_DATA is false, skipping seed")
+		return nil
+	}
+
 	// Check if data already exists
 	var count int64
 	db.Model(&models.Account{}).Count(&count)
@@ -144,7 +165,6 @@ func SeedData(db *gorm.DB) error {
 	industries := []string{"Technology", "Manufacturing", "Retail", "Healthcare", "Finance", "Education", "Logistics", "Food & Beverage", "Consulting", "Marketing"}
 	cities := []string{"San Francisco", "Detroit", "New York", "Austin", "Seattle", "Boston", "Chicago", "Denver", "Atlanta", "Los Angeles"}
 	states := []string{"CA", "MI", "NY", "TX", "WA", "MA", "IL", "CO", "GA", "FL"}
-	lifecycleStages := []string{"Prospect", "Qualified", "Customer", "Churn Risk"}
 
 	accounts := make([]models.Account, 30)
 	for i := 0; i < 30; i++ {
@@ -161,7 +181,7 @@ func SeedData(db *gorm.DB) error {
 			PostalCode:     fmt.Sprintf("%05d", 10000+i*100),
 			Description:    fmt.Sprintf("Account for %s", accountNames[i]),
 			EmployeeID:     &employees[i%len(employees)].ID,
-			LifecycleStage: lifecycleStages[i%len(lifecycleStages)],
+			LifecycleStage: models.AccountLifecycleStages[i%len(models.AccountLifecycleStages)],
 		}
 	}
 
@@ -876,6 +896,69 @@ func SeedData(db *gorm.DB) error {
 		}
 	}
 
+	var retentionPolicyCount int64
+	db.Model(&models.WorkflowRetentionPolicy{}).Count(&retentionPolicyCount)
+	if retentionPolicyCount == 0 {
+		retentionPolicies := []models.WorkflowRetentionPolicy{
+			{
+				Name:          "Succeeded executions",
+				Description:   "Remove successful workflow executions after 90 days.",
+				Status:        models.WorkflowExecutionStatusSucceeded,
+				RetentionDays: 90,
+				IsActive:      true,
+			},
+			{
+				Name:          "Failed executions",
+				Description:   "Keep failed workflow executions for troubleshooting for 180 days.",
+				Status:        models.WorkflowExecutionStatusFailed,
+				RetentionDays: 180,
+				IsActive:      true,
+			},
+		}
+
+		if err := db.Create(&retentionPolicies).Error; err != nil {
+			return fmt.Errorf("failed to seed workflow retention policies: %w", err)
+		}
+	}
+
+	var duplicateRuleCount int64
+	db.Model(&models.DuplicateRule{}).Count(&duplicateRuleCount)
+	if duplicateRuleCount == 0 {
+		duplicateRules := []models.DuplicateRule{
+			{Name: "Accounts with the same website", EntityType: "Account", Field: "Website", Method: models.DuplicateMatchExact, IsActive: true},
+			{Name: "Accounts with the same phone number", EntityType: "Account", Field: "Phone", Method: models.DuplicateMatchExact, IsActive: true},
+			{Name: "Accounts with similar names", EntityType: "Account", Field: "Name", Method: models.DuplicateMatchFuzzy, Threshold: 0.7, IsActive: true},
+			{Name: "Contacts with the same email", EntityType: "Contact", Field: "Email", Method: models.DuplicateMatchExact, IsActive: true},
+			{Name: "Contacts with the same phone number", EntityType: "Contact", Field: "Phone", Method: models.DuplicateMatchExact, IsActive: true},
+			{Name: "Contacts with similar names", EntityType: "Contact", Field: "Name", Method: models.DuplicateMatchFuzzy, Threshold: 0.8, IsActive: true},
+			{Name: "Leads with the same email", EntityType: "Lead", Field: "Email", Method: models.DuplicateMatchExact, IsActive: true},
+			{Name: "Leads with the same phone number", EntityType: "Lead", Field: "Phone", Method: models.DuplicateMatchExact, IsActive: true},
+			{Name: "Leads from similar companies", EntityType: "Lead", Field: "Company", Method: models.DuplicateMatchFuzzy, Threshold: 0.7, IsActive: true},
+		}
+
+		if err := db.Create(&duplicateRules).Error; err != nil {
+			return fmt.Errorf("failed to seed duplicate rules: %w", err)
+		}
+	}
+
+	var leadScoringRuleCount int64
+	db.Model(&models.LeadScoringRule{}).Count(&leadScoringRuleCount)
+	if leadScoringRuleCount == 0 {
+		leadScoringRules := []models.LeadScoringRule{
+			{Name: "Referral", Criterion: models.LeadScoringFieldValue, Field: "Source", Operator: models.LeadScoringEquals, Value: "Referral", Points: 20, IsActive: true},
+			{Name: "Partner", Criterion: models.LeadScoringFieldValue, Field: "Source", Operator: models.LeadScoringEquals, Value: "Partner", Points: 15, IsActive: true},
+			{Name: "Director title", Criterion: models.LeadScoringFieldValue, Field: "Title", Operator: models.LeadScoringContains, Value: "Director", Points: 10, IsActive: true},
+			{Name: "Has website", Criterion: models.LeadScoringFieldValue, Field: "Website", Operator: models.LeadScoringPresent, Points: 5, IsActive: true},
+			{Name: "Free email provider", Criterion: models.LeadScoringEmailDomain, Value: "gmail.com", Points: -10, IsActive: true},
+			{Name: "Meetings", Criterion: models.LeadScoringActivityType, Value: "Meeting", Points: 15, HalfLifeDays: 30, MaxPoints: 45, IsActive: true},
+			{Name: "Recent activity", Criterion: models.LeadScoringRecentActivity, Points: 5, WindowDays: 30, HalfLifeDays: 14, MaxPoints: 25, IsActive: true},
+		}
+
+		if err := db.Create(&leadScoringRules).Error; err != nil {
+			return fmt.Errorf("failed to seed lead scoring rules: %w", err)
+		}
+	}
+
 	log.Println("Database seeding completed successfully")
 	return nil
 }
@@ -0,0 +1,244 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxDateFormat is the number format of date cells in exported workbooks.
+const xlsxDateFormat = "yyyy-mm-dd hh:mm:ss"
+
+// builtInDateFormats are the predefined Excel number formats that display dates or times.
+var builtInDateFormats = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+	27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+	45: true, 46: true, 47: true, 50: true, 51: true, 52: true, 53: true, 54: true, 55: true, 56: true, 57: true, 58: true,
+}
+
+var numberFormatLiterals = regexp.MustCompile(`"[^"]*"|\[[^\]]*\]|\\.`)
+
+// ReadXLSX reads every sheet of a workbook into tables. Date cells are converted to RFC3339 and other
+// cells keep their raw value, so the result can be parsed exactly like a CSV file.
+func ReadXLSX(reader io.Reader) ([]*Table, error) {
+	file, err := excelize.OpenReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse XLSX: %w", err)
+	}
+	defer file.Close()
+
+	dateStyles := make(map[int]bool)
+	isDateStyle := func(styleID int) bool {
+		if cached, ok := dateStyles[styleID]; ok {
+			return cached
+		}
+		isDate := false
+		if style, err := file.GetStyle(styleID); err == nil && style != nil {
+			if style.CustomNumFmt != nil {
+				format := strings.ToLower(numberFormatLiterals.ReplaceAllString(*style.CustomNumFmt, ""))
+				isDate = strings.ContainsAny(format, "ydhs")
+			} else {
+				isDate = builtInDateFormats[style.NumFmt]
+			}
+		}
+		dateStyles[styleID] = isDate
+		return isDate
+	}
+
+	var tables []*Table
+	for _, sheet := range file.GetSheetList() {
+		rows, err := file.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet %s: %w", sheet, err)
+		}
+		for len(rows) > 0 && isBlankRow(rows[len(rows)-1]) {
+			rows = rows[:len(rows)-1]
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		for rowIndex, row := range rows[1:] {
+			for colIndex, value := range row {
+				number, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					continue
+				}
+				cell, err := excelize.CoordinatesToCellName(colIndex+1, rowIndex+2)
+				if err != nil {
+					continue
+				}
+				styleID, err := file.GetCellStyle(sheet, cell)
+				if err != nil || !isDateStyle(styleID) {
+					continue
+				}
+				if date, err := excelize.ExcelDateToTime(number, false); err == nil {
+					row[colIndex] = date.UTC().Format(time.RFC3339)
+				}
+			}
+		}
+
+		headers := make([]string, len(rows[0]))
+		copy(headers, rows[0])
+		tables = append(tables, &Table{Sheet: sheet, Headers: headers, Rows: rows[1:]})
+	}
+
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("XLSX file is empty")
+	}
+	return tables, nil
+}
+
+func isBlankRow(row []string) bool {
+	for _, value := range row {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Cells returns the values of a record for a spreadsheet row. Dates, numbers and booleans keep their type
+// so they become typed cells; enumerations and everything else use the CSV text.
+func (c CSVCodec[T]) Cells(item T) []interface{} {
+	text := c.Record(item)
+	value := reflect.ValueOf(item)
+	timeType := reflect.TypeOf(time.Time{})
+	stringer := reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+	cells := make([]interface{}, len(c.Headers))
+	for idx, header := range c.Headers {
+		cells[idx] = text[idx]
+
+		field := value.FieldByName(header)
+		if !field.IsValid() {
+			continue
+		}
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				cells[idx] = nil
+				continue
+			}
+			field = field.Elem()
+		}
+		if field.Type() == timeType {
+			cells[idx] = field.Interface().(time.Time).UTC()
+			continue
+		}
+		if field.Type().Implements(stringer) {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.Bool:
+			cells[idx] = field.Bool()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			cells[idx] = field.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			cells[idx] = field.Uint()
+		case reflect.Float32, reflect.Float64:
+			cells[idx] = field.Float()
+		}
+	}
+	return cells
+}
+
+// XLSXWriter builds a workbook sheet by sheet using excelize stream writers.
+type XLSXWriter struct {
+	file        *excelize.File
+	dateStyle   int
+	headerStyle int
+	sheets      []*XLSXSheetWriter
+}
+
+// XLSXSheetWriter appends rows to one sheet of a workbook.
+type XLSXSheetWriter struct {
+	writer    *excelize.StreamWriter
+	dateStyle int
+	row       int
+}
+
+// NewXLSXWriter creates an empty workbook.
+func NewXLSXWriter() (*XLSXWriter, error) {
+	file := excelize.NewFile()
+
+	dateFormat := xlsxDateFormat
+	dateStyle, err := file.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+	if err != nil {
+		return nil, err
+	}
+	headerStyle, err := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &XLSXWriter{file: file, dateStyle: dateStyle, headerStyle: headerStyle}, nil
+}
+
+// AddSheet adds a sheet and writes its header row.
+func (w *XLSXWriter) AddSheet(name string, headers []string) (*XLSXSheetWriter, error) {
+	if len(w.sheets) == 0 {
+		if err := w.file.SetSheetName(w.file.GetSheetName(0), name); err != nil {
+			return nil, err
+		}
+	} else if _, err := w.file.NewSheet(name); err != nil {
+		return nil, err
+	}
+
+	stream, err := w.file.NewStreamWriter(name)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]interface{}, len(headers))
+	for idx, name := range headers {
+		header[idx] = excelize.Cell{StyleID: w.headerStyle, Value: name}
+	}
+	if err := stream.SetRow("A1", header); err != nil {
+		return nil, err
+	}
+
+	sheet := &XLSXSheetWriter{writer: stream, dateStyle: w.dateStyle, row: 1}
+	w.sheets = append(w.sheets, sheet)
+	return sheet, nil
+}
+
+// WriteRow appends a row of cell values. Times are written as dates.
+func (s *XLSXSheetWriter) WriteRow(values []interface{}) error {
+	cells := make([]interface{}, len(values))
+	for idx, value := range values {
+		if date, ok := value.(time.Time); ok {
+			cells[idx] = excelize.Cell{StyleID: s.dateStyle, Value: date}
+			continue
+		}
+		cells[idx] = value
+	}
+
+	s.row++
+	cell, err := excelize.CoordinatesToCellName(1, s.row)
+	if err != nil {
+		return err
+	}
+	return s.writer.SetRow(cell, cells)
+}
+
+// WriteTo finishes every sheet and writes the workbook.
+func (w *XLSXWriter) WriteTo(out io.Writer) (int64, error) {
+	for _, sheet := range w.sheets {
+		if err := sheet.writer.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return w.file.WriteTo(out)
+}
+
+// Close releases temporary files used by the stream writers.
+func (w *XLSXWriter) Close() error {
+	return w.file.Close()
+}
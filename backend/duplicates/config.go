@@ -0,0 +1,41 @@
+package duplicates
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds the settings of the duplicate detector.
+type Config struct {
+	// ScanInterval is how often the scheduled scan refreshes the duplicate queue. Zero disables the scan.
+	ScanInterval time.Duration
+}
+
+// DefaultConfig returns the settings used when no environment overrides are set.
+func DefaultConfig() Config {
+	return Config{
+		ScanInterval: 24 * time.Hour,
+	}
+}
+
+// ConfigFromEnv reads the detector settings from DUPLICATE_* environment variables, falling back to DefaultConfig.
+func ConfigFromEnv() Config {
+	config := DefaultConfig()
+	config.ScanInterval = time.Duration(envInt("DUPLICATE_SCAN_INTERVAL_MINUTES", int(config.ScanInterval/time.Minute))) * time.Minute
+	return config
+}
+
+func envInt(key string, defaultValue int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		log.Printf("ignoring invalid %s value %q", key, raw)
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,227 @@
+package duplicates
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+// Probe holds the values of a record that is checked for duplicates, keyed by the fields of
+// models.DuplicateRuleFields. ID is the record's own ID, which never matches itself, or zero for new records.
+type Probe struct {
+	ID     uint
+	Values map[string]string
+}
+
+// Match is an existing record that may duplicate a probe.
+type Match struct {
+	EntityType string  `json:"EntityType"`
+	ID         uint    `json:"ID"`
+	Name       string  `json:"Name"`
+	Score      float64 `json:"Score"`
+	// Fields lists the compared fields that matched, in the order of Reasons.
+	Fields  []string `json:"Fields"`
+	Reasons []string `json:"Reasons"`
+}
+
+// Pair is two probes of one batch that may duplicate each other. Earlier is the index of the first of them.
+type Pair struct {
+	Index   int
+	Earlier int
+	Fields  []string
+	Reasons []string
+}
+
+// maxMatchesPerRule limits the records one rule reports for a probe.
+const maxMatchesPerRule = 10
+
+// Supports reports whether duplicate detection is available for an entity type.
+func Supports(entityType string) bool {
+	_, ok := entities[entityType]
+	return ok
+}
+
+// ProbeOf returns the entity type and compared values of an account, contact or lead.
+func ProbeOf(record interface{}) (string, Probe, bool) {
+	switch value := record.(type) {
+	case *models.Account:
+		return "Account", Probe{ID: value.ID, Values: map[string]string{
+			"Name": value.Name, "Email": value.Email, "Phone": value.Phone, "Website": value.Website,
+		}}, true
+	case *models.Contact:
+		return "Contact", Probe{ID: value.ID, Values: map[string]string{
+			"Name": value.FirstName + " " + value.LastName, "Email": value.Email, "Phone": value.Phone,
+		}}, true
+	case *models.Lead:
+		return "Lead", Probe{ID: value.ID, Values: map[string]string{
+			"Name": value.Name, "Email": value.Email, "Phone": value.Phone, "Website": value.Website, "Company": value.Company,
+		}}, true
+	}
+	return "", Probe{}, false
+}
+
+// probeRow is one probe value passed to PostgreSQL.
+type probeRow struct {
+	Index int    `json:"idx"`
+	Value string `json:"value"`
+	ID    uint   `json:"id"`
+}
+
+// probeRows returns the non-empty values of field as a JSON array for json_to_recordset.
+func probeRows(probes []Probe, field string) (string, bool, error) {
+	rows := make([]probeRow, 0, len(probes))
+	for idx, probe := range probes {
+		if value := strings.TrimSpace(probe.Values[field]); value != "" {
+			rows = append(rows, probeRow{Index: idx, Value: value, ID: probe.ID})
+		}
+	}
+	if len(rows) == 0 {
+		return "", false, nil
+	}
+	data, err := json.Marshal(rows)
+	return string(data), true, err
+}
+
+const probeRecordset = "json_to_recordset(?::json) AS %s(idx int, value text, id bigint)"
+
+// Find returns the existing records that may duplicate each probe under the active rules of the entity type,
+// strongest first. The result holds one slice per probe.
+func Find(db *gorm.DB, entityType string, probes []Probe) ([][]Match, error) {
+	e, ok := entities[entityType]
+	if !ok {
+		return nil, fmt.Errorf("duplicate detection does not support %q", entityType)
+	}
+	rules, err := activeRules(db, entityType)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]map[uint]*Match, len(probes))
+	for _, rule := range rules {
+		values, ok, err := probeRows(probes, rule.Field)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		where, score := condition(rule, normalized(rule.Field, e.column(rule.Field, "t")), normalized(rule.Field, "p.value"))
+		query := "SELECT p.idx AS probe, m.id, m.name, m.score FROM " + fmt.Sprintf(probeRecordset, "p") +
+			" CROSS JOIN LATERAL (SELECT t.id, " + e.display("t") + " AS name, " + score + " AS score FROM " + e.Table + " t" +
+			" WHERE " + where + " AND t.id <> p.id ORDER BY score DESC, t.id LIMIT ?) m"
+
+		var rows []struct {
+			Probe int
+			ID    uint
+			Name  string
+			Score float64
+		}
+		err = withThreshold(db, rule, func(tx *gorm.DB) error {
+			return tx.Raw(query, values, maxMatchesPerRule).Scan(&rows).Error
+		})
+		if err != nil {
+			return nil, fmt.Errorf("duplicate rule %d failed: %w", rule.ID, err)
+		}
+
+		for _, row := range rows {
+			if found[row.Probe] == nil {
+				found[row.Probe] = make(map[uint]*Match)
+			}
+			match, ok := found[row.Probe][row.ID]
+			if !ok {
+				match = &Match{EntityType: entityType, ID: row.ID, Name: row.Name}
+				found[row.Probe][row.ID] = match
+			}
+			if row.Score > match.Score {
+				match.Score = row.Score
+			}
+			match.Fields = append(match.Fields, rule.Field)
+			match.Reasons = append(match.Reasons, reason(rule, row.Score))
+		}
+	}
+
+	result := make([][]Match, len(probes))
+	for idx, matches := range found {
+		for _, match := range matches {
+			result[idx] = append(result[idx], *match)
+		}
+		sort.Slice(result[idx], func(i, j int) bool {
+			if result[idx][i].Score != result[idx][j].Score {
+				return result[idx][i].Score > result[idx][j].Score
+			}
+			return result[idx][i].ID < result[idx][j].ID
+		})
+	}
+	return result, nil
+}
+
+// FindWithin returns the pairs of probes that duplicate each other under the active exact rules of the entity type,
+// such as two rows of an import file with the same email. Fuzzy rules are skipped because comparing every pair of a
+// large batch by similarity is too slow.
+func FindWithin(db *gorm.DB, entityType string, probes []Probe) ([]Pair, error) {
+	if _, ok := entities[entityType]; !ok {
+		return nil, fmt.Errorf("duplicate detection does not support %q", entityType)
+	}
+	rules, err := activeRules(db, entityType)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ index, earlier int }
+	pairs := make(map[key]*Pair)
+	var order []key
+	for _, rule := range rules {
+		if rule.Method != models.DuplicateMatchExact {
+			continue
+		}
+		values, ok, err := probeRows(probes, rule.Field)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		// Each probe is paired with the first earlier probe it matches only
+		where, _ := condition(rule, normalized(rule.Field, "p.value"), normalized(rule.Field, "q.value"))
+		query := "SELECT p.idx, MIN(q.idx) AS earlier FROM " + fmt.Sprintf(probeRecordset, "p") +
+			" JOIN " + fmt.Sprintf(probeRecordset, "q") + " ON q.idx < p.idx AND " + where + " GROUP BY p.idx"
+
+		var rows []struct {
+			Idx     int
+			Earlier int
+		}
+		if err := db.Raw(query, values, values).Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("duplicate rule %d failed: %w", rule.ID, err)
+		}
+
+		for _, row := range rows {
+			k := key{row.Idx, row.Earlier}
+			pair, ok := pairs[k]
+			if !ok {
+				pair = &Pair{Index: row.Idx, Earlier: row.Earlier}
+				pairs[k] = pair
+				order = append(order, k)
+			}
+			pair.Fields = append(pair.Fields, rule.Field)
+			pair.Reasons = append(pair.Reasons, reason(rule, 1))
+		}
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].index != order[j].index {
+			return order[i].index < order[j].index
+		}
+		return order[i].earlier < order[j].earlier
+	})
+	result := make([]Pair, 0, len(order))
+	for _, k := range order {
+		result = append(result, *pairs[k])
+	}
+	return result, nil
+}
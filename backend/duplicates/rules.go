@@ -0,0 +1,168 @@
+package duplicates
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+// entity describes how records of one entity type are compared. SQL fragments refer to the compared table
+// through the alias given as %[1]s.
+type entity struct {
+	Table string
+	// Display names a record in matches, for example the account name.
+	Display string
+	// Columns maps the fields of models.DuplicateRuleFields to the SQL holding their value.
+	Columns map[string]string
+}
+
+var entities = map[string]entity{
+	"Account": {
+		Table:   "accounts",
+		Display: "%[1]s.name",
+		Columns: map[string]string{
+			"Name":    "%[1]s.name",
+			"Email":   "%[1]s.email",
+			"Phone":   "%[1]s.phone",
+			"Website": "%[1]s.website",
+		},
+	},
+	"Contact": {
+		Table:   "contacts",
+		Display: "%[1]s.first_name || ' ' || %[1]s.last_name",
+		Columns: map[string]string{
+			"Name":  "%[1]s.first_name || ' ' || %[1]s.last_name",
+			"Email": "%[1]s.email",
+			"Phone": "%[1]s.phone",
+		},
+	},
+	"Lead": {
+		Table:   "leads",
+		Display: "%[1]s.name",
+		Columns: map[string]string{
+			"Name":    "%[1]s.name",
+			"Email":   "%[1]s.email",
+			"Phone":   "%[1]s.phone",
+			"Website": "%[1]s.website",
+			"Company": "%[1]s.company",
+		},
+	},
+}
+
+// normalizer turns the value of a field into the form that is compared. Expression and Valid are SQL with the
+// value as %s; values failing Valid, such as phone numbers with too few digits, never match.
+type normalizer struct {
+	Expression string
+	Valid      string
+}
+
+// normalizers must not contain question marks, which GORM would take for parameters.
+var normalizers = map[string]normalizer{
+	"Name":    {Expression: "lower(btrim(%s))", Valid: "length(%s) >= 3"},
+	"Company": {Expression: "lower(btrim(%s))", Valid: "length(%s) >= 3"},
+	"Email":   {Expression: "lower(btrim(%s))", Valid: "position('@' in %s) > 1"},
+	"Phone":   {Expression: "regexp_replace(%s, '[^0-9]', '', 'g')", Valid: "length(%s) >= 7"},
+	// Websites are compared by domain, so https://www.acme.com/about matches acme.com
+	"Website": {Expression: `regexp_replace(lower(btrim(%s)), '^([a-z][a-z0-9+.-]*://){0,1}(www[.]){0,1}([a-z0-9.-]*).*$', '\3')`, Valid: "position('.' in %s) > 1"},
+}
+
+// normalized returns the SQL of the compared form of a field, given the SQL of its raw value.
+func normalized(field, value string) string {
+	return fmt.Sprintf(normalizers[field].Expression, "coalesce("+value+", '')")
+}
+
+// column returns the SQL of a field of the table aliased as alias.
+func (e entity) column(field, alias string) string {
+	return fmt.Sprintf(e.Columns[field], alias)
+}
+
+func (e entity) display(alias string) string {
+	return fmt.Sprintf(e.Display, alias)
+}
+
+// condition returns the SQL matching two normalized values under a rule, and the SQL of the match score.
+func condition(rule models.DuplicateRule, left, right string) (string, string) {
+	valid := normalizers[rule.Field].Valid
+	both := fmt.Sprintf(valid, left) + " AND " + fmt.Sprintf(valid, right)
+	if rule.Method == models.DuplicateMatchFuzzy {
+		return left + " % " + right + " AND " + both, "similarity(" + left + ", " + right + ")"
+	}
+	return left + " = " + right + " AND " + both, "1.0"
+}
+
+// reason explains a match of a rule with the given score.
+func reason(rule models.DuplicateRule, score float64) string {
+	if rule.Method == models.DuplicateMatchFuzzy {
+		return fmt.Sprintf("%s is %d%% similar", rule.Field, int(math.Round(score*100)))
+	}
+	return rule.Field + " matches"
+}
+
+// withThreshold runs fn in a transaction whose trigram similarity threshold is the rule's, so the % operator of
+// fuzzy rules matches exactly the pairs at or above it.
+func withThreshold(db *gorm.DB, rule models.DuplicateRule, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if rule.Method == models.DuplicateMatchFuzzy {
+			threshold := strconv.FormatFloat(rule.Threshold, 'f', -1, 64)
+			if err := tx.Exec("SELECT set_config('pg_trgm.similarity_threshold', ?, true)", threshold).Error; err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+// activeRules returns the active rules of an entity type whose field the detector knows.
+func activeRules(db *gorm.DB, entityType string) ([]models.DuplicateRule, error) {
+	var rules []models.DuplicateRule
+	if err := db.Where("entity_type = ? AND is_active = ?", entityType, true).Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	known := entities[entityType]
+	usable := rules[:0]
+	for _, rule := range rules {
+		if _, ok := known.Columns[rule.Field]; ok {
+			usable = append(usable, rule)
+		}
+	}
+	return usable, nil
+}
+
+// Migrate enables pg_trgm and creates the trigram indexes fuzzy rules search with. It is idempotent.
+func Migrate(db *gorm.DB) error {
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		return fmt.Errorf("failed to enable pg_trgm: %w", err)
+	}
+
+	for _, entityType := range entityTypes() {
+		e := entities[entityType]
+		for _, field := range []string{"Name", "Company"} {
+			if _, ok := e.Columns[field]; !ok {
+				continue
+			}
+			index := fmt.Sprintf("idx_%s_%s_trgm", e.Table, strings.ToLower(field))
+			statement := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING gin ((%s) gin_trgm_ops)",
+				index, e.Table, normalized(field, e.column(field, e.Table)))
+			if err := db.Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to create %s: %w", index, err)
+			}
+		}
+	}
+	return nil
+}
+
+// entityTypes returns the entity types duplicate detection supports, in a stable order.
+func entityTypes() []string {
+	types := make([]string, 0, len(entities))
+	for entityType := range entities {
+		types = append(types, entityType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,208 @@
+package duplicates
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const candidateBatchSize = 500
+
+// ScanResult reports the outcome of a duplicate scan.
+type ScanResult struct {
+	StartedAt time.Time `json:"StartedAt"`
+	// Found counts the pairs matched by the active rules, including ones already in the queue.
+	Found int `json:"Found"`
+	// Resolved counts open candidates removed because their records no longer match.
+	Resolved int `json:"Resolved"`
+}
+
+// Detector runs the scheduled scan that keeps the duplicate queue up to date.
+type Detector struct {
+	db     *gorm.DB
+	config Config
+	stop   chan struct{}
+	once   sync.Once
+	// scanning serializes scans, so a manual scan does not overlap a scheduled one.
+	scanning sync.Mutex
+}
+
+// NewDetector constructs a duplicate detector bound to the provided database connection.
+func NewDetector(db *gorm.DB, config Config) *Detector {
+	return &Detector{
+		db:     db,
+		config: config,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start launches the scheduled scan.
+func (d *Detector) Start() {
+	d.once.Do(func() {
+		go d.monitor()
+	})
+}
+
+// Stop signals the scheduled scan to exit.
+func (d *Detector) Stop() {
+	close(d.stop)
+}
+
+func (d *Detector) monitor() {
+	if d.config.ScanInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(d.config.ScanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			result, err := d.Scan(context.Background())
+			if err != nil {
+				log.Printf("duplicate scan failed: %v", err)
+				continue
+			}
+			log.Printf("duplicate scan found %d pairs and resolved %d", result.Found, result.Resolved)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// scanPair is a pair of records matched by a scan.
+type scanPair struct {
+	RecordID    uint
+	DuplicateID uint
+	Score       float64
+	Reasons     []string
+}
+
+// Scan compares every account, contact and lead with the others of its type under the active rules and stores the
+// matching pairs as duplicate candidates. New pairs are queued as Open. Pairs already queued get their score and
+// reasons refreshed but keep their status, so dismissed pairs stay dismissed. Open candidates whose records no longer
+// match, for example because one was edited or deleted, are removed.
+func (d *Detector) Scan(ctx context.Context) (*ScanResult, error) {
+	d.scanning.Lock()
+	defer d.scanning.Unlock()
+
+	// PostgreSQL keeps microseconds, so refreshed candidates must not appear older than the scan
+	result := &ScanResult{StartedAt: time.Now().UTC().Truncate(time.Microsecond)}
+	db := d.db.WithContext(ctx)
+	for _, entityType := range entityTypes() {
+		pairs, err := scanEntity(db, entityType)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", strings.ToLower(entityType), err)
+		}
+		result.Found += len(pairs)
+
+		resolved, err := storeCandidates(db, entityType, pairs, result.StartedAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", strings.ToLower(entityType), err)
+		}
+		result.Resolved += resolved
+	}
+	return result, nil
+}
+
+// scanEntity returns the pairs of records of one entity type matched by its active rules.
+func scanEntity(db *gorm.DB, entityType string) ([]*scanPair, error) {
+	e := entities[entityType]
+	rules, err := activeRules(db, entityType)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct{ record, duplicate uint }
+	pairs := make(map[key]*scanPair)
+	var order []key
+	for _, rule := range rules {
+		where, score := condition(rule, normalized(rule.Field, e.column(rule.Field, "a")), normalized(rule.Field, e.column(rule.Field, "b")))
+		query := "SELECT a.id AS record_id, b.id AS duplicate_id, " + score + " AS score FROM " + e.Table + " a" +
+			" JOIN " + e.Table + " b ON a.id < b.id AND " + where
+
+		var rows []struct {
+			RecordID    uint
+			DuplicateID uint
+			Score       float64
+		}
+		err := withThreshold(db, rule, func(tx *gorm.DB) error {
+			return tx.Raw(query).Scan(&rows).Error
+		})
+		if err != nil {
+			return nil, fmt.Errorf("duplicate rule %d failed: %w", rule.ID, err)
+		}
+
+		for _, row := range rows {
+			k := key{row.RecordID, row.DuplicateID}
+			pair, ok := pairs[k]
+			if !ok {
+				pair = &scanPair{RecordID: row.RecordID, DuplicateID: row.DuplicateID}
+				pairs[k] = pair
+				order = append(order, k)
+			}
+			if row.Score > pair.Score {
+				pair.Score = row.Score
+			}
+			pair.Reasons = append(pair.Reasons, reason(rule, row.Score))
+		}
+	}
+
+	result := make([]*scanPair, 0, len(order))
+	for _, k := range order {
+		result = append(result, pairs[k])
+	}
+	return result, nil
+}
+
+// storeCandidates upserts the pairs of a scan and removes the open candidates of the entity type it did not find
+// again. It returns how many candidates were removed.
+func storeCandidates(db *gorm.DB, entityType string, pairs []*scanPair, detectedAt time.Time) (int, error) {
+	var resolved int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(pairs); start += candidateBatchSize {
+			end := start + candidateBatchSize
+			if end > len(pairs) {
+				end = len(pairs)
+			}
+
+			batch := make([]models.DuplicateCandidate, 0, end-start)
+			for _, pair := range pairs[start:end] {
+				batch = append(batch, models.DuplicateCandidate{
+					EntityType:  entityType,
+					RecordID:    pair.RecordID,
+					DuplicateID: pair.DuplicateID,
+					Score:       pair.Score,
+					Reasons:     strings.Join(pair.Reasons, "; "),
+					Status:      models.DuplicateCandidateOpen,
+					DetectedAt:  detectedAt,
+				})
+			}
+
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "entity_type"}, {Name: "record_id"}, {Name: "duplicate_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"score", "reasons", "detected_at", "updated_at"}),
+			}).Create(&batch).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		deleted := tx.Where("entity_type = ? AND status = ? AND detected_at < ?", entityType, models.DuplicateCandidateOpen, detectedAt).
+			Delete(&models.DuplicateCandidate{})
+		if deleted.Error != nil {
+			return deleted.Error
+		}
+		resolved = deleted.RowsAffected
+		return nil
+	})
+	return int(resolved), err
+}
@@ -1,9 +1,20 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"gorm.io/gorm"
 )
 
+// AccountLifecycleStages lists the lifecycle stages an account can be in, from first contact to churn risk.
+var AccountLifecycleStages = []string{"Prospect", "Qualified", "Customer", "Churn Risk"}
+
+// DefaultAccountLifecycleStage is the stage of accounts created without one.
+const DefaultAccountLifecycleStage = "Prospect"
+
 // Account represents a customer or business account in the CRM
 type Account struct {
 	ID             uint      `json:"ID" gorm:"primaryKey" odata:"key"`
@@ -30,7 +41,7 @@ type Account struct {
 	Tasks         []Task        `json:"Tasks" gorm:"foreignKey:AccountID" odata:"navigation"`
 	Opportunities []Opportunity `json:"Opportunities" gorm:"foreignKey:AccountID" odata:"navigation"`
 	Employee      *Employee     `json:"Employee" gorm:"foreignKey:EmployeeID" odata:"navigation"`
-	Tags          []Tag         `json:"Tags" gorm:"many2many:account_tags;constraint:OnDelete:CASCADE" odata:"navigation"`
+	Tags          []Tag         `json:"Tags" gorm:"many2many:account_tags;constraint:OnDelete:CASCADE" odata:"navigation" csv:"names"`
 }
 
 // TableName specifies the table name for GORM
@@ -38,6 +49,36 @@ func (Account) TableName() string {
 	return "accounts"
 }
 
+// BeforeSave links tags given by name. Tags without an ID are matched to an existing tag ignoring case,
+// or created, so imports can attach tags without knowing their IDs.
+func (account *Account) BeforeSave(tx *gorm.DB) error {
+	for idx := range account.Tags {
+		tag := &account.Tags[idx]
+		if tag.ID != 0 {
+			continue
+		}
+		tag.Name = strings.TrimSpace(tag.Name)
+		if tag.Name == "" {
+			return fmt.Errorf("tag name is required")
+		}
+
+		session := tx.Session(&gorm.Session{NewDB: true})
+		var existing Tag
+		err := session.Where("LOWER(name) = LOWER(?)", tag.Name).First(&existing).Error
+		switch {
+		case err == nil:
+			*tag = existing
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := session.Create(tag).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
 // Tag represents a reusable label that can be linked to accounts for segmentation
 type Tag struct {
 	ID        uint      `json:"ID" gorm:"primaryKey" odata:"key"`
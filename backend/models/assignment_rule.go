@@ -0,0 +1,150 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AssignmentStrategy determines how an owner is picked among a rule's eligible employees.
+type AssignmentStrategy string
+
+const (
+	// AssignmentStrategyRoundRobin rotates through the eligible employees in order.
+	AssignmentStrategyRoundRobin AssignmentStrategy = "RoundRobin"
+	// AssignmentStrategyLeastOpenWorkload picks the employee with the fewest open records of the same type.
+	AssignmentStrategyLeastOpenWorkload AssignmentStrategy = "LeastOpenWorkload"
+	// AssignmentStrategyTerritory rotates through employees whose Territory covers the record's country.
+	AssignmentStrategyTerritory AssignmentStrategy = "Territory"
+)
+
+// AssignmentRule routes new leads, accounts and issues without an owner to an employee.
+// Rules are evaluated by SortOrder and the first matching rule that finds an employee wins.
+// Empty criteria match every record.
+type AssignmentRule struct {
+	ID          uint               `json:"ID" gorm:"primaryKey" odata:"key"`
+	Name        string             `json:"Name" gorm:"type:varchar(150);not null" odata:"required,maxlength(150)"`
+	Description string             `json:"Description" gorm:"type:text"`
+	EntityType  string             `json:"EntityType" gorm:"type:varchar(100);not null;index" odata:"required,maxlength(100)"`
+	SortOrder   int                `json:"SortOrder" gorm:"not null;default:0"`
+	Strategy    AssignmentStrategy `json:"Strategy" gorm:"type:varchar(50);not null" odata:"required,maxlength(50)"`
+
+	// Criteria
+	Source        string         `json:"Source" gorm:"type:varchar(100)" odata:"maxlength(100)"`
+	Country       string         `json:"Country" gorm:"type:varchar(100)" odata:"maxlength(100)"`
+	Industry      string         `json:"Industry" gorm:"type:varchar(100)" odata:"maxlength(100)"`
+	IssuePriority *IssuePriority `json:"IssuePriority"`
+
+	// EmployeeIDs lists the eligible employees in rotation order. Territory rules may leave it empty to consider everyone.
+	EmployeeIDs            []uint    `json:"EmployeeIDs" gorm:"type:jsonb;serializer:json"`
+	LastAssignedEmployeeID *uint     `json:"LastAssignedEmployeeID"`
+	IsActive               bool      `json:"IsActive" gorm:"not null;default:true"`
+	CreatedAt              time.Time `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt              time.Time `json:"UpdatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (AssignmentRule) TableName() string {
+	return "assignment_rules"
+}
+
+// BeforeSave validates the entity type, strategy and criteria
+func (rule *AssignmentRule) BeforeSave(tx *gorm.DB) error {
+	pending, err := withPendingUpdates(tx, rule)
+	if err != nil {
+		return err
+	}
+
+	switch pending.EntityType {
+	case "Lead":
+		if pending.Country != "" || pending.Industry != "" {
+			return fmt.Errorf("lead assignment rules can only match on Source")
+		}
+		if pending.Strategy == AssignmentStrategyTerritory {
+			return fmt.Errorf("territory assignment requires a country and is not available for leads")
+		}
+	case "Account", "Issue":
+		if pending.Source != "" {
+			return fmt.Errorf("Source can only be used by lead assignment rules")
+		}
+	default:
+		return fmt.Errorf("assignment rules support Lead, Account and Issue, not %q", pending.EntityType)
+	}
+
+	if pending.IssuePriority != nil {
+		if pending.EntityType != "Issue" {
+			return fmt.Errorf("IssuePriority can only be used by issue assignment rules")
+		}
+		if *pending.IssuePriority < IssuePriorityLow || *pending.IssuePriority > IssuePriorityCritical {
+			return fmt.Errorf("invalid issue priority: %d", *pending.IssuePriority)
+		}
+	}
+
+	switch pending.Strategy {
+	case AssignmentStrategyRoundRobin, AssignmentStrategyLeastOpenWorkload:
+		if len(pending.EmployeeIDs) == 0 {
+			return fmt.Errorf("%s assignment requires at least one employee", pending.Strategy)
+		}
+	case AssignmentStrategyTerritory:
+	default:
+		return fmt.Errorf("invalid assignment strategy: %q", pending.Strategy)
+	}
+
+	if len(pending.EmployeeIDs) > 0 {
+		var count int64
+		if err := tx.Session(&gorm.Session{NewDB: true}).Model(&Employee{}).Where("id IN ?", pending.EmployeeIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(uniqueUints(pending.EmployeeIDs)) {
+			return fmt.Errorf("assignment rule references employees that do not exist")
+		}
+	}
+
+	return nil
+}
+
+// Matches reports whether the rule criteria accept the given record attributes.
+func (rule *AssignmentRule) Matches(source, country, industry string, priority IssuePriority) bool {
+	if rule.Source != "" && !strings.EqualFold(strings.TrimSpace(rule.Source), strings.TrimSpace(source)) {
+		return false
+	}
+	if rule.Country != "" && !strings.EqualFold(strings.TrimSpace(rule.Country), strings.TrimSpace(country)) {
+		return false
+	}
+	if rule.Industry != "" && !strings.EqualFold(strings.TrimSpace(rule.Industry), strings.TrimSpace(industry)) {
+		return false
+	}
+	if rule.IssuePriority != nil && *rule.IssuePriority != priority {
+		return false
+	}
+	return true
+}
+
+// CoversTerritory reports whether a comma separated territory list contains the country.
+func CoversTerritory(territory, country string) bool {
+	country = strings.TrimSpace(country)
+	if country == "" {
+		return false
+	}
+	for _, entry := range strings.Split(territory, ",") {
+		if strings.EqualFold(strings.TrimSpace(entry), country) {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueUints(values []uint) []uint {
+	seen := make(map[uint]struct{}, len(values))
+	unique := make([]uint, 0, len(values))
+	for _, value := range values {
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		unique = append(unique, value)
+	}
+	return unique
+}
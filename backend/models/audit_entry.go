@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// AuditAction names a change recorded in the audit trail.
+type AuditAction string
+
+const (
+	// AuditActionMerge records another record merged into the entry's record.
+	AuditActionMerge AuditAction = "Merge"
+)
+
+// AuditEntry records a change to a record that cannot be reconstructed from the record itself, such as a duplicate
+// that was merged into it and deleted.
+type AuditEntry struct {
+	ID         uint        `json:"ID" gorm:"primaryKey" odata:"key"`
+	EntityType string      `json:"EntityType" gorm:"type:varchar(100);not null;index:idx_audit_entries_entity,priority:1" odata:"required,maxlength(100)"`
+	EntityID   uint        `json:"EntityID" gorm:"not null;index:idx_audit_entries_entity,priority:2" odata:"required"`
+	Action     AuditAction `json:"Action" gorm:"type:varchar(50);not null" odata:"required,maxlength(50)"`
+	// RelatedID is the other record involved in the change, for merges the record that was merged away.
+	RelatedID *uint  `json:"RelatedID" gorm:"index"`
+	Summary   string `json:"Summary" gorm:"type:text"`
+	// Details holds the change as JSON, for merges the merged record as it was and the references moved from it.
+	Details   string    `json:"Details" gorm:"type:text"`
+	CreatedAt time.Time `json:"CreatedAt" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (AuditEntry) TableName() string {
+	return "audit_entries"
+}
@@ -7,7 +7,7 @@ import (
 // Contact represents a person associated with an account
 type Contact struct {
 	ID        uint      `json:"ID" gorm:"primaryKey" odata:"key"`
-	AccountID uint      `json:"AccountID" gorm:"not null;index" odata:"required"`
+	AccountID uint      `json:"AccountID" gorm:"not null;index" odata:"required" csv:"key=AccountName"`
 	FirstName string    `json:"FirstName" gorm:"not null;type:varchar(100)" odata:"required,maxlength(100)"`
 	LastName  string    `json:"LastName" gorm:"not null;type:varchar(100)" odata:"required,maxlength(100)"`
 	Title     string    `json:"Title" gorm:"type:varchar(100)" odata:"maxlength(100)"`
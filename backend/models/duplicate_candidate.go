@@ -0,0 +1,70 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DuplicateCandidateStatus tracks the review of a possible duplicate.
+type DuplicateCandidateStatus string
+
+const (
+	// DuplicateCandidateOpen awaits review.
+	DuplicateCandidateOpen DuplicateCandidateStatus = "Open"
+	// DuplicateCandidateDismissed was reviewed and the records are distinct. Later scans do not reopen it.
+	DuplicateCandidateDismissed DuplicateCandidateStatus = "Dismissed"
+	// DuplicateCandidateMerged was resolved by merging the records.
+	DuplicateCandidateMerged DuplicateCandidateStatus = "Merged"
+)
+
+// DuplicateCandidate is a pair of accounts, contacts or leads found by the scheduled duplicate scan.
+// RecordID is always the lower of the two IDs, so every pair is stored once.
+type DuplicateCandidate struct {
+	ID          uint   `json:"ID" gorm:"primaryKey" odata:"key"`
+	EntityType  string `json:"EntityType" gorm:"type:varchar(100);not null;uniqueIndex:idx_duplicate_candidates_pair,priority:1" odata:"required,maxlength(100)"`
+	RecordID    uint   `json:"RecordID" gorm:"not null;uniqueIndex:idx_duplicate_candidates_pair,priority:2" odata:"required"`
+	DuplicateID uint   `json:"DuplicateID" gorm:"not null;uniqueIndex:idx_duplicate_candidates_pair,priority:3" odata:"required"`
+	// Score is the strongest match between the records, 1 for exact matches and the similarity for fuzzy ones.
+	Score float64 `json:"Score" gorm:"not null;default:0"`
+	// Reasons explains which rules matched, for example "Email matches; Name is 87% similar".
+	Reasons    string                   `json:"Reasons" gorm:"type:text"`
+	Status     DuplicateCandidateStatus `json:"Status" gorm:"type:varchar(50);not null;default:'Open';index" odata:"maxlength(50)"`
+	DetectedAt time.Time                `json:"DetectedAt" gorm:"not null"`
+	ReviewedAt *time.Time               `json:"ReviewedAt"`
+	CreatedAt  time.Time                `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time                `json:"UpdatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (DuplicateCandidate) TableName() string {
+	return "duplicate_candidates"
+}
+
+// BeforeSave validates the status and records when a candidate was detected and reviewed
+func (candidate *DuplicateCandidate) BeforeSave(tx *gorm.DB) error {
+	pending, err := withPendingUpdates(tx, candidate)
+	if err != nil {
+		return err
+	}
+
+	if pending.DetectedAt.IsZero() {
+		tx.Statement.SetColumn("DetectedAt", time.Now().UTC())
+	}
+
+	switch pending.Status {
+	case "", DuplicateCandidateOpen:
+		if pending.ReviewedAt != nil {
+			tx.Statement.SetColumn("ReviewedAt", nil)
+		}
+	case DuplicateCandidateDismissed, DuplicateCandidateMerged:
+		if pending.ReviewedAt == nil {
+			tx.Statement.SetColumn("ReviewedAt", time.Now().UTC())
+		}
+	default:
+		return fmt.Errorf("invalid duplicate candidate status: %q", pending.Status)
+	}
+
+	return nil
+}
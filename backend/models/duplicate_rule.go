@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DuplicateMatchMethod determines how a duplicate rule compares the values of two records.
+type DuplicateMatchMethod string
+
+const (
+	// DuplicateMatchExact matches records whose normalized values are equal.
+	DuplicateMatchExact DuplicateMatchMethod = "Exact"
+	// DuplicateMatchFuzzy matches records whose normalized values have a trigram similarity of at least the threshold.
+	DuplicateMatchFuzzy DuplicateMatchMethod = "Fuzzy"
+)
+
+// DuplicateRuleFields lists the fields duplicate rules can compare, by entity type. Emails are compared ignoring
+// case, phone numbers by their digits and websites by their domain.
+var DuplicateRuleFields = map[string][]string{
+	"Account": {"Name", "Email", "Phone", "Website"},
+	"Contact": {"Name", "Email", "Phone"},
+	"Lead":    {"Name", "Email", "Phone", "Website", "Company"},
+}
+
+// duplicateFuzzyFields lists the fields whose values are free text and can be compared by similarity.
+var duplicateFuzzyFields = []string{"Name", "Company"}
+
+// DefaultDuplicateThreshold is the similarity fuzzy rules use when none is given.
+const DefaultDuplicateThreshold = 0.6
+
+// DuplicateRule flags two accounts, contacts or leads as possible duplicates when one of their fields matches.
+// A pair is reported once, with the reasons of every active rule that matched it.
+type DuplicateRule struct {
+	ID         uint                 `json:"ID" gorm:"primaryKey" odata:"key"`
+	Name       string               `json:"Name" gorm:"type:varchar(150);not null" odata:"required,maxlength(150)"`
+	EntityType string               `json:"EntityType" gorm:"type:varchar(100);not null;index" odata:"required,maxlength(100)"`
+	Field      string               `json:"Field" gorm:"type:varchar(100);not null" odata:"required,maxlength(100)"`
+	Method     DuplicateMatchMethod `json:"Method" gorm:"type:varchar(50);not null;default:'Exact'" odata:"maxlength(50)"`
+	// Threshold is the lowest trigram similarity, between 0 and 1, at which a fuzzy rule matches.
+	Threshold float64   `json:"Threshold" gorm:"not null;default:0"`
+	IsActive  bool      `json:"IsActive" gorm:"not null;default:true"`
+	CreatedAt time.Time `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"UpdatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (DuplicateRule) TableName() string {
+	return "duplicate_rules"
+}
+
+// BeforeSave validates the compared field and fills the default threshold of fuzzy rules
+func (rule *DuplicateRule) BeforeSave(tx *gorm.DB) error {
+	pending, err := withPendingUpdates(tx, rule)
+	if err != nil {
+		return err
+	}
+
+	fields, ok := DuplicateRuleFields[pending.EntityType]
+	if !ok {
+		return fmt.Errorf("duplicate rules support Account, Contact and Lead, not %q", pending.EntityType)
+	}
+	if !containsString(fields, pending.Field) {
+		return fmt.Errorf("%s duplicate rules can compare %s, not %q", strings.ToLower(pending.EntityType), strings.Join(fields, ", "), pending.Field)
+	}
+
+	switch pending.Method {
+	case "", DuplicateMatchExact:
+		if pending.Threshold != 0 {
+			tx.Statement.SetColumn("Threshold", 0.0)
+		}
+		if pending.Method == "" {
+			tx.Statement.SetColumn("Method", DuplicateMatchExact)
+		}
+	case DuplicateMatchFuzzy:
+		if !containsString(duplicateFuzzyFields, pending.Field) {
+			return fmt.Errorf("fuzzy matching is available for %s, not %s", strings.Join(duplicateFuzzyFields, " and "), pending.Field)
+		}
+		if pending.Threshold < 0 || pending.Threshold > 1 {
+			return fmt.Errorf("Threshold must be between 0 and 1")
+		}
+		if pending.Threshold == 0 {
+			tx.Statement.SetColumn("Threshold", DefaultDuplicateThreshold)
+		}
+	default:
+		return fmt.Errorf("invalid duplicate match method: %q", pending.Method)
+	}
+
+	return nil
+}
@@ -13,6 +13,7 @@ type Employee struct {
 	Phone      string     `json:"Phone" gorm:"type:varchar(50)" odata:"maxlength(50)"`
 	Department string     `json:"Department" gorm:"type:varchar(100)" odata:"maxlength(100)"`
 	Position   string     `json:"Position" gorm:"type:varchar(100)" odata:"maxlength(100)"`
+	Territory  string     `json:"Territory" gorm:"type:varchar(255)" odata:"maxlength(255)"`
 	HireDate   *time.Time `json:"HireDate"`
 	Notes      string     `json:"Notes" gorm:"type:text"`
 	CreatedAt  time.Time  `json:"CreatedAt" gorm:"autoCreateTime"`
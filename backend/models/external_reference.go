@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// ExternalReference maps the ID a record had in the system it was migrated from to its ID in the CRM.
+// References are recorded by migration package imports so later packages from the same source system
+// can refer to records imported earlier and update them instead of creating duplicates.
+type ExternalReference struct {
+	ID           uint      `json:"ID" gorm:"primaryKey" odata:"key"`
+	SourceSystem string    `json:"SourceSystem" gorm:"type:varchar(100);not null;uniqueIndex:idx_external_reference" odata:"required,maxlength(100)"`
+	EntitySet    string    `json:"EntitySet" gorm:"type:varchar(100);not null;uniqueIndex:idx_external_reference" odata:"required,maxlength(100)"`
+	ExternalID   string    `json:"ExternalID" gorm:"type:varchar(255);not null;uniqueIndex:idx_external_reference" odata:"required,maxlength(255)"`
+	EntityID     uint      `json:"EntityID" gorm:"not null;index" odata:"required"`
+	CreatedAt    time.Time `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `json:"UpdatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (ExternalReference) TableName() string {
+	return "external_references"
+}
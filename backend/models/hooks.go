@@ -0,0 +1,53 @@
+package models
+
+import (
+	"reflect"
+
+	"gorm.io/gorm"
+)
+
+// withPendingUpdates returns a copy of current with the statement's pending updates applied.
+// GORM runs BeforeSave against the stored values for Updates(map), which is how PATCH requests
+// are persisted, and for Updates with another record, which is how PUT requests are persisted,
+// so hooks that validate the resulting record need to look at the pending values.
+func withPendingUpdates[T any](tx *gorm.DB, current *T) (*T, error) {
+	if tx.Statement.Schema == nil {
+		return current, nil
+	}
+
+	merged := *current
+	target := reflect.ValueOf(&merged)
+	switch updates := tx.Statement.Dest.(type) {
+	case map[string]interface{}:
+		for key, value := range updates {
+			field := tx.Statement.Schema.LookUpField(key)
+			if field == nil {
+				continue
+			}
+			if err := field.Set(tx.Statement.Context, target, value); err != nil {
+				return nil, err
+			}
+		}
+	case *T:
+		if updates == current {
+			return current, nil
+		}
+		// Like GORM, take the selected fields and the other non-zero ones
+		source := reflect.ValueOf(updates)
+		selected, restricted := tx.Statement.SelectAndOmitColumns(false, true)
+		for _, field := range tx.Statement.Schema.Fields {
+			if field.DBName == "" || field.PrimaryKey {
+				continue
+			}
+			value, zero := field.ValueOf(tx.Statement.Context, source)
+			if use, ok := selected[field.DBName]; (ok && use) || (!ok && !restricted && !zero) {
+				if err := field.Set(tx.Statement.Context, target, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+	default:
+		return current, nil
+	}
+	return &merged, nil
+}
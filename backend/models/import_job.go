@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// ImportJobStatus tracks the lifecycle of a background import.
+type ImportJobStatus string
+
+const (
+	ImportJobStatusPending   ImportJobStatus = "Pending"
+	ImportJobStatusRunning   ImportJobStatus = "Running"
+	ImportJobStatusSucceeded ImportJobStatus = "Succeeded"
+	ImportJobStatusFailed    ImportJobStatus = "Failed"
+	ImportJobStatusCancelled ImportJobStatus = "Cancelled"
+)
+
+// ImportJob records the progress and outcome of a CSV import that runs in the background.
+// Jobs are started with the StartImportJob action and polled until they reach a final status.
+type ImportJob struct {
+	ID              uint   `json:"ID" gorm:"primaryKey" odata:"key"`
+	EntitySet       string `json:"EntitySet" gorm:"type:varchar(100);not null;index" odata:"required,maxlength(100)"`
+	FileName        string `json:"FileName" gorm:"type:varchar(255)" odata:"maxlength(255)"`
+	Mode            string `json:"Mode" gorm:"type:varchar(20);not null"`
+	MatchKey        string `json:"MatchKey" gorm:"type:varchar(100)"`
+	SkipInvalidRows bool   `json:"SkipInvalidRows" gorm:"not null;default:false"`
+	// CreateMissingTags creates unknown account tags named by the file instead of rejecting the rows.
+	CreateMissingTags bool `json:"CreateMissingTags" gorm:"not null;default:false"`
+	// ImportMappingID is the saved import mapping applied to the file, if any.
+	ImportMappingID *uint           `json:"ImportMappingID" gorm:"index"`
+	Status          ImportJobStatus `json:"Status" gorm:"type:varchar(20);not null;index"`
+	CancelRequested bool            `json:"CancelRequested" gorm:"not null;default:false"`
+
+	// Progress
+	TotalRows     int `json:"TotalRows" gorm:"not null;default:0"`
+	ProcessedRows int `json:"ProcessedRows" gorm:"not null;default:0"`
+	InsertedRows  int `json:"InsertedRows" gorm:"not null;default:0"`
+	UpdatedRows   int `json:"UpdatedRows" gorm:"not null;default:0"`
+	UnchangedRows int `json:"UnchangedRows" gorm:"not null;default:0"`
+	ErrorCount    int `json:"ErrorCount" gorm:"not null;default:0"`
+
+	// ErrorReport holds the failed rows as CSV with Row, Field and Message columns once the job finishes.
+	ErrorReport string     `json:"ErrorReport" gorm:"type:text"`
+	LastError   string     `json:"LastError" gorm:"type:text"`
+	StartedAt   *time.Time `json:"StartedAt"`
+	FinishedAt  *time.Time `json:"FinishedAt"`
+	CreatedAt   time.Time  `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time  `json:"UpdatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (ImportJob) TableName() string {
+	return "import_jobs"
+}
+
+// IsFinished reports whether the job reached a final status.
+func (job *ImportJob) IsFinished() bool {
+	switch job.Status {
+	case ImportJobStatusSucceeded, ImportJobStatusFailed, ImportJobStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ImportTransform names a change applied to a mapped value before it is parsed.
+type ImportTransform string
+
+const (
+	ImportTransformTrim      ImportTransform = "trim"
+	ImportTransformUppercase ImportTransform = "uppercase"
+	ImportTransformLowercase ImportTransform = "lowercase"
+)
+
+// importMappingEntitySets lists the entity sets that support bulk import.
+var importMappingEntitySets = []string{
+	"Accounts", "Contacts", "Leads", "Activities", "Issues", "Tasks",
+	"Opportunities", "OpportunityLineItems", "Employees", "Products",
+	"Tags", "IssueUpdates", "WorkflowRules",
+}
+
+// ImportMapping is a saved template that renames, fills and transforms the columns of an import file
+// so files from other systems can be imported without editing their headers.
+type ImportMapping struct {
+	ID          uint      `json:"ID" gorm:"primaryKey" odata:"key"`
+	Name        string    `json:"Name" gorm:"type:varchar(150);not null" odata:"required,maxlength(150)"`
+	Description string    `json:"Description" gorm:"type:text"`
+	EntitySet   string    `json:"EntitySet" gorm:"type:varchar(100);not null;index" odata:"required,maxlength(100)"`
+	CreatedAt   time.Time `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"UpdatedAt" gorm:"autoUpdateTime"`
+
+	// Navigation properties
+	Columns []ImportMappingColumn `json:"Columns" gorm:"foreignKey:ImportMappingID;constraint:OnDelete:CASCADE" odata:"navigation"`
+}
+
+// TableName specifies the table name for GORM
+func (ImportMapping) TableName() string {
+	return "import_mappings"
+}
+
+// BeforeSave validates the entity set
+func (mapping *ImportMapping) BeforeSave(tx *gorm.DB) error {
+	pending, err := withPendingUpdates(tx, mapping)
+	if err != nil {
+		return err
+	}
+
+	if !containsString(importMappingEntitySets, pending.EntitySet) {
+		return fmt.Errorf("import mappings support %s, not %q", strings.Join(importMappingEntitySets, ", "), pending.EntitySet)
+	}
+	return nil
+}
+
+// ImportMappingColumn fills one target field of an import, either from a source column or with a constant.
+type ImportMappingColumn struct {
+	ID              uint `json:"ID" gorm:"primaryKey" odata:"key"`
+	ImportMappingID uint `json:"ImportMappingID" gorm:"not null;index" odata:"required"`
+	// SourceColumn is the header in the uploaded file. Leave it empty to always use Constant.
+	SourceColumn string `json:"SourceColumn" gorm:"type:varchar(255)" odata:"maxlength(255)"`
+	// TargetField is the column the parser expects, for example FirstName or AccountID.
+	TargetField string `json:"TargetField" gorm:"type:varchar(100);not null" odata:"required,maxlength(100)"`
+	// Constant is used when there is no source column, or when the source cell is empty.
+	Constant string `json:"Constant" gorm:"type:text"`
+	// Transforms is a comma separated list of trim, uppercase and lowercase, applied in order.
+	Transforms string `json:"Transforms" gorm:"type:varchar(255)" odata:"maxlength(255)"`
+	// DateFormat parses the value as a date in this format, for example DD.MM.YYYY or MM/DD/YYYY HH:mm,
+	// and converts it to RFC3339.
+	DateFormat string    `json:"DateFormat" gorm:"type:varchar(50)" odata:"maxlength(50)"`
+	CreatedAt  time.Time `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `json:"UpdatedAt" gorm:"autoUpdateTime"`
+
+	// Navigation properties
+	ImportMapping *ImportMapping `json:"ImportMapping" gorm:"foreignKey:ImportMappingID" odata:"navigation"`
+}
+
+// TableName specifies the table name for GORM
+func (ImportMappingColumn) TableName() string {
+	return "import_mapping_columns"
+}
+
+// BeforeSave validates the transforms and date format
+func (column *ImportMappingColumn) BeforeSave(tx *gorm.DB) error {
+	pending, err := withPendingUpdates(tx, column)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(pending.TargetField) == "" {
+		return fmt.Errorf("target field is required")
+	}
+	if _, err := pending.ParsedTransforms(); err != nil {
+		return err
+	}
+	if pending.DateFormat != "" {
+		if _, err := ImportDateLayout(pending.DateFormat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParsedTransforms splits Transforms into its steps and rejects unknown ones.
+func (column *ImportMappingColumn) ParsedTransforms() ([]ImportTransform, error) {
+	var transforms []ImportTransform
+	for _, part := range strings.Split(column.Transforms, ",") {
+		transform := ImportTransform(strings.ToLower(strings.TrimSpace(part)))
+		switch transform {
+		case "":
+			continue
+		case ImportTransformTrim, ImportTransformUppercase, ImportTransformLowercase:
+			transforms = append(transforms, transform)
+		default:
+			return nil, fmt.Errorf("unknown transform %q, expected trim, uppercase or lowercase", part)
+		}
+	}
+	return transforms, nil
+}
+
+// importDateTokens maps date format tokens to Go layout elements, longest first.
+var importDateTokens = []struct{ token, layout string }{
+	{"YYYY", "2006"}, {"YY", "06"}, {"MM", "01"}, {"DD", "02"},
+	{"HH", "15"}, {"mm", "04"}, {"ss", "05"},
+}
+
+// ImportDateLayout converts a format such as DD.MM.YYYY HH:mm into a Go time layout.
+func ImportDateLayout(format string) (string, error) {
+	var layout strings.Builder
+	found := false
+	for i := 0; i < len(format); {
+		matched := false
+		for _, token := range importDateTokens {
+			if strings.HasPrefix(format[i:], token.token) {
+				layout.WriteString(token.layout)
+				i += len(token.token)
+				matched = true
+				found = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		if c := format[i]; (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			return "", fmt.Errorf("date format %q has unsupported character %q, use YYYY, YY, MM, DD, HH, mm and ss", format, string(c))
+		}
+		layout.WriteByte(format[i])
+		i++
+	}
+	if !found {
+		return "", fmt.Errorf("date format %q must contain YYYY, YY, MM, DD, HH, mm or ss", format)
+	}
+	return layout.String(), nil
+}
@@ -37,6 +37,17 @@ func (s IssueStatus) String() string {
 	}
 }
 
+// EnumMembers maps the names of issue statuses to their values.
+func (IssueStatus) EnumMembers() map[string]int64 {
+	return map[string]int64{
+		"New":        int64(IssueStatusNew),
+		"InProgress": int64(IssueStatusInProgress),
+		"Pending":    int64(IssueStatusPending),
+		"Resolved":   int64(IssueStatusResolved),
+		"Closed":     int64(IssueStatusClosed),
+	}
+}
+
 // IssuePriority represents the priority level of an issue
 type IssuePriority int64
 
@@ -63,10 +74,20 @@ func (p IssuePriority) String() string {
 	}
 }
 
+// EnumMembers maps the names of issue priorities to their values.
+func (IssuePriority) EnumMembers() map[string]int64 {
+	return map[string]int64{
+		"Low":      int64(IssuePriorityLow),
+		"Medium":   int64(IssuePriorityMedium),
+		"High":     int64(IssuePriorityHigh),
+		"Critical": int64(IssuePriorityCritical),
+	}
+}
+
 // Issue represents a support ticket or issue in the CRM
 type Issue struct {
 	ID          uint          `json:"ID" gorm:"primaryKey" odata:"key"`
-	AccountID   uint          `json:"AccountID" gorm:"not null;index" odata:"required"`
+	AccountID   uint          `json:"AccountID" gorm:"not null;index" odata:"required" csv:"key=AccountName"`
 	ContactID   *uint         `json:"ContactID" gorm:"index"`
 	Title       string        `json:"Title" gorm:"not null;type:varchar(255)" odata:"required,maxlength(255)"`
 	Description string        `json:"Description" gorm:"type:text"`
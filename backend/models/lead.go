@@ -1,6 +1,13 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // LeadStatus represents the lifecycle status of a lead
 type LeadStatus string
@@ -13,33 +20,163 @@ const (
 	LeadStatusDisqualified LeadStatus = "Disqualified"
 )
 
+// LeadStatusTransitions lists the statuses a lead may move to from each status. Converted leads cannot change, and
+// only lead conversion may set LeadStatusConverted.
+var LeadStatusTransitions = map[LeadStatus][]LeadStatus{
+	LeadStatusNew:          {LeadStatusContacted, LeadStatusQualified, LeadStatusDisqualified, LeadStatusConverted},
+	LeadStatusContacted:    {LeadStatusQualified, LeadStatusDisqualified, LeadStatusConverted},
+	LeadStatusQualified:    {LeadStatusContacted, LeadStatusDisqualified, LeadStatusConverted},
+	LeadStatusDisqualified: {LeadStatusNew, LeadStatusContacted},
+	LeadStatusConverted:    {},
+}
+
+// ErrLeadNotConvertible is returned when a lead is set to LeadStatusConverted other than by lead conversion.
+var ErrLeadNotConvertible = errors.New("leads can only be converted with the ConvertLead action")
+
+// leadConversionKey marks the statements of a lead conversion.
+const leadConversionKey = "lead:conversion"
+
+// ForLeadConversion allows the statements of tx to set leads to LeadStatusConverted.
+func ForLeadConversion(tx *gorm.DB) *gorm.DB {
+	return tx.Set(leadConversionKey, true)
+}
+
 // Lead captures prospect information before conversion to an account/contact
+// Score and ScoreReason are maintained by the workflow engine from the active lead scoring rules.
 type Lead struct {
-	ID                 uint       `json:"ID" gorm:"primaryKey" odata:"key"`
-	Name               string     `json:"Name" gorm:"not null;type:varchar(255)" odata:"required,maxlength(255)"`
-	Email              string     `json:"Email" gorm:"type:varchar(255)" odata:"maxlength(255)"`
-	Phone              string     `json:"Phone" gorm:"type:varchar(50)" odata:"maxlength(50)"`
-	Company            string     `json:"Company" gorm:"type:varchar(255)" odata:"maxlength(255)"`
-	Title              string     `json:"Title" gorm:"type:varchar(150)" odata:"maxlength(150)"`
-	Website            string     `json:"Website" gorm:"type:varchar(255)" odata:"maxlength(255)"`
-	Source             string     `json:"Source" gorm:"type:varchar(100)" odata:"maxlength(100)"`
-	Status             LeadStatus `json:"Status" gorm:"type:varchar(50);default:'New'" odata:"maxlength(50)"`
-	Notes              string     `json:"Notes" gorm:"type:text"`
-	OwnerEmployeeID    *uint      `json:"OwnerEmployeeID" gorm:"index"`
-	ConvertedAccountID *uint      `json:"ConvertedAccountID" gorm:"index"`
-	ConvertedContactID *uint      `json:"ConvertedContactID" gorm:"index"`
-	ConvertedAt        *time.Time `json:"ConvertedAt"`
-	CreatedAt          time.Time  `json:"CreatedAt" gorm:"autoCreateTime"`
-	UpdatedAt          time.Time  `json:"UpdatedAt" gorm:"autoUpdateTime"`
-
-	ConvertedAccount *Account    `json:"ConvertedAccount" gorm:"foreignKey:ConvertedAccountID" odata:"navigation"`
-	ConvertedContact *Contact    `json:"ConvertedContact" gorm:"foreignKey:ConvertedContactID" odata:"navigation"`
-	OwnerEmployee    *Employee   `json:"OwnerEmployee" gorm:"foreignKey:OwnerEmployeeID" odata:"navigation"`
-	Activities       []*Activity `json:"Activities" gorm:"foreignKey:LeadID" odata:"navigation"`
-	Tasks            []*Task     `json:"Tasks" gorm:"foreignKey:LeadID" odata:"navigation"`
+	ID      uint       `json:"ID" gorm:"primaryKey" odata:"key"`
+	Name    string     `json:"Name" gorm:"not null;type:varchar(255)" odata:"required,maxlength(255)"`
+	Email   string     `json:"Email" gorm:"type:varchar(255)" odata:"maxlength(255)"`
+	Phone   string     `json:"Phone" gorm:"type:varchar(50)" odata:"maxlength(50)"`
+	Company string     `json:"Company" gorm:"type:varchar(255)" odata:"maxlength(255)"`
+	Title   string     `json:"Title" gorm:"type:varchar(150)" odata:"maxlength(150)"`
+	Website string     `json:"Website" gorm:"type:varchar(255)" odata:"maxlength(255)"`
+	Source  string     `json:"Source" gorm:"type:varchar(100)" odata:"maxlength(100)"`
+	Status  LeadStatus `json:"Status" gorm:"type:varchar(50);default:'New'" odata:"maxlength(50)"`
+	// DisqualificationReason is required while the lead is Disqualified and cleared when it is reopened.
+	DisqualificationReason string     `json:"DisqualificationReason" gorm:"type:text"`
+	Notes                  string     `json:"Notes" gorm:"type:text"`
+	OwnerEmployeeID        *uint      `json:"OwnerEmployeeID" gorm:"index"`
+	ConvertedAccountID     *uint      `json:"ConvertedAccountID" gorm:"index" csv:"-"`
+	ConvertedContactID     *uint      `json:"ConvertedContactID" gorm:"index" csv:"-"`
+	ConvertedAt            *time.Time `json:"ConvertedAt" csv:"-"`
+	Score                  int        `json:"Score" gorm:"not null;default:0;index" csv:"-"`
+	ScoreReason            string     `json:"ScoreReason" gorm:"type:text" csv:"-"`
+	CreatedAt              time.Time  `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt              time.Time  `json:"UpdatedAt" gorm:"autoUpdateTime"`
+
+	ConvertedAccount *Account            `json:"ConvertedAccount" gorm:"foreignKey:ConvertedAccountID" odata:"navigation"`
+	ConvertedContact *Contact            `json:"ConvertedContact" gorm:"foreignKey:ConvertedContactID" odata:"navigation"`
+	OwnerEmployee    *Employee           `json:"OwnerEmployee" gorm:"foreignKey:OwnerEmployeeID" odata:"navigation"`
+	Activities       []*Activity         `json:"Activities" gorm:"foreignKey:LeadID" odata:"navigation"`
+	Tasks            []*Task             `json:"Tasks" gorm:"foreignKey:LeadID" odata:"navigation"`
+	StatusHistory    []LeadStatusHistory `json:"StatusHistory,omitempty" gorm:"constraint:OnDelete:CASCADE;foreignKey:LeadID" odata:"navigation"`
+
+	statusHistoryShouldRecord bool       `json:"-" gorm:"-"`
+	statusHistoryHadPrevious  bool       `json:"-" gorm:"-"`
+	previousStatusValue       LeadStatus `json:"-" gorm:"-"`
 }
 
 // TableName specifies the table name for GORM
 func (Lead) TableName() string {
 	return "leads"
 }
+
+// BeforeSave enforces LeadStatusTransitions and the disqualification reason
+func (lead *Lead) BeforeSave(tx *gorm.DB) error {
+	lead.statusHistoryShouldRecord = false
+	lead.statusHistoryHadPrevious = false
+
+	pending, err := withPendingUpdates(tx, lead)
+	if err != nil {
+		return err
+	}
+
+	status := pending.Status
+	if status == "" {
+		status = LeadStatusNew
+		tx.Statement.SetColumn("Status", status)
+	}
+	if _, known := LeadStatusTransitions[status]; !known {
+		return fmt.Errorf("invalid lead status: %q", status)
+	}
+	_, converting := tx.Get(leadConversionKey)
+	if status == LeadStatusConverted && !converting {
+		return ErrLeadNotConvertible
+	}
+
+	if pending.ID != 0 {
+		var existing Lead
+		err := tx.Session(&gorm.Session{NewDB: true}).Select("status").First(&existing, pending.ID).Error
+		switch {
+		case err == nil:
+			previous := existing.Status
+			if previous == "" {
+				previous = LeadStatusNew
+			}
+			if previous == LeadStatusConverted {
+				return fmt.Errorf("converted leads cannot be changed")
+			}
+			if previous != status {
+				allowed := false
+				for _, next := range LeadStatusTransitions[previous] {
+					allowed = allowed || next == status
+				}
+				if !allowed {
+					return fmt.Errorf("lead status cannot change from %s to %s", previous, status)
+				}
+				lead.statusHistoryShouldRecord = true
+				lead.statusHistoryHadPrevious = true
+				lead.previousStatusValue = previous
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			lead.statusHistoryShouldRecord = true
+		default:
+			return err
+		}
+	} else {
+		lead.statusHistoryShouldRecord = true
+	}
+
+	if status == LeadStatusDisqualified {
+		if strings.TrimSpace(pending.DisqualificationReason) == "" {
+			return fmt.Errorf("a disqualification reason is required")
+		}
+	} else if pending.DisqualificationReason != "" {
+		tx.Statement.SetColumn("DisqualificationReason", "")
+	}
+
+	return nil
+}
+
+// AfterSave records a status history entry when a lead is created or its status changes
+func (lead *Lead) AfterSave(tx *gorm.DB) error {
+	if !lead.statusHistoryShouldRecord || lead.ID == 0 {
+		return nil
+	}
+
+	history := LeadStatusHistory{
+		LeadID:              lead.ID,
+		Status:              lead.Status,
+		ChangedByEmployeeID: lead.OwnerEmployeeID,
+	}
+	if history.Status == "" {
+		history.Status = LeadStatusNew
+	}
+	if lead.statusHistoryHadPrevious {
+		previous := lead.previousStatusValue
+		history.PreviousStatus = &previous
+	}
+	if history.Status == LeadStatusDisqualified {
+		history.Reason = strings.TrimSpace(lead.DisqualificationReason)
+	}
+
+	if err := tx.Session(&gorm.Session{NewDB: true}).Create(&history).Error; err != nil {
+		return err
+	}
+
+	lead.statusHistoryShouldRecord = false
+	lead.statusHistoryHadPrevious = false
+
+	return nil
+}
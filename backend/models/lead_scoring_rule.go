@@ -0,0 +1,118 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LeadScoringCriterion determines what a lead scoring rule awards points for.
+type LeadScoringCriterion string
+
+const (
+	// LeadScoringFieldValue awards points when a lead field matches Value.
+	LeadScoringFieldValue LeadScoringCriterion = "FieldValue"
+	// LeadScoringEmailDomain awards points when the lead's email is at the domain in Value or one of its subdomains.
+	LeadScoringEmailDomain LeadScoringCriterion = "EmailDomain"
+	// LeadScoringActivityType awards points for every activity of the type in Value.
+	LeadScoringActivityType LeadScoringCriterion = "ActivityType"
+	// LeadScoringRecentActivity awards points for every activity, usually limited to the last WindowDays.
+	LeadScoringRecentActivity LeadScoringCriterion = "RecentActivity"
+)
+
+// LeadScoringOperator determines how FieldValue rules compare a field with Value. Comparisons ignore case.
+type LeadScoringOperator string
+
+const (
+	LeadScoringEquals   LeadScoringOperator = "Equals"
+	LeadScoringContains LeadScoringOperator = "Contains"
+	// LeadScoringPresent matches fields that are not empty and ignores Value.
+	LeadScoringPresent LeadScoringOperator = "Present"
+)
+
+// LeadScoringFields lists the lead fields FieldValue rules can compare.
+var LeadScoringFields = []string{"Source", "Title", "Company", "Website", "Email", "Phone", "Status"}
+
+// LeadScoringRule awards points to the leads matching it. A lead's score is the rounded sum of the points of
+// every active rule, and negative points lower it.
+type LeadScoringRule struct {
+	ID          uint                 `json:"ID" gorm:"primaryKey" odata:"key"`
+	Name        string               `json:"Name" gorm:"type:varchar(150);not null" odata:"required,maxlength(150)"`
+	Description string               `json:"Description" gorm:"type:text"`
+	Criterion   LeadScoringCriterion `json:"Criterion" gorm:"type:varchar(50);not null" odata:"required,maxlength(50)"`
+	// Field and Operator apply to FieldValue rules only.
+	Field    string              `json:"Field" gorm:"type:varchar(100)" odata:"maxlength(100)"`
+	Operator LeadScoringOperator `json:"Operator" gorm:"type:varchar(50);not null;default:'Equals'" odata:"maxlength(50)"`
+	Value    string              `json:"Value" gorm:"type:varchar(255)" odata:"maxlength(255)"`
+	// Points are awarded once for field and email rules and per matching activity for activity rules.
+	Points int `json:"Points" gorm:"not null;default:0"`
+
+	// The remaining settings apply to activity rules only.
+
+	// WindowDays limits the rule to activities of the last WindowDays days. Zero counts every activity.
+	WindowDays int `json:"WindowDays" gorm:"not null;default:0"`
+	// HalfLifeDays halves the points of an activity every HalfLifeDays days after it took place. Zero disables decay.
+	HalfLifeDays int `json:"HalfLifeDays" gorm:"not null;default:0"`
+	// MaxPoints caps the points the rule awards to one lead. Zero leaves them uncapped.
+	MaxPoints int `json:"MaxPoints" gorm:"not null;default:0"`
+
+	IsActive  bool      `json:"IsActive" gorm:"not null;default:true"`
+	CreatedAt time.Time `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"UpdatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName specifies the table name for GORM
+func (LeadScoringRule) TableName() string {
+	return "lead_scoring_rules"
+}
+
+// BeforeSave validates the criterion and the settings it uses
+func (rule *LeadScoringRule) BeforeSave(tx *gorm.DB) error {
+	pending, err := withPendingUpdates(tx, rule)
+	if err != nil {
+		return err
+	}
+
+	if pending.WindowDays < 0 || pending.HalfLifeDays < 0 || pending.MaxPoints < 0 {
+		return fmt.Errorf("WindowDays, HalfLifeDays and MaxPoints must not be negative")
+	}
+
+	switch pending.Criterion {
+	case LeadScoringFieldValue:
+		if !containsString(LeadScoringFields, pending.Field) {
+			return fmt.Errorf("field value rules must use one of %s, not %q", strings.Join(LeadScoringFields, ", "), pending.Field)
+		}
+		switch pending.Operator {
+		case "", LeadScoringEquals, LeadScoringContains:
+			if pending.Operator == "" {
+				tx.Statement.SetColumn("Operator", LeadScoringEquals)
+			}
+			if strings.TrimSpace(pending.Value) == "" {
+				return fmt.Errorf("field value rules require a value unless they use the Present operator")
+			}
+		case LeadScoringPresent:
+		default:
+			return fmt.Errorf("invalid lead scoring operator: %q", pending.Operator)
+		}
+	case LeadScoringEmailDomain, LeadScoringActivityType:
+		if strings.TrimSpace(pending.Value) == "" {
+			return fmt.Errorf("%s rules require a value", pending.Criterion)
+		}
+	case LeadScoringRecentActivity:
+	default:
+		return fmt.Errorf("invalid lead scoring criterion: %q", pending.Criterion)
+	}
+
+	if pending.Criterion != LeadScoringFieldValue && pending.Field != "" {
+		return fmt.Errorf("Field can only be used by field value rules")
+	}
+	if pending.Criterion == LeadScoringFieldValue || pending.Criterion == LeadScoringEmailDomain {
+		if pending.WindowDays != 0 || pending.HalfLifeDays != 0 || pending.MaxPoints != 0 {
+			return fmt.Errorf("WindowDays, HalfLifeDays and MaxPoints can only be used by activity rules")
+		}
+	}
+
+	return nil
+}
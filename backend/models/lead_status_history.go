@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// LeadStatusHistory tracks each status transition for a lead
+type LeadStatusHistory struct {
+	ID             uint        `json:"ID" gorm:"primaryKey" odata:"key"`
+	LeadID         uint        `json:"LeadID" gorm:"not null;index" odata:"required"`
+	Status         LeadStatus  `json:"Status" gorm:"type:varchar(50);not null" odata:"required,maxlength(50)"`
+	PreviousStatus *LeadStatus `json:"PreviousStatus,omitempty" gorm:"type:varchar(50)" odata:"nullable,maxlength(50)"`
+	// Reason is the disqualification reason of transitions to Disqualified.
+	Reason              string    `json:"Reason,omitempty" gorm:"type:text"`
+	ChangedAt           time.Time `json:"ChangedAt" gorm:"autoCreateTime"`
+	ChangedByEmployeeID *uint     `json:"ChangedByEmployeeID,omitempty" gorm:"index"`
+
+	// Navigation properties
+	Lead      *Lead     `json:"Lead,omitempty" gorm:"foreignKey:LeadID" odata:"navigation"`
+	ChangedBy *Employee `json:"ChangedBy,omitempty" gorm:"foreignKey:ChangedByEmployeeID" odata:"navigation"`
+}
+
+// TableName specifies the table name for GORM
+func (LeadStatusHistory) TableName() string {
+	return "lead_status_history"
+}
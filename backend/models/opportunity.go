@@ -46,10 +46,23 @@ func (s OpportunityStage) String() string {
 	}
 }
 
+// EnumMembers maps the names of opportunity stages to their values.
+func (OpportunityStage) EnumMembers() map[string]int64 {
+	return map[string]int64{
+		"Prospecting":   int64(OpportunityStageProspecting),
+		"Qualification": int64(OpportunityStageQualification),
+		"NeedsAnalysis": int64(OpportunityStageNeedsAnalysis),
+		"Proposal":      int64(OpportunityStageProposal),
+		"Negotiation":   int64(OpportunityStageNegotiation),
+		"ClosedWon":     int64(OpportunityStageClosedWon),
+		"ClosedLost":    int64(OpportunityStageClosedLost),
+	}
+}
+
 // Opportunity represents a sales opportunity tied to an account/contact
 type Opportunity struct {
 	ID                 uint             `json:"ID" gorm:"primaryKey" odata:"key"`
-	AccountID          uint             `json:"AccountID" gorm:"not null;index" odata:"required"`
+	AccountID          uint             `json:"AccountID" gorm:"not null;index" odata:"required" csv:"key=AccountName"`
 	ContactID          *uint            `json:"ContactID" gorm:"index"`
 	OwnerEmployeeID    *uint            `json:"OwnerEmployeeID" gorm:"index"`
 	Name               string           `json:"Name" gorm:"not null;type:varchar(255)" odata:"required,maxlength(255)"`
@@ -11,13 +11,13 @@ import (
 type OpportunityLineItem struct {
 	ID              uint      `json:"ID" gorm:"primaryKey" odata:"key"`
 	OpportunityID   uint      `json:"OpportunityID" gorm:"not null;index" odata:"required"`
-	ProductID       uint      `json:"ProductID" gorm:"not null;index" odata:"required"`
+	ProductID       uint      `json:"ProductID" gorm:"not null;index" odata:"required" csv:"key=ProductSKU"`
 	Quantity        int       `json:"Quantity" gorm:"not null;default:1" odata:"required"`
 	UnitPrice       float64   `json:"UnitPrice" gorm:"not null;type:numeric(12,2)" odata:"required"`
 	DiscountAmount  float64   `json:"DiscountAmount" gorm:"type:numeric(12,2);default:0"`
 	DiscountPercent float64   `json:"DiscountPercent" gorm:"type:numeric(5,2);default:0"`
-	Subtotal        float64   `json:"Subtotal" gorm:"not null;type:numeric(12,2);default:0"`
-	Total           float64   `json:"Total" gorm:"not null;type:numeric(12,2);default:0"`
+	Subtotal        float64   `json:"Subtotal" gorm:"not null;type:numeric(12,2);default:0" csv:"-"`
+	Total           float64   `json:"Total" gorm:"not null;type:numeric(12,2);default:0" csv:"-"`
 	CreatedAt       time.Time `json:"CreatedAt" gorm:"autoCreateTime"`
 	UpdatedAt       time.Time `json:"UpdatedAt" gorm:"autoUpdateTime"`
 
@@ -37,6 +37,17 @@ func (s TaskStatus) String() string {
 	}
 }
 
+// EnumMembers maps the names of task statuses to their values.
+func (TaskStatus) EnumMembers() map[string]int64 {
+	return map[string]int64{
+		"NotStarted": int64(TaskStatusNotStarted),
+		"InProgress": int64(TaskStatusInProgress),
+		"Completed":  int64(TaskStatusCompleted),
+		"Deferred":   int64(TaskStatusDeferred),
+		"Cancelled":  int64(TaskStatusCancelled),
+	}
+}
+
 // Task represents a follow-up item associated with an account
 // Tasks capture accountability with an owner, status and due date.
 type Task struct {
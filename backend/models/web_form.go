@@ -0,0 +1,129 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultWebFormSubmissionsPerMinute is the MaxSubmissionsPerMinute of forms created without one.
+const DefaultWebFormSubmissionsPerMinute = 5
+
+// WebFormLeadFields lists the lead fields web form fields can fill.
+var WebFormLeadFields = []string{"Name", "Email", "Phone", "Company", "Title", "Website", "Source", "Notes"}
+
+// WebForm configures a website form that creates leads through the public form endpoint. Submissions are
+// posted to /forms/{Key}, so the key is the only thing a form needs to know and can be rotated by changing it.
+type WebForm struct {
+	ID          uint   `json:"ID" gorm:"primaryKey" odata:"key"`
+	Name        string `json:"Name" gorm:"type:varchar(150);not null" odata:"required,maxlength(150)"`
+	Description string `json:"Description" gorm:"type:text"`
+	// Key identifies the form in submission URLs. A random key is generated when it is left empty.
+	Key string `json:"Key" gorm:"type:varchar(64);not null;uniqueIndex" odata:"maxlength(64)"`
+	// DefaultSource is the lead source of submissions that do not map a Source field.
+	DefaultSource string `json:"DefaultSource" gorm:"type:varchar(100)" odata:"maxlength(100)"`
+	// OwnerEmployeeID owns every lead the form creates. Leave it empty to route new leads with the assignment rules.
+	OwnerEmployeeID *uint `json:"OwnerEmployeeID" gorm:"index"`
+	// HoneypotField is a form field hidden from people. Submissions that fill it are treated as spam and dropped.
+	HoneypotField string `json:"HoneypotField" gorm:"type:varchar(100)" odata:"maxlength(100)"`
+	// MaxSubmissionsPerMinute limits the submissions accepted from one IP address. Zero disables the limit, forms
+	// created without a limit get DefaultWebFormSubmissionsPerMinute.
+	MaxSubmissionsPerMinute *int `json:"MaxSubmissionsPerMinute" gorm:"not null"`
+	// RedirectURL sends browsers posting the form back to the website instead of answering with JSON.
+	RedirectURL string    `json:"RedirectURL" gorm:"type:varchar(500)" odata:"maxlength(500)"`
+	IsActive    bool      `json:"IsActive" gorm:"not null;default:true"`
+	CreatedAt   time.Time `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"UpdatedAt" gorm:"autoUpdateTime"`
+
+	// Navigation properties
+	Fields        []WebFormField `json:"Fields" gorm:"foreignKey:WebFormID;constraint:OnDelete:CASCADE" odata:"navigation"`
+	OwnerEmployee *Employee      `json:"OwnerEmployee" gorm:"foreignKey:OwnerEmployeeID" odata:"navigation"`
+}
+
+// TableName specifies the table name for GORM
+func (WebForm) TableName() string {
+	return "web_forms"
+}
+
+// BeforeSave generates a missing key, fills in the default submission limit of new forms and validates the key
+// and the spam settings
+func (form *WebForm) BeforeSave(tx *gorm.DB) error {
+	pending, err := withPendingUpdates(tx, form)
+	if err != nil {
+		return err
+	}
+
+	key := strings.TrimSpace(pending.Key)
+	if key == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return fmt.Errorf("generate web form key: %w", err)
+		}
+		key = hex.EncodeToString(buf)
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("web form keys may only contain letters, digits, - and _")
+		}
+	}
+	if key != pending.Key {
+		tx.Statement.SetColumn("Key", key)
+	}
+
+	if pending.MaxSubmissionsPerMinute == nil {
+		if pending.ID != 0 {
+			return fmt.Errorf("MaxSubmissionsPerMinute is required, set it to 0 to disable the limit")
+		}
+		// A GORM default would also replace an explicit zero, which disables the limit
+		limit := DefaultWebFormSubmissionsPerMinute
+		tx.Statement.SetColumn("MaxSubmissionsPerMinute", &limit)
+	} else if *pending.MaxSubmissionsPerMinute < 0 {
+		return fmt.Errorf("MaxSubmissionsPerMinute must not be negative")
+	}
+	if pending.RedirectURL != "" && !strings.HasPrefix(pending.RedirectURL, "https://") && !strings.HasPrefix(pending.RedirectURL, "http://") {
+		return fmt.Errorf("RedirectURL must be an http or https URL")
+	}
+	return nil
+}
+
+// WebFormField fills a lead field from a field of the submitted form.
+type WebFormField struct {
+	ID        uint `json:"ID" gorm:"primaryKey" odata:"key"`
+	WebFormID uint `json:"WebFormID" gorm:"not null;index" odata:"required"`
+	// FormField is the name of the input on the website, for example first_name.
+	FormField string `json:"FormField" gorm:"type:varchar(100);not null" odata:"required,maxlength(100)"`
+	// LeadField is one of WebFormLeadFields. Several form fields mapped to the same lead field are joined, with
+	// spaces for Name and line breaks for Notes, so first_name and last_name can both fill Name.
+	LeadField string    `json:"LeadField" gorm:"type:varchar(100);not null" odata:"required,maxlength(100)"`
+	Required  bool      `json:"Required" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"UpdatedAt" gorm:"autoUpdateTime"`
+
+	// Navigation properties
+	WebForm *WebForm `json:"WebForm" gorm:"foreignKey:WebFormID" odata:"navigation"`
+}
+
+// TableName specifies the table name for GORM
+func (WebFormField) TableName() string {
+	return "web_form_fields"
+}
+
+// BeforeSave validates the lead field
+func (field *WebFormField) BeforeSave(tx *gorm.DB) error {
+	pending, err := withPendingUpdates(tx, field)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(pending.FormField) == "" {
+		return fmt.Errorf("form field is required")
+	}
+	if !containsString(WebFormLeadFields, pending.LeadField) {
+		return fmt.Errorf("web form fields can fill %s, not %q", strings.Join(WebFormLeadFields, ", "), pending.LeadField)
+	}
+	return nil
+}
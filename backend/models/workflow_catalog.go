@@ -0,0 +1,383 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WorkflowConfigProperty describes a single key accepted in a trigger or action config.
+type WorkflowConfigProperty struct {
+	Name        string
+	Type        string // string, integer, number or boolean
+	Required    bool
+	Description string
+	Enum        []string
+	Minimum     *float64
+	// FieldReference marks values that name an identifier field on the rule's entity.
+	FieldReference bool
+}
+
+// WorkflowConfigSchema describes the shape of a trigger or action config map.
+type WorkflowConfigSchema struct {
+	Properties []WorkflowConfigProperty
+	// OneOfRequired lists groups of properties where at least one member must be set.
+	OneOfRequired [][]string
+}
+
+// WorkflowTriggerDefinition documents a supported trigger type.
+type WorkflowTriggerDefinition struct {
+	Type        WorkflowTriggerType
+	Description string
+	EntityTypes []string
+	Config      WorkflowConfigSchema
+}
+
+// WorkflowActionDefinition documents a supported action type.
+type WorkflowActionDefinition struct {
+	Type        WorkflowActionType
+	Description string
+	Config      WorkflowConfigSchema
+}
+
+// WorkflowEntityField describes a field of an entity that rules can reference.
+type WorkflowEntityField struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	IsIdentifier bool   `json:"isIdentifier"`
+}
+
+var zeroMinimum = 0.0
+
+var workflowTriggerDefinitions = []WorkflowTriggerDefinition{
+	{
+		Type:        WorkflowTriggerLeadStatusChanged,
+		Description: "Runs when a lead moves into the configured status.",
+		EntityTypes: []string{"Lead"},
+		Config: WorkflowConfigSchema{
+			Properties: []WorkflowConfigProperty{
+				{
+					Name:        "status",
+					Type:        "string",
+					Required:    true,
+					Description: "Lead status that fires the rule.",
+					Enum: []string{
+						string(LeadStatusNew),
+						string(LeadStatusContacted),
+						string(LeadStatusQualified),
+						string(LeadStatusConverted),
+						string(LeadStatusDisqualified),
+					},
+				},
+			},
+		},
+	},
+	{
+		Type:        WorkflowTriggerTaskOverdue,
+		Description: "Runs once per task when it passes its due date without being completed.",
+		EntityTypes: []string{"Task"},
+		Config: WorkflowConfigSchema{
+			Properties: []WorkflowConfigProperty{
+				{Name: "graceMinutes", Type: "integer", Description: "Minutes after the due date before the task counts as overdue.", Minimum: &zeroMinimum},
+			},
+		},
+	},
+}
+
+var workflowActionDefinitions = []WorkflowActionDefinition{
+	{
+		Type:        WorkflowActionCreateFollowUpTask,
+		Description: "Creates a follow-up task linked to an account.",
+		Config: WorkflowConfigSchema{
+			Properties: []WorkflowConfigProperty{
+				{Name: "title", Type: "string", Required: true, Description: "Task title."},
+				{Name: "description", Type: "string", Description: "Task description."},
+				{Name: "owner", Type: "string", Required: true, Description: "Task owner display name."},
+				{Name: "dueInDays", Type: "integer", Description: "Days until the task is due. Defaults to 2 when zero.", Minimum: &zeroMinimum},
+				{Name: "accountId", Type: "integer", Description: "Fixed account for the task.", Minimum: &zeroMinimum},
+				{Name: "accountIdField", Type: "string", Description: "Entity field holding the account ID.", FieldReference: true},
+				{Name: "employeeId", Type: "integer", Description: "Employee assigned to the task.", Minimum: &zeroMinimum},
+				{Name: "contactIdField", Type: "string", Description: "Entity field holding the contact ID.", FieldReference: true},
+			},
+			OneOfRequired: [][]string{{"accountId", "accountIdField"}},
+		},
+	},
+	{
+		Type:        WorkflowActionSendNotification,
+		Description: "Queues a notification message.",
+		Config: WorkflowConfigSchema{
+			Properties: []WorkflowConfigProperty{
+				{Name: "message", Type: "string", Required: true, Description: "Notification text."},
+				{Name: "channel", Type: "string", Description: "Delivery channel, for example email or slack."},
+			},
+		},
+	},
+}
+
+// WorkflowTriggerDefinitions returns all supported trigger types.
+func WorkflowTriggerDefinitions() []WorkflowTriggerDefinition {
+	return workflowTriggerDefinitions
+}
+
+// WorkflowActionDefinitions returns all supported action types.
+func WorkflowActionDefinitions() []WorkflowActionDefinition {
+	return workflowActionDefinitions
+}
+
+// LookupWorkflowTrigger finds the definition for a trigger type.
+func LookupWorkflowTrigger(triggerType WorkflowTriggerType) (WorkflowTriggerDefinition, bool) {
+	for _, definition := range workflowTriggerDefinitions {
+		if definition.Type == triggerType {
+			return definition, true
+		}
+	}
+	return WorkflowTriggerDefinition{}, false
+}
+
+// LookupWorkflowAction finds the definition for an action type.
+func LookupWorkflowAction(actionType WorkflowActionType) (WorkflowActionDefinition, bool) {
+	for _, definition := range workflowActionDefinitions {
+		if definition.Type == actionType {
+			return definition, true
+		}
+	}
+	return WorkflowActionDefinition{}, false
+}
+
+// JSONSchema renders the config schema as a JSON Schema object for clients.
+func (s WorkflowConfigSchema) JSONSchema() map[string]interface{} {
+	properties := make(map[string]interface{}, len(s.Properties))
+	required := []string{}
+	for _, property := range s.Properties {
+		definition := map[string]interface{}{
+			"type":        property.Type,
+			"description": property.Description,
+		}
+		if len(property.Enum) > 0 {
+			definition["enum"] = property.Enum
+		}
+		if property.Minimum != nil {
+			definition["minimum"] = *property.Minimum
+		}
+		if property.FieldReference {
+			definition["x-fieldReference"] = true
+		}
+		properties[property.Name] = definition
+		if property.Required {
+			required = append(required, property.Name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+	if len(s.OneOfRequired) > 0 {
+		anyOf := make([]interface{}, 0)
+		for _, group := range s.OneOfRequired {
+			for _, name := range group {
+				anyOf = append(anyOf, map[string]interface{}{"required": []string{name}})
+			}
+		}
+		schema["anyOf"] = anyOf
+	}
+	return schema
+}
+
+// Validate checks a config map against the schema. Field references are resolved against entityType.
+func (s WorkflowConfigSchema) Validate(prefix string, config map[string]interface{}, entityType string) []string {
+	var problems []string
+
+	known := make(map[string]WorkflowConfigProperty, len(s.Properties))
+	for _, property := range s.Properties {
+		known[property.Name] = property
+	}
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		property, ok := known[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s has unknown property %q", prefix, key))
+			continue
+		}
+		if problem := property.check(config[key], entityType); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s.%s %s", prefix, key, problem))
+		}
+	}
+
+	for _, property := range s.Properties {
+		if property.Required && isEmptyConfigValue(config[property.Name]) {
+			problems = append(problems, fmt.Sprintf("%s.%s is required", prefix, property.Name))
+		}
+	}
+
+	for _, group := range s.OneOfRequired {
+		satisfied := false
+		for _, name := range group {
+			if !isEmptyConfigValue(config[name]) {
+				satisfied = true
+				break
+			}
+		}
+		if !satisfied {
+			problems = append(problems, fmt.Sprintf("%s requires one of %s", prefix, strings.Join(group, ", ")))
+		}
+	}
+
+	return problems
+}
+
+func (p WorkflowConfigProperty) check(value interface{}, entityType string) string {
+	if value == nil {
+		return ""
+	}
+
+	switch p.Type {
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return "must be a string"
+		}
+		if text == "" {
+			return ""
+		}
+		if len(p.Enum) > 0 && !containsString(p.Enum, text) {
+			return fmt.Sprintf("must be one of %s", strings.Join(p.Enum, ", "))
+		}
+		if p.FieldReference {
+			field, ok := lookupWorkflowEntityField(entityType, text)
+			if !ok {
+				return fmt.Sprintf("references unknown %s field %q", entityType, text)
+			}
+			if !field.IsIdentifier {
+				return fmt.Sprintf("must reference an identifier field, %q is %s", text, field.Type)
+			}
+		}
+	case "integer", "number":
+		number, ok := configNumber(value)
+		if !ok {
+			return fmt.Sprintf("must be a %s", map[string]string{"integer": "whole number", "number": "number"}[p.Type])
+		}
+		if p.Type == "integer" && number != math.Trunc(number) {
+			return "must be a whole number"
+		}
+		if p.Minimum != nil && number < *p.Minimum {
+			return fmt.Sprintf("must be at least %g", *p.Minimum)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return "must be true or false"
+		}
+	}
+
+	return ""
+}
+
+// WorkflowEntityTypes lists the entity types workflow rules can target.
+func WorkflowEntityTypes() []string {
+	return []string{"Account", "Contact", "Lead", "Issue", "Activity", "Task", "Opportunity"}
+}
+
+// WorkflowEntityFields lists the scalar fields of a workflow entity type.
+func WorkflowEntityFields(entityType string) []WorkflowEntityField {
+	entity, ok := NewWorkflowEntity(entityType)
+	if !ok {
+		return nil
+	}
+
+	timeType := reflect.TypeOf(time.Time{})
+	rt := reflect.TypeOf(entity).Elem()
+	var fields []WorkflowEntityField
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Slice || fieldType.Kind() == reflect.Map {
+			continue
+		}
+		if fieldType.Kind() == reflect.Struct && fieldType != timeType {
+			continue
+		}
+
+		fields = append(fields, WorkflowEntityField{
+			Name:         field.Name,
+			Type:         workflowFieldTypeName(fieldType),
+			IsIdentifier: fieldType.Kind() == reflect.Uint && (field.Name == "ID" || strings.HasSuffix(field.Name, "ID")),
+		})
+	}
+	return fields
+}
+
+func lookupWorkflowEntityField(entityType, name string) (WorkflowEntityField, bool) {
+	for _, field := range WorkflowEntityFields(entityType) {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return WorkflowEntityField{}, false
+}
+
+func workflowFieldTypeName(fieldType reflect.Type) string {
+	if fieldType == reflect.TypeOf(time.Time{}) {
+		return "datetime"
+	}
+	switch fieldType.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return "integer"
+	}
+}
+
+func configNumber(value interface{}) (float64, bool) {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func isEmptyConfigValue(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	if text, ok := value.(string); ok {
+		return strings.TrimSpace(text) == ""
+	}
+	return false
+}
+
+func containsString(values []string, candidate string) bool {
+	for _, value := range values {
+		if value == candidate {
+			return true
+		}
+	}
+	return false
+}
@@ -14,18 +14,21 @@ const (
 // WorkflowExecution captures the history of rule executions for observability.
 type WorkflowExecution struct {
 	ID             uint                    `json:"ID" gorm:"primaryKey" odata:"key"`
-	WorkflowRuleID uint                    `json:"WorkflowRuleID" gorm:"not null;index" odata:"required"`
+	WorkflowRuleID uint                    `json:"WorkflowRuleID" gorm:"not null;index;index:idx_workflow_executions_dedup,priority:1" odata:"required"`
 	TriggerEvent   string                  `json:"TriggerEvent" gorm:"type:varchar(50);not null"`
 	EventSource    string                  `json:"EventSource" gorm:"type:varchar(50)"`
 	EntityType     string                  `json:"EntityType" gorm:"type:varchar(100);not null"`
-	EntityID       string                  `json:"EntityID" gorm:"type:varchar(100);not null"`
+	EntityID       string                  `json:"EntityID" gorm:"type:varchar(100);not null;index:idx_workflow_executions_dedup,priority:2"`
 	ActionType     WorkflowActionType      `json:"ActionType" gorm:"type:varchar(100);not null"`
-	Status         WorkflowExecutionStatus `json:"Status" gorm:"type:varchar(50);not null;default:'Pending'"`
+	Status         WorkflowExecutionStatus `json:"Status" gorm:"type:varchar(50);not null;default:'Pending';index:idx_workflow_executions_dedup,priority:3;index:idx_workflow_executions_status_created,priority:1"`
 	ResultSummary  string                  `json:"ResultSummary" gorm:"type:text"`
 	ErrorMessage   string                  `json:"ErrorMessage" gorm:"type:text"`
 	EventPayload   map[string]interface{}  `json:"EventPayload" gorm:"type:jsonb;serializer:json"`
-	CreatedAt      time.Time               `json:"CreatedAt" gorm:"autoCreateTime"`
-	CompletedAt    *time.Time              `json:"CompletedAt"`
+	// ChainDepth counts the rule executions that led to this one; CausationExecutionID is the direct cause.
+	ChainDepth           int        `json:"ChainDepth" gorm:"not null;default:0"`
+	CausationExecutionID *uint      `json:"CausationExecutionID" gorm:"index"`
+	CreatedAt            time.Time  `json:"CreatedAt" gorm:"autoCreateTime;index;index:idx_workflow_executions_status_created,priority:2"`
+	CompletedAt          *time.Time `json:"CompletedAt"`
 
 	WorkflowRule *WorkflowRule `json:"WorkflowRule" gorm:"foreignKey:WorkflowRuleID" odata:"navigation"`
 }
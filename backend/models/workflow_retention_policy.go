@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WorkflowRetentionPolicy controls how long workflow executions are kept before they are pruned.
+type WorkflowRetentionPolicy struct {
+	ID          uint   `json:"ID" gorm:"primaryKey" odata:"key"`
+	Name        string `json:"Name" gorm:"type:varchar(150);not null" odata:"required,maxlength(150)"`
+	Description string `json:"Description" gorm:"type:text"`
+	// Status limits the policy to executions with this outcome; empty applies to every status.
+	Status        WorkflowExecutionStatus `json:"Status" gorm:"type:varchar(50)" odata:"maxlength(50)"`
+	RetentionDays int                     `json:"RetentionDays" gorm:"not null" odata:"required"`
+	// Archive writes pruned executions to a compressed JSON lines file before deleting them.
+	Archive         bool       `json:"Archive" gorm:"not null;default:false"`
+	IsActive        bool       `json:"IsActive" gorm:"not null;default:true"`
+	LastRunAt       *time.Time `json:"LastRunAt"`
+	LastPrunedCount int        `json:"LastPrunedCount" gorm:"not null;default:0"`
+	LastArchiveFile string     `json:"LastArchiveFile" gorm:"type:varchar(500)"`
+	LastError       string     `json:"LastError" gorm:"type:text"`
+	CreatedAt       time.Time  `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time  `json:"UpdatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName defines the persisted table name for workflow retention policies.
+func (WorkflowRetentionPolicy) TableName() string {
+	return "workflow_retention_policies"
+}
+
+// BeforeSave validates the retention window and status filter
+func (policy *WorkflowRetentionPolicy) BeforeSave(tx *gorm.DB) error {
+	pending, err := withPendingUpdates(tx, policy)
+	if err != nil {
+		return err
+	}
+
+	if pending.RetentionDays < 1 {
+		return fmt.Errorf("retention days must be at least 1")
+	}
+
+	switch pending.Status {
+	case "", WorkflowExecutionStatusPending, WorkflowExecutionStatusSucceeded, WorkflowExecutionStatusFailed:
+	default:
+		return fmt.Errorf("status %q is not a workflow execution status", pending.Status)
+	}
+
+	return nil
+}
@@ -1,6 +1,12 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // WorkflowTriggerType represents supported workflow trigger identifiers.
 type WorkflowTriggerType string
@@ -29,13 +35,104 @@ type WorkflowRule struct {
 	ActionType    WorkflowActionType     `json:"ActionType" gorm:"type:varchar(100);not null" odata:"required,maxlength(100)"`
 	ActionConfig  map[string]interface{} `json:"ActionConfig" gorm:"type:jsonb;serializer:json"`
 	IsActive      bool                   `json:"IsActive" gorm:"not null;default:true"`
-	CreatedAt     time.Time              `json:"CreatedAt" gorm:"autoCreateTime"`
-	UpdatedAt     time.Time              `json:"UpdatedAt" gorm:"autoUpdateTime"`
+	// MaxExecutionsPerMinute and MaxExecutionsPerEntity override the engine defaults; zero keeps the default.
+	MaxExecutionsPerMinute int        `json:"MaxExecutionsPerMinute" gorm:"not null;default:0"`
+	MaxExecutionsPerEntity int        `json:"MaxExecutionsPerEntity" gorm:"not null;default:0"`
+	DisabledReason         string     `json:"DisabledReason" gorm:"type:text"`
+	DisabledAt             *time.Time `json:"DisabledAt"`
+	CreatedAt              time.Time  `json:"CreatedAt" gorm:"autoCreateTime"`
+	UpdatedAt              time.Time  `json:"UpdatedAt" gorm:"autoUpdateTime"`
 
-	Executions []WorkflowExecution `json:"Executions,omitempty" gorm:"foreignKey:WorkflowRuleID" odata:"navigation"`
+	Executions []WorkflowExecution    `json:"Executions,omitempty" gorm:"foreignKey:WorkflowRuleID" odata:"navigation"`
+	Statistics *WorkflowRuleStatistic `json:"Statistics,omitempty" gorm:"foreignKey:WorkflowRuleID;constraint:OnDelete:CASCADE" odata:"navigation"`
 }
 
 // TableName defines the persisted table name for workflow rules.
 func (WorkflowRule) TableName() string {
 	return "workflow_rules"
 }
+
+// WorkflowRuleValidationError lists every problem found in a rule definition.
+type WorkflowRuleValidationError struct {
+	Problems []string
+}
+
+func (e *WorkflowRuleValidationError) Error() string {
+	return "invalid workflow rule: " + strings.Join(e.Problems, "; ")
+}
+
+// BeforeSave validates the trigger and action configs against their schemas
+func (rule *WorkflowRule) BeforeSave(tx *gorm.DB) error {
+	pending, err := withPendingUpdates(tx, rule)
+	if err != nil {
+		return err
+	}
+	if err := pending.Validate(); err != nil {
+		return err
+	}
+
+	// Re-enabling a rule that the engine disabled clears the recorded reason.
+	if pending.IsActive && (pending.DisabledReason != "" || pending.DisabledAt != nil) {
+		tx.Statement.SetColumn("DisabledReason", "")
+		tx.Statement.SetColumn("DisabledAt", nil)
+	}
+	return nil
+}
+
+// Validate checks the entity type, trigger and action definitions of the rule.
+func (rule *WorkflowRule) Validate() error {
+	var problems []string
+
+	if _, ok := NewWorkflowEntity(rule.EntityType); !ok {
+		problems = append(problems, fmt.Sprintf("EntityType %q is not supported", rule.EntityType))
+	}
+
+	if trigger, ok := LookupWorkflowTrigger(rule.TriggerType); !ok {
+		problems = append(problems, fmt.Sprintf("TriggerType %q is not supported", rule.TriggerType))
+	} else {
+		if !containsString(trigger.EntityTypes, rule.EntityType) {
+			problems = append(problems, fmt.Sprintf("TriggerType %s requires EntityType %s", rule.TriggerType, strings.Join(trigger.EntityTypes, " or ")))
+		}
+		problems = append(problems, trigger.Config.Validate("TriggerConfig", rule.TriggerConfig, rule.EntityType)...)
+	}
+
+	if action, ok := LookupWorkflowAction(rule.ActionType); !ok {
+		problems = append(problems, fmt.Sprintf("ActionType %q is not supported", rule.ActionType))
+	} else {
+		problems = append(problems, action.Config.Validate("ActionConfig", rule.ActionConfig, rule.EntityType)...)
+	}
+
+	if rule.MaxExecutionsPerMinute < 0 {
+		problems = append(problems, "MaxExecutionsPerMinute cannot be negative")
+	}
+	if rule.MaxExecutionsPerEntity < 0 {
+		problems = append(problems, "MaxExecutionsPerEntity cannot be negative")
+	}
+
+	if len(problems) > 0 {
+		return &WorkflowRuleValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// NewWorkflowEntity returns an empty model instance for a workflow rule EntityType.
+func NewWorkflowEntity(entityType string) (interface{}, bool) {
+	switch entityType {
+	case "Account":
+		return &Account{}, true
+	case "Contact":
+		return &Contact{}, true
+	case "Lead":
+		return &Lead{}, true
+	case "Issue":
+		return &Issue{}, true
+	case "Activity":
+		return &Activity{}, true
+	case "Task":
+		return &Task{}, true
+	case "Opportunity":
+		return &Opportunity{}, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// WorkflowRuleStatistic keeps aggregate execution counts per rule. The counters are maintained as
+// executions complete, so they remain accurate after old executions are pruned.
+type WorkflowRuleStatistic struct {
+	WorkflowRuleID  uint                    `json:"WorkflowRuleID" gorm:"primaryKey;autoIncrement:false" odata:"key"`
+	SucceededCount  int64                   `json:"SucceededCount" gorm:"not null;default:0"`
+	FailedCount     int64                   `json:"FailedCount" gorm:"not null;default:0"`
+	LastStatus      WorkflowExecutionStatus `json:"LastStatus" gorm:"type:varchar(50)"`
+	LastRunAt       *time.Time              `json:"LastRunAt"`
+	LastSucceededAt *time.Time              `json:"LastSucceededAt"`
+	LastFailedAt    *time.Time              `json:"LastFailedAt"`
+	UpdatedAt       time.Time               `json:"UpdatedAt" gorm:"autoUpdateTime"`
+}
+
+// TableName defines the persisted table name for workflow rule statistics.
+func (WorkflowRuleStatistic) TableName() string {
+	return "workflow_rule_statistics"
+}
@@ -0,0 +1,279 @@
+package workflows
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// assignmentTarget exposes the owner field and the routing attributes of a new record.
+type assignmentTarget struct {
+	owner     **uint
+	source    string
+	country   string
+	industry  string
+	priority  models.IssuePriority
+	accountID uint
+}
+
+// assignOwners is a create callback that fills the owner of new leads, accounts and issues from
+// assignment rules. It runs inside the create transaction, so bulk inserts such as CSV imports are
+// routed as well and round-robin positions stay consistent across concurrent requests.
+func (e *Engine) assignOwners(tx *gorm.DB) {
+	if tx.Error != nil || tx.Statement == nil || tx.Statement.Schema == nil {
+		return
+	}
+
+	switch tx.Statement.Schema.Name {
+	case "Lead", "Account", "Issue":
+	default:
+		return
+	}
+
+	var records []interface{}
+	value := tx.Statement.ReflectValue
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if item := reflect.Indirect(value.Index(i)); item.CanAddr() {
+				records = append(records, item.Addr().Interface())
+			}
+		}
+	case reflect.Struct:
+		if value.CanAddr() {
+			records = append(records, value.Addr().Interface())
+		}
+	}
+
+	if err := AssignOwners(tx.Session(&gorm.Session{NewDB: true}), tx.Statement.Schema.Name, records); err != nil {
+		log.Printf("workflow engine failed to apply assignment rules: %v", err)
+	}
+}
+
+// AssignOwners sets the owner of records that have none using the active assignment rules for entityType.
+// records must be pointers to models.Lead, models.Account or models.Issue.
+func AssignOwners(db *gorm.DB, entityType string, records []interface{}) error {
+	var targets []*assignmentTarget
+	for _, record := range records {
+		if target := newAssignmentTarget(record); target != nil && *target.owner == nil {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	var rules []models.AssignmentRule
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("is_active = ? AND entity_type = ?", true, entityType).
+		Order("sort_order ASC, id ASC").
+		Find(&rules).Error; err != nil {
+		return fmt.Errorf("load assignment rules: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	state := &assignmentState{db: db, entityType: entityType}
+	if entityType == "Issue" {
+		if err := state.loadIssueAccounts(targets); err != nil {
+			return err
+		}
+	}
+
+	assigned := make(map[int]bool)
+	for _, target := range targets {
+		for i := range rules {
+			rule := &rules[i]
+			if !rule.Matches(target.source, target.country, target.industry, target.priority) {
+				continue
+			}
+
+			employeeID, ok, err := state.pick(rule, target)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+
+			id := employeeID
+			*target.owner = &id
+			rule.LastAssignedEmployeeID = &id
+			assigned[i] = true
+			break
+		}
+	}
+
+	for i := range assigned {
+		if err := db.Model(&models.AssignmentRule{}).Where("id = ?", rules[i].ID).
+			UpdateColumn("last_assigned_employee_id", rules[i].LastAssignedEmployeeID).Error; err != nil {
+			return fmt.Errorf("update assignment rule %d: %w", rules[i].ID, err)
+		}
+	}
+
+	return nil
+}
+
+func newAssignmentTarget(record interface{}) *assignmentTarget {
+	switch r := record.(type) {
+	case *models.Lead:
+		return &assignmentTarget{owner: &r.OwnerEmployeeID, source: r.Source}
+	case *models.Account:
+		return &assignmentTarget{owner: &r.EmployeeID, country: r.Country, industry: r.Industry}
+	case *models.Issue:
+		return &assignmentTarget{owner: &r.EmployeeID, priority: r.Priority, accountID: r.AccountID}
+	default:
+		return nil
+	}
+}
+
+// assignmentState caches lookups shared by all records of one create statement.
+type assignmentState struct {
+	db         *gorm.DB
+	entityType string
+	employees  map[uint]models.Employee
+	everyone   []uint
+	workload   map[uint]int64
+}
+
+// loadIssueAccounts copies the country and industry of each issue's account onto its target.
+func (s *assignmentState) loadIssueAccounts(targets []*assignmentTarget) error {
+	ids := make([]uint, 0, len(targets))
+	for _, target := range targets {
+		ids = append(ids, target.accountID)
+	}
+
+	var accounts []models.Account
+	if err := s.db.Select("id", "country", "industry").Where("id IN ?", ids).Find(&accounts).Error; err != nil {
+		return fmt.Errorf("load issue accounts: %w", err)
+	}
+
+	byID := make(map[uint]models.Account, len(accounts))
+	for _, account := range accounts {
+		byID[account.ID] = account
+	}
+	for _, target := range targets {
+		account := byID[target.accountID]
+		target.country = account.Country
+		target.industry = account.Industry
+	}
+	return nil
+}
+
+// pick selects the employee for a target according to the rule strategy.
+func (s *assignmentState) pick(rule *models.AssignmentRule, target *assignmentTarget) (uint, bool, error) {
+	if err := s.loadEmployees(); err != nil {
+		return 0, false, err
+	}
+
+	candidates := make([]uint, 0, len(rule.EmployeeIDs))
+	pool := rule.EmployeeIDs
+	if len(pool) == 0 && rule.Strategy == models.AssignmentStrategyTerritory {
+		pool = s.everyone
+	}
+	for _, id := range pool {
+		employee, ok := s.employees[id]
+		if !ok {
+			continue
+		}
+		if rule.Strategy == models.AssignmentStrategyTerritory && !models.CoversTerritory(employee.Territory, target.country) {
+			continue
+		}
+		candidates = append(candidates, id)
+	}
+	if len(candidates) == 0 {
+		return 0, false, nil
+	}
+
+	if rule.Strategy == models.AssignmentStrategyLeastOpenWorkload {
+		if err := s.loadWorkload(); err != nil {
+			return 0, false, err
+		}
+		best := candidates[0]
+		for _, id := range candidates[1:] {
+			if s.workload[id] < s.workload[best] {
+				best = id
+			}
+		}
+		s.workload[best]++
+		return best, true, nil
+	}
+
+	next := candidates[0]
+	if rule.LastAssignedEmployeeID != nil {
+		for i, id := range candidates {
+			if id == *rule.LastAssignedEmployeeID {
+				next = candidates[(i+1)%len(candidates)]
+				break
+			}
+		}
+	}
+	if s.workload != nil {
+		s.workload[next]++
+	}
+	return next, true, nil
+}
+
+func (s *assignmentState) loadEmployees() error {
+	if s.employees != nil {
+		return nil
+	}
+
+	var employees []models.Employee
+	if err := s.db.Select("id", "territory").Order("id ASC").Find(&employees).Error; err != nil {
+		return fmt.Errorf("load employees: %w", err)
+	}
+
+	s.employees = make(map[uint]models.Employee, len(employees))
+	for _, employee := range employees {
+		s.employees[employee.ID] = employee
+		s.everyone = append(s.everyone, employee.ID)
+	}
+	return nil
+}
+
+// loadWorkload counts the open records each employee owns for the statement's entity type.
+func (s *assignmentState) loadWorkload() error {
+	if s.workload != nil {
+		return nil
+	}
+
+	type ownerCount struct {
+		OwnerID uint
+		Total   int64
+	}
+	var counts []ownerCount
+
+	var query *gorm.DB
+	switch s.entityType {
+	case "Lead":
+		query = s.db.Model(&models.Lead{}).
+			Select("owner_employee_id AS owner_id, COUNT(*) AS total").
+			Where("owner_employee_id IS NOT NULL AND status NOT IN ?", []models.LeadStatus{models.LeadStatusConverted, models.LeadStatusDisqualified}).
+			Group("owner_employee_id")
+	case "Issue":
+		query = s.db.Model(&models.Issue{}).
+			Select("employee_id AS owner_id, COUNT(*) AS total").
+			Where("employee_id IS NOT NULL AND status NOT IN ?", []models.IssueStatus{models.IssueStatusResolved, models.IssueStatusClosed}).
+			Group("employee_id")
+	default:
+		query = s.db.Model(&models.Account{}).
+			Select("employee_id AS owner_id, COUNT(*) AS total").
+			Where("employee_id IS NOT NULL").
+			Group("employee_id")
+	}
+	if err := query.Scan(&counts).Error; err != nil {
+		return fmt.Errorf("load open workload: %w", err)
+	}
+
+	s.workload = make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		s.workload[count.OwnerID] = count.Total
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package workflows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultBackfillBatchSize  = 100
+	defaultBackfillMaxRecords = 500
+	maxBackfillRecords        = 10000
+)
+
+// errBackfillCapReached stops batch iteration once the affected record cap is hit.
+var errBackfillCapReached = errors.New("workflow backfill cap reached")
+
+// errBackfillLimitReached stops batch iteration once the rule exceeded a rate limit and was disabled.
+var errBackfillLimitReached = errors.New("workflow backfill rate limit reached")
+
+// BackfillOptions controls how a rule is applied to existing records.
+type BackfillOptions struct {
+	// BatchSize is the number of records loaded per query.
+	BatchSize int
+	// MaxRecords caps how many records the action may be executed for.
+	MaxRecords int
+	// OnProgress is invoked after each batch with cumulative counts, which are also kept in BackfillResult.Progress.
+	OnProgress func(BackfillProgress)
+}
+
+// BackfillProgress holds cumulative counters for a backfill run.
+type BackfillProgress struct {
+	Batches  int `json:"Batches"`
+	Scanned  int `json:"Scanned"`
+	Matched  int `json:"Matched"`
+	Executed int `json:"Executed"`
+	Failed   int `json:"Failed"`
+	Skipped  int `json:"Skipped"`
+}
+
+// BackfillResult summarises a completed backfill run.
+type BackfillResult struct {
+	BackfillProgress
+	RuleID     uint `json:"RuleID"`
+	MaxRecords int  `json:"MaxRecords"`
+	CapReached bool `json:"CapReached"`
+	// LimitReason is set when the run stopped because the rule exceeded a rate limit, which also disables the rule.
+	LimitReason string `json:"LimitReason,omitempty"`
+	// Progress holds the cumulative counts after each batch, so callers can see how the run advanced.
+	Progress   []BackfillProgress `json:"Progress"`
+	StartedAt  time.Time          `json:"StartedAt"`
+	FinishedAt time.Time          `json:"FinishedAt"`
+}
+
+// RunOnExisting applies a rule's action to persisted records that currently satisfy its trigger.
+// Records that already have a successful execution for the rule are skipped.
+func (e *Engine) RunOnExisting(ctx context.Context, rule *models.WorkflowRule, opts BackfillOptions) (*BackfillResult, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBackfillBatchSize
+	}
+	if opts.MaxRecords <= 0 {
+		opts.MaxRecords = defaultBackfillMaxRecords
+	}
+	if opts.MaxRecords > maxBackfillRecords {
+		opts.MaxRecords = maxBackfillRecords
+	}
+
+	entity, ok := models.NewWorkflowEntity(rule.EntityType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported entity type: %s", rule.EntityType)
+	}
+
+	query, err := e.backfillQuery(ctx, rule, entity)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BackfillResult{
+		RuleID:     rule.ID,
+		MaxRecords: opts.MaxRecords,
+		Progress:   []BackfillProgress{},
+		StartedAt:  time.Now().UTC(),
+	}
+	progress := &result.BackfillProgress
+
+	batch := reflect.New(reflect.SliceOf(reflect.TypeOf(entity).Elem()))
+	err = query.FindInBatches(batch.Interface(), opts.BatchSize, func(tx *gorm.DB, _ int) error {
+		records := batch.Elem()
+		for i := 0; i < records.Len(); i++ {
+			progress.Scanned++
+
+			record := records.Index(i).Addr().Interface()
+			event := Event{
+				ModelName: rule.EntityType,
+				Type:      EventTypeScheduled,
+				NewState:  modelToMap(record),
+				Source:    "backfill",
+				Timestamp: time.Now().UTC(),
+			}
+			if id, ok := uintFromState(event.NewState["ID"]); ok {
+				event.PrimaryKey = id
+			}
+
+			matches, evalErr := e.matchesCurrentState(rule, event.NewState)
+			if evalErr != nil {
+				return evalErr
+			}
+			if !matches {
+				continue
+			}
+			progress.Matched++
+
+			if e.hasSuccessfulExecution(rule.ID, fmt.Sprint(event.PrimaryKey)) {
+				progress.Skipped++
+				continue
+			}
+
+			if reason := e.checkLimits(rule, event); reason != "" {
+				e.recordExecution(rule, event, models.WorkflowExecutionStatusFailed, "", errors.New(reason))
+				e.disableRule(rule, reason)
+				result.LimitReason = reason
+				break
+			}
+
+			if err := e.runAction(ctx, rule, event); err != nil {
+				progress.Failed++
+			} else {
+				progress.Executed++
+			}
+
+			if progress.Executed+progress.Failed >= opts.MaxRecords {
+				result.CapReached = true
+				break
+			}
+		}
+
+		progress.Batches++
+		result.Progress = append(result.Progress, *progress)
+		if opts.OnProgress != nil {
+			opts.OnProgress(*progress)
+		}
+		if result.CapReached {
+			return errBackfillCapReached
+		}
+		if result.LimitReason != "" {
+			return errBackfillLimitReached
+		}
+		return nil
+	}).Error
+	if err != nil && !errors.Is(err, errBackfillCapReached) && !errors.Is(err, errBackfillLimitReached) {
+		return nil, err
+	}
+
+	result.FinishedAt = time.Now().UTC()
+	log.Printf("workflow rule %d backfill finished: scanned=%d matched=%d executed=%d failed=%d skipped=%d",
+		rule.ID, progress.Scanned, progress.Matched, progress.Executed, progress.Failed, progress.Skipped)
+
+	return result, nil
+}
+
+// backfillQuery narrows the scan to records that can satisfy the trigger so large tables are not read in full.
+func (e *Engine) backfillQuery(ctx context.Context, rule *models.WorkflowRule, entity interface{}) (*gorm.DB, error) {
+	query := e.db.WithContext(ctx).Model(entity)
+
+	switch rule.TriggerType {
+	case models.WorkflowTriggerLeadStatusChanged:
+		var config LeadStatusTriggerConfig
+		if err := decodeJSONMap(rule.TriggerConfig, &config); err != nil {
+			return nil, err
+		}
+		if config.Status == "" {
+			return nil, errors.New("lead status trigger requires a status value")
+		}
+		query = query.Where("status = ?", config.Status)
+	case models.WorkflowTriggerTaskOverdue:
+		query = query.Where("due_date < ? AND completed_at IS NULL AND status <> ?", time.Now().UTC(), models.TaskStatusCompleted)
+	default:
+		return nil, fmt.Errorf("unsupported trigger type: %s", rule.TriggerType)
+	}
+
+	return query, nil
+}
+
+// matchesCurrentState reports whether a record's current state satisfies the rule trigger.
+// Change-based triggers are treated as "is currently in the target state" for backfills.
+func (e *Engine) matchesCurrentState(rule *models.WorkflowRule, state map[string]interface{}) (bool, error) {
+	switch rule.TriggerType {
+	case models.WorkflowTriggerLeadStatusChanged:
+		var config LeadStatusTriggerConfig
+		if err := decodeJSONMap(rule.TriggerConfig, &config); err != nil {
+			return false, err
+		}
+		status, ok := stringFromState(state["Status"])
+		return ok && status == config.Status, nil
+	case models.WorkflowTriggerTaskOverdue:
+		var config TaskOverdueTriggerConfig
+		if err := decodeJSONMap(rule.TriggerConfig, &config); err != nil {
+			return false, err
+		}
+		return isTaskOverdue(state, config.GraceMinutes), nil
+	default:
+		return false, fmt.Errorf("unsupported trigger type: %s", rule.TriggerType)
+	}
+}
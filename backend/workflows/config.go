@@ -0,0 +1,61 @@
+package workflows
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds the safety limits applied by the workflow engine.
+type Config struct {
+	// MaxChainDepth is how many rule executions may trigger each other before the chain is stopped.
+	MaxChainDepth int
+	// DefaultMaxExecutionsPerMinute applies to rules without their own limit. Zero disables the check.
+	DefaultMaxExecutionsPerMinute int
+	// DefaultMaxExecutionsPerEntity limits executions for a single entity within one minute. Zero disables the check.
+	DefaultMaxExecutionsPerEntity int
+	// RetentionInterval is how often retention policies are applied. Zero disables the pruning job.
+	RetentionInterval time.Duration
+	// ArchiveDir receives compressed archives of pruned executions for policies that request them.
+	ArchiveDir string
+	// LeadScoreInterval is how often every lead is rescored, so activity points decay and leave their window
+	// without a change to the lead. Zero disables the refresh.
+	LeadScoreInterval time.Duration
+}
+
+// DefaultConfig returns the limits used when no environment overrides are set.
+func DefaultConfig() Config {
+	return Config{
+		MaxChainDepth:                 5,
+		DefaultMaxExecutionsPerMinute: 120,
+		DefaultMaxExecutionsPerEntity: 10,
+		RetentionInterval:             time.Hour,
+		LeadScoreInterval:             time.Hour,
+	}
+}
+
+// ConfigFromEnv reads engine limits from WORKFLOW_* environment variables, falling back to DefaultConfig.
+func ConfigFromEnv() Config {
+	config := DefaultConfig()
+	config.MaxChainDepth = envInt("WORKFLOW_MAX_CHAIN_DEPTH", config.MaxChainDepth)
+	config.DefaultMaxExecutionsPerMinute = envInt("WORKFLOW_MAX_EXECUTIONS_PER_MINUTE", config.DefaultMaxExecutionsPerMinute)
+	config.DefaultMaxExecutionsPerEntity = envInt("WORKFLOW_MAX_EXECUTIONS_PER_ENTITY", config.DefaultMaxExecutionsPerEntity)
+	config.RetentionInterval = time.Duration(envInt("WORKFLOW_RETENTION_INTERVAL_MINUTES", int(config.RetentionInterval/time.Minute))) * time.Minute
+	config.ArchiveDir = os.Getenv("WORKFLOW_ARCHIVE_DIR")
+	config.LeadScoreInterval = time.Duration(envInt("WORKFLOW_LEAD_SCORE_INTERVAL_MINUTES", int(config.LeadScoreInterval/time.Minute))) * time.Minute
+	return config
+}
+
+func envInt(key string, defaultValue int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		log.Printf("ignoring invalid %s value %q", key, raw)
+		return defaultValue
+	}
+	return value
+}
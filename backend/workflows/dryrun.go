@@ -0,0 +1,192 @@
+package workflows
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+)
+
+// ErrEntityNotFound is returned when a rule test references an entity that does not exist.
+var ErrEntityNotFound = errors.New("workflow test entity not found")
+
+// errSimulationRollback aborts simulated writes once their validation has run.
+var errSimulationRollback = errors.New("workflow simulation rollback")
+
+// RuleTestInput describes the entity state a rule should be evaluated against.
+// When EntityID is set the persisted entity is loaded and OldState/NewState are
+// applied on top of it as overrides; otherwise the states are used as given.
+type RuleTestInput struct {
+	EntityID  *uint
+	EventType EventType
+	OldState  map[string]interface{}
+	NewState  map[string]interface{}
+}
+
+// RuleTestResult reports what a rule would do for an event without persisting anything.
+type RuleTestResult struct {
+	Matches          bool                      `json:"Matches"`
+	EventType        EventType                 `json:"EventType"`
+	EvaluationError  string                    `json:"EvaluationError,omitempty"`
+	AlreadyExecuted  bool                      `json:"AlreadyExecuted"`
+	ActionType       models.WorkflowActionType `json:"ActionType"`
+	ResolvedAction   map[string]interface{}    `json:"ResolvedAction,omitempty"`
+	ValidationErrors []string                  `json:"ValidationErrors"`
+}
+
+// TestRule evaluates a rule against a real or synthetic event and simulates its action.
+// Simulated writes run inside a rolled back transaction with workflow events suppressed.
+func (e *Engine) TestRule(ctx context.Context, rule *models.WorkflowRule, input RuleTestInput) (*RuleTestResult, error) {
+	event, err := e.buildTestEvent(rule, input)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RuleTestResult{
+		EventType:        event.Type,
+		ActionType:       rule.ActionType,
+		ValidationErrors: []string{},
+	}
+
+	matches, evalErr := e.evaluateRule(rule, event)
+	if evalErr != nil {
+		result.EvaluationError = evalErr.Error()
+	}
+	result.Matches = matches && evalErr == nil
+
+	if rule.TriggerType == models.WorkflowTriggerTaskOverdue && event.PrimaryKey != nil {
+		result.AlreadyExecuted = e.hasSuccessfulExecution(rule.ID, fmt.Sprint(event.PrimaryKey))
+	}
+
+	resolved, problems := e.simulateAction(ctx, rule, event)
+	result.ResolvedAction = resolved
+	for _, problem := range problems {
+		result.ValidationErrors = append(result.ValidationErrors, problem.Error())
+	}
+
+	return result, nil
+}
+
+func (e *Engine) buildTestEvent(rule *models.WorkflowRule, input RuleTestInput) (Event, error) {
+	event := Event{
+		ModelName: rule.EntityType,
+		Type:      input.EventType,
+		Timestamp: time.Now().UTC(),
+		Source:    "test",
+	}
+
+	if input.EntityID != nil {
+		entity, ok := models.NewWorkflowEntity(rule.EntityType)
+		if !ok {
+			return Event{}, fmt.Errorf("unsupported entity type: %s", rule.EntityType)
+		}
+		if err := e.db.First(entity, *input.EntityID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return Event{}, ErrEntityNotFound
+			}
+			return Event{}, err
+		}
+
+		current := modelToMap(entity)
+		event.PrimaryKey = *input.EntityID
+		event.NewState = mergeState(current, input.NewState)
+		if input.OldState != nil || event.Type == EventTypeUpdated {
+			event.OldState = mergeState(current, input.OldState)
+		}
+	} else {
+		event.NewState = input.NewState
+		event.OldState = input.OldState
+		if id, ok := uintFromState(input.NewState["ID"]); ok {
+			event.PrimaryKey = id
+		}
+	}
+
+	if event.Type == "" {
+		switch {
+		case rule.TriggerType == models.WorkflowTriggerTaskOverdue:
+			event.Type = EventTypeScheduled
+		case event.OldState != nil:
+			event.Type = EventTypeUpdated
+		default:
+			event.Type = EventTypeCreated
+		}
+	}
+
+	return event, nil
+}
+
+// simulateAction resolves the action for an event and reports every problem that would make it fail.
+func (e *Engine) simulateAction(ctx context.Context, rule *models.WorkflowRule, event Event) (map[string]interface{}, []error) {
+	switch rule.ActionType {
+	case models.WorkflowActionCreateFollowUpTask:
+		var config FollowUpTaskActionConfig
+		if err := decodeJSONMap(rule.ActionConfig, &config); err != nil {
+			return nil, []error{err}
+		}
+		task, err := buildFollowUpTask(config, event)
+		if err != nil {
+			return nil, unwrapJoined(err)
+		}
+
+		resolved := map[string]interface{}{
+			"Title":       task.Title,
+			"Description": task.Description,
+			"Owner":       task.Owner,
+			"Status":      task.Status.String(),
+			"DueDate":     task.DueDate,
+			"AccountID":   task.AccountID,
+			"ContactID":   task.ContactID,
+			"EmployeeID":  task.EmployeeID,
+		}
+
+		// Run the insert for real so model hooks and database constraints are checked, then roll it back.
+		err = e.db.WithContext(WithoutEvents(ctx)).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&task).Error; err != nil {
+				return err
+			}
+			return errSimulationRollback
+		})
+		if err != nil && !errors.Is(err, errSimulationRollback) {
+			return resolved, []error{fmt.Errorf("create follow-up task: %w", err)}
+		}
+		return resolved, nil
+
+	case models.WorkflowActionSendNotification:
+		var config NotificationActionConfig
+		if err := decodeJSONMap(rule.ActionConfig, &config); err != nil {
+			return nil, []error{err}
+		}
+		resolved := map[string]interface{}{
+			"Message": config.Message,
+			"Channel": config.Channel,
+		}
+		if config.Message == "" {
+			return resolved, []error{errors.New("notification action requires a message")}
+		}
+		return resolved, nil
+
+	default:
+		return nil, []error{fmt.Errorf("unsupported action type: %s", rule.ActionType)}
+	}
+}
+
+func mergeState(base map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
+
+func unwrapJoined(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
@@ -1,6 +1,7 @@
 package workflows
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -33,6 +34,30 @@ type Event struct {
 	OldState   map[string]interface{}
 	Timestamp  time.Time
 	Source     string
+	// Depth counts how many rule executions led to this event; zero for changes made by users.
+	Depth int
+	// CausationExecutionID is the execution whose action produced this event, if any.
+	CausationExecutionID *uint
+	// rescoreOnly marks updates given as a map, which do not run workflow rules but may change lead scores.
+	rescoreOnly bool
+}
+
+type contextKey string
+
+const suppressEventsKey contextKey = "workflow:suppress_events"
+
+// WithoutEvents returns a context that prevents statements executed with it from emitting workflow events.
+// It is used for simulations and previews whose writes are rolled back.
+func WithoutEvents(ctx context.Context) context.Context {
+	return context.WithValue(ctx, suppressEventsKey, true)
+}
+
+func eventsSuppressed(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	suppressed, _ := ctx.Value(suppressEventsKey).(bool)
+	return suppressed
 }
 
 // Engine wires GORM model callbacks to workflow rule evaluation.
@@ -43,20 +68,28 @@ type Engine struct {
 	once         sync.Once
 	overdueCache map[string]struct{}
 	cacheMu      sync.Mutex
+	config       Config
+	limiter      *rateLimiter
 }
 
 // NewEngine constructs a workflow engine bound to the provided database connection.
-func NewEngine(db *gorm.DB) *Engine {
+func NewEngine(db *gorm.DB, config Config) *Engine {
 	return &Engine{
 		db:           db,
 		events:       make(chan Event, 128),
 		stop:         make(chan struct{}),
 		overdueCache: make(map[string]struct{}),
+		config:       config,
+		limiter:      newRateLimiter(),
 	}
 }
 
 // RegisterCallbacks hooks into GORM lifecycle events to emit workflow events.
 func (e *Engine) RegisterCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("workflow:assign_owner", e.assignOwners); err != nil {
+		return fmt.Errorf("register assignment callback: %w", err)
+	}
+
 	if err := db.Callback().Create().After("gorm:after_create").Register("workflow:after_create", e.afterCreate); err != nil {
 		return fmt.Errorf("register create callback: %w", err)
 	}
@@ -79,8 +112,11 @@ func (e *Engine) RegisterCallbacks(db *gorm.DB) error {
 // Start begins processing workflow events and scheduled checks.
 func (e *Engine) Start() {
 	e.once.Do(func() {
+		e.initializeStatistics()
 		go e.run()
 		go e.monitorOverdueTasks()
+		go e.monitorRetention()
+		go e.monitorLeadScores()
 	})
 }
 
@@ -178,8 +214,7 @@ func (e *Engine) buildEvent(tx *gorm.DB, eventType EventType) *Event {
 		return nil
 	}
 
-	payload := modelToMap(tx.Statement.Dest)
-	if payload == nil {
+	if eventsSuppressed(tx.Statement.Context) {
 		return nil
 	}
 
@@ -191,12 +226,24 @@ func (e *Engine) buildEvent(tx *gorm.DB, eventType EventType) *Event {
 		}
 	}
 
+	payload := modelToMap(tx.Statement.Dest)
+	rescoreOnly := false
+	if payload == nil && eventType == EventTypeUpdated && primaryValue != nil && scoredModel(tx.Statement.Schema.Name) {
+		// Updates given as a map, such as PATCH requests, are applied to the model, which holds the new state
+		payload = modelToMap(tx.Statement.Model)
+		rescoreOnly = true
+	}
+	if payload == nil {
+		return nil
+	}
+
 	event := &Event{
-		Entity:     tx.Statement.Table,
-		ModelName:  tx.Statement.Schema.Name,
-		Type:       eventType,
-		NewState:   payload,
-		PrimaryKey: primaryValue,
+		Entity:      tx.Statement.Table,
+		ModelName:   tx.Statement.Schema.Name,
+		Type:        eventType,
+		NewState:    payload,
+		PrimaryKey:  primaryValue,
+		rescoreOnly: rescoreOnly,
 	}
 
 	if eventType == EventTypeDeleted {
@@ -204,11 +251,24 @@ func (e *Engine) buildEvent(tx *gorm.DB, eventType EventType) *Event {
 		event.NewState = nil
 	}
 
+	if cause, ok := causationFrom(tx.Statement.Context); ok {
+		event.Depth = cause.depth + 1
+		if cause.executionID != 0 {
+			executionID := cause.executionID
+			event.CausationExecutionID = &executionID
+		}
+	}
+
 	return event
 }
 
 func (e *Engine) handleEvent(event Event) {
+	if event.rescoreOnly {
+		e.rescoreForEvent(event)
+		return
+	}
 	e.updateOverdueCache(event)
+	e.rescoreForEvent(event)
 
 	var rules []models.WorkflowRule
 	if err := e.db.Where("is_active = ? AND entity_type = ?", true, event.ModelName).Find(&rules).Error; err != nil {
@@ -234,15 +294,25 @@ func (e *Engine) handleEvent(event Event) {
 			}
 		}
 
-		summary, actionErr := e.executeAction(&rule, event)
-		status := models.WorkflowExecutionStatusSucceeded
-		if actionErr != nil {
-			status = models.WorkflowExecutionStatusFailed
+		if reason := e.checkLimits(&rule, event); reason != "" {
+			e.recordExecution(&rule, event, models.WorkflowExecutionStatusFailed, "", errors.New(reason))
+			e.disableRule(&rule, reason)
+			continue
 		}
-		e.recordExecution(&rule, event, status, summary, actionErr)
+
+		e.runAction(context.Background(), &rule, event)
 	}
 }
 
+// runAction executes the rule action, tracking it as a pending execution while it runs.
+// Writes made by the action carry the execution as their cause so chained events can be traced and capped.
+func (e *Engine) runAction(ctx context.Context, rule *models.WorkflowRule, event Event) error {
+	execution := e.startExecution(rule, event)
+	summary, actionErr := e.executeAction(withCausation(ctx, execution.ID, event.Depth), rule, event)
+	e.finishExecution(execution, summary, actionErr)
+	return actionErr
+}
+
 func (e *Engine) evaluateRule(rule *models.WorkflowRule, event Event) (bool, error) {
 	switch rule.TriggerType {
 	case models.WorkflowTriggerLeadStatusChanged:
@@ -256,13 +326,10 @@ func (e *Engine) evaluateRule(rule *models.WorkflowRule, event Event) (bool, err
 		if config.Status == "" {
 			return false, errors.New("lead status trigger requires a status value")
 		}
-		newStatus, newOK := event.NewState["Status"].(string)
+		newStatus, newOK := stringFromState(event.NewState["Status"])
 		oldStatus, oldOK := "", false
 		if event.OldState != nil {
-			if v, ok := event.OldState["Status"].(string); ok {
-				oldStatus = v
-				oldOK = true
-			}
+			oldStatus, oldOK = stringFromState(event.OldState["Status"])
 		}
 		if !newOK {
 			return false, errors.New("unable to determine new lead status")
@@ -286,14 +353,14 @@ func (e *Engine) evaluateRule(rule *models.WorkflowRule, event Event) (bool, err
 	}
 }
 
-func (e *Engine) executeAction(rule *models.WorkflowRule, event Event) (string, error) {
+func (e *Engine) executeAction(ctx context.Context, rule *models.WorkflowRule, event Event) (string, error) {
 	switch rule.ActionType {
 	case models.WorkflowActionCreateFollowUpTask:
 		var config FollowUpTaskActionConfig
 		if err := decodeJSONMap(rule.ActionConfig, &config); err != nil {
 			return "", err
 		}
-		return e.createFollowUpTask(config, event)
+		return e.createFollowUpTask(ctx, config, event)
 	case models.WorkflowActionSendNotification:
 		var config NotificationActionConfig
 		if err := decodeJSONMap(rule.ActionConfig, &config); err != nil {
@@ -309,17 +376,37 @@ func (e *Engine) executeAction(rule *models.WorkflowRule, event Event) (string,
 	}
 }
 
-func (e *Engine) createFollowUpTask(config FollowUpTaskActionConfig, event Event) (string, error) {
+func (e *Engine) createFollowUpTask(ctx context.Context, config FollowUpTaskActionConfig, event Event) (string, error) {
+	task, err := buildFollowUpTask(config, event)
+	if err != nil {
+		return "", err
+	}
+
+	if err := e.db.WithContext(ctx).Create(&task).Error; err != nil {
+		return "", fmt.Errorf("create follow-up task: %w", err)
+	}
+
+	return fmt.Sprintf("Created Task #%d", task.ID), nil
+}
+
+// buildFollowUpTask resolves the task described by the action config without persisting it.
+// All configuration problems are reported together so previews can list them at once.
+func buildFollowUpTask(config FollowUpTaskActionConfig, event Event) (models.Task, error) {
+	var problems []error
 	if config.Title == "" {
-		return "", errors.New("follow-up task action requires a title")
+		problems = append(problems, errors.New("follow-up task action requires a title"))
 	}
 	if config.Owner == "" {
-		return "", errors.New("follow-up task action requires an owner")
+		problems = append(problems, errors.New("follow-up task action requires an owner"))
 	}
 
 	accountID, err := config.ResolveAccountID(event)
 	if err != nil {
-		return "", err
+		problems = append(problems, err)
+	}
+
+	if len(problems) > 0 {
+		return models.Task{}, errors.Join(problems...)
 	}
 
 	dueDate := time.Now().UTC().Add(24 * time.Duration(config.DueInDays) * time.Hour)
@@ -341,51 +428,18 @@ func (e *Engine) createFollowUpTask(config FollowUpTaskActionConfig, event Event
 	}
 
 	if config.ContactIDField != "" {
-		if contactVal, ok := event.NewState[config.ContactIDField]; ok {
-			switch v := contactVal.(type) {
-			case int:
-				id := uint(v)
-				task.ContactID = &id
-			case int64:
-				id := uint(v)
-				task.ContactID = &id
-			case float64:
-				id := uint(v)
-				task.ContactID = &id
-			case uint:
-				id := v
-				task.ContactID = &id
-			}
+		if id, ok := uintFromState(event.NewState[config.ContactIDField]); ok {
+			task.ContactID = &id
 		}
 	}
 
-	if err := e.db.Create(&task).Error; err != nil {
-		return "", fmt.Errorf("create follow-up task: %w", err)
-	}
-
-	return fmt.Sprintf("Created Task #%d", task.ID), nil
+	return task, nil
 }
 
 func (e *Engine) recordExecution(rule *models.WorkflowRule, event Event, status models.WorkflowExecutionStatus, summary string, execErr error) {
-	payload := map[string]interface{}{}
-	if event.NewState != nil {
-		payload["new"] = event.NewState
-	}
-	if event.OldState != nil {
-		payload["old"] = event.OldState
-	}
-
-	execution := models.WorkflowExecution{
-		WorkflowRuleID: rule.ID,
-		TriggerEvent:   string(event.Type),
-		EntityType:     event.ModelName,
-		EntityID:       fmt.Sprint(event.PrimaryKey),
-		EventSource:    event.Source,
-		Status:         status,
-		ResultSummary:  summary,
-		EventPayload:   payload,
-		ActionType:     rule.ActionType,
-	}
+	execution := newExecution(rule, event)
+	execution.Status = status
+	execution.ResultSummary = summary
 
 	if execErr != nil {
 		execution.ErrorMessage = execErr.Error()
@@ -394,6 +448,7 @@ func (e *Engine) recordExecution(rule *models.WorkflowRule, event Event, status
 	if status != models.WorkflowExecutionStatusPending {
 		now := time.Now().UTC()
 		execution.CompletedAt = &now
+		e.recordStatistic(rule.ID, status, now)
 	}
 
 	if err := e.db.Create(&execution).Error; err != nil {
@@ -401,18 +456,81 @@ func (e *Engine) recordExecution(rule *models.WorkflowRule, event Event, status
 	}
 }
 
+// startExecution records a pending execution before its action runs.
+func (e *Engine) startExecution(rule *models.WorkflowRule, event Event) *models.WorkflowExecution {
+	execution := newExecution(rule, event)
+	execution.Status = models.WorkflowExecutionStatusPending
+	if err := e.db.Create(&execution).Error; err != nil {
+		log.Printf("workflow engine failed to record execution: %v", err)
+	}
+	return &execution
+}
+
+// finishExecution stores the outcome of a pending execution.
+func (e *Engine) finishExecution(execution *models.WorkflowExecution, summary string, execErr error) {
+	now := time.Now().UTC()
+	execution.Status = models.WorkflowExecutionStatusSucceeded
+	execution.ResultSummary = summary
+	execution.CompletedAt = &now
+	if execErr != nil {
+		execution.Status = models.WorkflowExecutionStatusFailed
+		execution.ErrorMessage = execErr.Error()
+	}
+	e.recordStatistic(execution.WorkflowRuleID, execution.Status, now)
+
+	if execution.ID == 0 {
+		if err := e.db.Create(execution).Error; err != nil {
+			log.Printf("workflow engine failed to record execution: %v", err)
+		}
+		return
+	}
+
+	if err := e.db.Model(execution).Updates(map[string]interface{}{
+		"status":         execution.Status,
+		"result_summary": execution.ResultSummary,
+		"error_message":  execution.ErrorMessage,
+		"completed_at":   execution.CompletedAt,
+	}).Error; err != nil {
+		log.Printf("workflow engine failed to update execution %d: %v", execution.ID, err)
+	}
+}
+
+func newExecution(rule *models.WorkflowRule, event Event) models.WorkflowExecution {
+	payload := map[string]interface{}{}
+	if event.NewState != nil {
+		payload["new"] = event.NewState
+	}
+	if event.OldState != nil {
+		payload["old"] = event.OldState
+	}
+
+	return models.WorkflowExecution{
+		WorkflowRuleID:       rule.ID,
+		TriggerEvent:         string(event.Type),
+		EntityType:           event.ModelName,
+		EntityID:             fmt.Sprint(event.PrimaryKey),
+		EventSource:          event.Source,
+		EventPayload:         payload,
+		ActionType:           rule.ActionType,
+		ChainDepth:           event.Depth,
+		CausationExecutionID: event.CausationExecutionID,
+	}
+}
+
 func (e *Engine) hasSuccessfulExecution(ruleID uint, entityID string) bool {
 	if entityID == "" {
 		return false
 	}
-	var count int64
+	// Limit(1) lets the lookup stop at the first row of idx_workflow_executions_dedup instead of counting them all.
+	var ids []uint
 	if err := e.db.Model(&models.WorkflowExecution{}).
 		Where("workflow_rule_id = ? AND entity_id = ? AND status = ?", ruleID, entityID, models.WorkflowExecutionStatusSucceeded).
-		Count(&count).Error; err != nil {
+		Limit(1).
+		Pluck("id", &ids).Error; err != nil {
 		log.Printf("workflow engine failed to query execution history: %v", err)
 		return false
 	}
-	return count > 0
+	return len(ids) > 0
 }
 
 func (e *Engine) monitorOverdueTasks() {
@@ -527,17 +645,8 @@ func (c FollowUpTaskActionConfig) ResolveAccountID(event Event) (uint, error) {
 		return *c.AccountID, nil
 	}
 	if c.AccountIDField != "" && event.NewState != nil {
-		if value, ok := event.NewState[c.AccountIDField]; ok {
-			switch v := value.(type) {
-			case int:
-				return uint(v), nil
-			case int64:
-				return uint(v), nil
-			case float64:
-				return uint(v), nil
-			case uint:
-				return v, nil
-			}
+		if id, ok := uintFromState(event.NewState[c.AccountIDField]); ok {
+			return id, nil
 		}
 	}
 	return 0, errors.New("follow-up task action requires an account reference")
@@ -549,6 +658,53 @@ type NotificationActionConfig struct {
 	Channel string `json:"channel"`
 }
 
+// uintFromState converts an identifier taken from an event state map. States built from models
+// hold typed values (including *uint for optional keys) while JSON supplied states hold float64.
+func uintFromState(value interface{}) (uint, bool) {
+	switch v := value.(type) {
+	case int:
+		return uint(v), true
+	case int64:
+		return uint(v), true
+	case float64:
+		return uint(v), true
+	case uint:
+		return v, true
+	case *uint:
+		if v == nil {
+			return 0, false
+		}
+		return *v, true
+	default:
+		return 0, false
+	}
+}
+
+// stringFromState reads a string value from an event state, including named string types such as models.LeadStatus.
+func stringFromState(value interface{}) (string, bool) {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || rv.Kind() != reflect.String {
+		return "", false
+	}
+	return rv.String(), true
+}
+
+// intFromState reads an integer value from an event state, including enum types such as models.TaskStatus.
+func intFromState(value interface{}) (int64, bool) {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return 0, false
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Float32, reflect.Float64:
+		return int64(rv.Float()), true
+	default:
+		return 0, false
+	}
+}
+
 func modelToMap(value interface{}) map[string]interface{} {
 	if value == nil {
 		return nil
@@ -609,21 +765,9 @@ func isTaskOverdue(state map[string]interface{}, graceMinutes int) bool {
 	if state == nil {
 		return false
 	}
-	statusVal, hasStatus := state["Status"]
-	if hasStatus {
-		switch v := statusVal.(type) {
-		case int64:
-			if models.TaskStatus(v) == models.TaskStatusCompleted {
-				return false
-			}
-		case int:
-			if models.TaskStatus(v) == models.TaskStatusCompleted {
-				return false
-			}
-		case float64:
-			if models.TaskStatus(int(v)) == models.TaskStatusCompleted {
-				return false
-			}
+	if status, ok := intFromState(state["Status"]); ok {
+		if models.TaskStatus(status) == models.TaskStatusCompleted {
+			return false
 		}
 	}
 
@@ -0,0 +1,162 @@
+package workflows
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nlstn/my-crm/backend/models"
+)
+
+const rateLimitWindow = time.Minute
+
+// causation identifies the execution whose action produced a database write.
+type causation struct {
+	executionID uint
+	depth       int
+}
+
+const causationKey contextKey = "workflow:causation"
+
+// withCausation marks writes made with the returned context as caused by a rule execution at the given depth.
+func withCausation(ctx context.Context, executionID uint, depth int) context.Context {
+	return context.WithValue(ctx, causationKey, causation{executionID: executionID, depth: depth})
+}
+
+func causationFrom(ctx context.Context) (causation, bool) {
+	if ctx == nil {
+		return causation{}, false
+	}
+	c, ok := ctx.Value(causationKey).(causation)
+	return c, ok
+}
+
+// rateLimiter counts executions per key within a sliding window.
+type rateLimiter struct {
+	mu   sync.Mutex
+	hits map[string][]time.Time
+	// pruned is when the counters of keys without recent hits were last dropped
+	pruned time.Time
+}
+
+// rateLimit caps the hits of one key within the window. A limit of zero is unlimited.
+type rateLimit struct {
+	key   string
+	limit int
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{hits: make(map[string][]time.Time)}
+}
+
+// allow returns the index of the first limit that has no room left, or -1 when all of them have room. Hits are
+// only recorded when every limit has room, so a rejected execution does not count against any of them.
+func (l *rateLimiter) allow(now time.Time, limits ...rateLimit) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-rateLimitWindow)
+	// Every record a rule fires on gets a key, so keys without recent hits are dropped, once per window
+	if now.Sub(l.pruned) >= rateLimitWindow {
+		for key, hits := range l.hits {
+			if len(hits) == 0 || !hits[len(hits)-1].After(cutoff) {
+				delete(l.hits, key)
+			}
+		}
+		l.pruned = now
+	}
+
+	for i, limit := range limits {
+		if limit.limit <= 0 {
+			continue
+		}
+		recent := l.hits[limit.key][:0]
+		for _, hit := range l.hits[limit.key] {
+			if hit.After(cutoff) {
+				recent = append(recent, hit)
+			}
+		}
+		if len(recent) == 0 {
+			delete(l.hits, limit.key)
+		} else {
+			l.hits[limit.key] = recent
+		}
+		if len(recent) >= limit.limit {
+			return i
+		}
+	}
+
+	for _, limit := range limits {
+		if limit.limit > 0 {
+			l.hits[limit.key] = append(l.hits[limit.key], now)
+		}
+	}
+	return -1
+}
+
+// reset drops all counters whose key starts with prefix.
+func (l *rateLimiter) reset(prefix string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key := range l.hits {
+		if strings.HasPrefix(key, prefix) {
+			delete(l.hits, key)
+		}
+	}
+}
+
+// checkLimits returns a reason when running the rule for the event would exceed a safety limit.
+func (e *Engine) checkLimits(rule *models.WorkflowRule, event Event) string {
+	if e.config.MaxChainDepth > 0 && event.Depth > e.config.MaxChainDepth {
+		return fmt.Sprintf("workflow chain depth %d exceeded the limit of %d", event.Depth, e.config.MaxChainDepth)
+	}
+
+	perMinute := rule.MaxExecutionsPerMinute
+	if perMinute == 0 {
+		perMinute = e.config.DefaultMaxExecutionsPerMinute
+	}
+	limits := []rateLimit{{key: ruleLimitKey(rule.ID), limit: perMinute}}
+
+	perEntity := rule.MaxExecutionsPerEntity
+	if perEntity == 0 {
+		perEntity = e.config.DefaultMaxExecutionsPerEntity
+	}
+	if event.PrimaryKey != nil {
+		limits = append(limits, rateLimit{key: fmt.Sprintf("%s%v", ruleLimitKey(rule.ID), event.PrimaryKey), limit: perEntity})
+	}
+
+	switch e.limiter.allow(time.Now().UTC(), limits...) {
+	case 0:
+		return fmt.Sprintf("rule exceeded %d executions per minute", perMinute)
+	case 1:
+		return fmt.Sprintf("rule exceeded %d executions per minute for %s %v", perEntity, event.ModelName, event.PrimaryKey)
+	}
+	return ""
+}
+
+// disableRule deactivates a rule and records why. UpdateColumns skips the rule's save hooks,
+// which would otherwise clear the reason again.
+func (e *Engine) disableRule(rule *models.WorkflowRule, reason string) {
+	now := time.Now().UTC()
+	if err := e.db.Model(&models.WorkflowRule{}).Where("id = ?", rule.ID).UpdateColumns(map[string]interface{}{
+		"is_active":       false,
+		"disabled_reason": reason,
+		"disabled_at":     now,
+	}).Error; err != nil {
+		log.Printf("workflow engine failed to disable rule %d: %v", rule.ID, err)
+		return
+	}
+
+	rule.IsActive = false
+	rule.DisabledReason = reason
+	rule.DisabledAt = &now
+	e.limiter.reset(ruleLimitKey(rule.ID))
+	log.Printf("workflow rule %d disabled: %s", rule.ID, reason)
+}
+
+func ruleLimitKey(ruleID uint) string {
+	return fmt.Sprintf("rule:%d:", ruleID)
+}
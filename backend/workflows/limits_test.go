@@ -0,0 +1,39 @@
+package workflows
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRecordsOnlyAllowedHits(t *testing.T) {
+	limiter := newRateLimiter()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	rule := rateLimit{key: "rule:1:", limit: 2}
+
+	if got := limiter.allow(now, rule, rateLimit{key: "rule:1:7", limit: 1}); got != -1 {
+		t.Fatalf("first execution rejected by limit %d", got)
+	}
+	if got := limiter.allow(now, rule, rateLimit{key: "rule:1:7", limit: 1}); got != 1 {
+		t.Fatalf("second execution for the same record returned %d, want the per-entity limit 1", got)
+	}
+	// The rejected execution must not have used the second per-rule slot
+	if got := limiter.allow(now, rule, rateLimit{key: "rule:1:8", limit: 1}); got != -1 {
+		t.Fatalf("execution for another record rejected by limit %d", got)
+	}
+	if got := limiter.allow(now, rule, rateLimit{key: "rule:1:9", limit: 1}); got != 0 {
+		t.Fatalf("third execution of the rule returned %d, want the per-rule limit 0", got)
+	}
+}
+
+func TestRateLimiterDropsQuietKeys(t *testing.T) {
+	limiter := newRateLimiter()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		limiter.allow(now, rateLimit{key: "rule:1:" + string(rune('a'+i)), limit: 5})
+	}
+
+	limiter.allow(now.Add(2*rateLimitWindow), rateLimit{key: "rule:2:", limit: 5})
+	if len(limiter.hits) != 1 {
+		t.Fatalf("limiter keeps %d keys, want only the recent one", len(limiter.hits))
+	}
+}
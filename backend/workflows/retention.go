@@ -0,0 +1,269 @@
+package workflows
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nlstn/my-crm/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const pruneBatchSize = 500
+
+// ErrArchiveDirNotConfigured is returned when a policy requests archival but WORKFLOW_ARCHIVE_DIR is unset.
+var ErrArchiveDirNotConfigured = errors.New("workflow archive directory is not configured")
+
+// PruneResult reports the outcome of applying a retention policy.
+type PruneResult struct {
+	PolicyID    uint      `json:"PolicyID"`
+	Cutoff      time.Time `json:"Cutoff"`
+	Pruned      int       `json:"Pruned"`
+	ArchiveFile string    `json:"ArchiveFile,omitempty"`
+}
+
+func (e *Engine) monitorRetention() {
+	if e.config.RetentionInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(e.config.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.applyRetentionPolicies()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+func (e *Engine) applyRetentionPolicies() {
+	var policies []models.WorkflowRetentionPolicy
+	if err := e.db.Where("is_active = ?", true).Order("id ASC").Find(&policies).Error; err != nil {
+		log.Printf("workflow engine failed to load retention policies: %v", err)
+		return
+	}
+
+	for i := range policies {
+		result, err := e.PruneExecutions(context.Background(), &policies[i])
+		if err != nil {
+			log.Printf("workflow retention policy %d failed: %v", policies[i].ID, err)
+			continue
+		}
+		if result.Pruned > 0 {
+			log.Printf("workflow retention policy %d pruned %d executions", policies[i].ID, result.Pruned)
+		}
+	}
+}
+
+// PruneExecutions deletes executions older than the policy's retention window, archiving them first when requested.
+// The latest successful execution per rule and entity is always kept because it drives duplicate suppression.
+func (e *Engine) PruneExecutions(ctx context.Context, policy *models.WorkflowRetentionPolicy) (*PruneResult, error) {
+	now := time.Now().UTC()
+	result := &PruneResult{
+		PolicyID: policy.ID,
+		Cutoff:   now.AddDate(0, 0, -policy.RetentionDays),
+	}
+
+	err := e.pruneExecutions(ctx, policy, result, now)
+	e.recordPolicyRun(policy, now, result, err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e *Engine) pruneExecutions(ctx context.Context, policy *models.WorkflowRetentionPolicy, result *PruneResult, now time.Time) (err error) {
+	if policy.Archive && e.config.ArchiveDir == "" {
+		return ErrArchiveDirNotConfigured
+	}
+
+	db := e.db.WithContext(WithoutEvents(ctx))
+
+	var archive *executionArchive
+	defer func() {
+		if archive == nil {
+			return
+		}
+		if closeErr := archive.close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+
+	for {
+		latestSucceeded := db.Model(&models.WorkflowExecution{}).
+			Select("MAX(id)").
+			Where("status = ?", models.WorkflowExecutionStatusSucceeded).
+			Group("workflow_rule_id, entity_id")
+
+		query := db.Where("created_at < ? AND id NOT IN (?)", result.Cutoff, latestSucceeded)
+		if policy.Status != "" {
+			query = query.Where("status = ?", policy.Status)
+		}
+
+		var batch []models.WorkflowExecution
+		if err := query.Order("id ASC").Limit(pruneBatchSize).Find(&batch).Error; err != nil {
+			return fmt.Errorf("load executions to prune: %w", err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if policy.Archive {
+			if archive == nil {
+				archive, err = createExecutionArchive(e.config.ArchiveDir, policy.ID, now)
+				if err != nil {
+					return err
+				}
+				result.ArchiveFile = archive.path
+			}
+			if err := archive.write(batch); err != nil {
+				return err
+			}
+		}
+
+		ids := make([]uint, len(batch))
+		for i, execution := range batch {
+			ids[i] = execution.ID
+		}
+		if err := db.Where("id IN ?", ids).Delete(&models.WorkflowExecution{}).Error; err != nil {
+			return fmt.Errorf("delete pruned executions: %w", err)
+		}
+		result.Pruned += len(batch)
+
+		if len(batch) < pruneBatchSize {
+			return nil
+		}
+	}
+}
+
+func (e *Engine) recordPolicyRun(policy *models.WorkflowRetentionPolicy, at time.Time, result *PruneResult, runErr error) {
+	errorMessage := ""
+	if runErr != nil {
+		errorMessage = runErr.Error()
+	}
+
+	updates := map[string]interface{}{
+		"last_run_at":       at,
+		"last_pruned_count": result.Pruned,
+		"last_archive_file": result.ArchiveFile,
+		"last_error":        errorMessage,
+	}
+	if err := e.db.WithContext(WithoutEvents(context.Background())).Model(&models.WorkflowRetentionPolicy{}).
+		Where("id = ?", policy.ID).UpdateColumns(updates).Error; err != nil {
+		log.Printf("workflow engine failed to record retention run for policy %d: %v", policy.ID, err)
+	}
+}
+
+// executionArchive writes executions as gzip compressed JSON lines.
+type executionArchive struct {
+	path    string
+	file    *os.File
+	gz      *gzip.Writer
+	encoder *json.Encoder
+}
+
+func createExecutionArchive(dir string, policyID uint, at time.Time) (*executionArchive, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create archive directory: %w", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("workflow-executions-policy-%d-%s.jsonl.gz", policyID, at.Format("20060102T150405Z")))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("create archive file: %w", err)
+	}
+
+	gz := gzip.NewWriter(file)
+	return &executionArchive{path: path, file: file, gz: gz, encoder: json.NewEncoder(gz)}, nil
+}
+
+func (a *executionArchive) write(executions []models.WorkflowExecution) error {
+	for _, execution := range executions {
+		if err := a.encoder.Encode(execution); err != nil {
+			return fmt.Errorf("archive execution %d: %w", execution.ID, err)
+		}
+	}
+	return nil
+}
+
+func (a *executionArchive) close() error {
+	if err := a.gz.Close(); err != nil {
+		a.file.Close()
+		return fmt.Errorf("finish archive: %w", err)
+	}
+	return a.file.Close()
+}
+
+// recordStatistic adds a completed execution to the rule's aggregate counters.
+func (e *Engine) recordStatistic(ruleID uint, status models.WorkflowExecutionStatus, at time.Time) {
+	statistic := models.WorkflowRuleStatistic{
+		WorkflowRuleID: ruleID,
+		LastStatus:     status,
+		LastRunAt:      &at,
+	}
+	updates := map[string]interface{}{
+		"last_status": status,
+		"last_run_at": at,
+		"updated_at":  at,
+	}
+
+	switch status {
+	case models.WorkflowExecutionStatusSucceeded:
+		statistic.SucceededCount = 1
+		statistic.LastSucceededAt = &at
+		updates["succeeded_count"] = gorm.Expr("workflow_rule_statistics.succeeded_count + 1")
+		updates["last_succeeded_at"] = at
+	case models.WorkflowExecutionStatusFailed:
+		statistic.FailedCount = 1
+		statistic.LastFailedAt = &at
+		updates["failed_count"] = gorm.Expr("workflow_rule_statistics.failed_count + 1")
+		updates["last_failed_at"] = at
+	default:
+		return
+	}
+
+	if err := e.db.WithContext(WithoutEvents(context.Background())).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "workflow_rule_id"}},
+		DoUpdates: clause.Assignments(updates),
+	}).Create(&statistic).Error; err != nil {
+		log.Printf("workflow engine failed to update statistics for rule %d: %v", ruleID, err)
+	}
+}
+
+// initializeStatistics builds aggregate rows for rules whose executions predate the statistics table.
+func (e *Engine) initializeStatistics() {
+	err := e.db.Exec(`
+		INSERT INTO workflow_rule_statistics
+			(workflow_rule_id, succeeded_count, failed_count, last_run_at, last_succeeded_at, last_failed_at, updated_at)
+		SELECT workflow_rule_id,
+			COUNT(*) FILTER (WHERE status = ?),
+			COUNT(*) FILTER (WHERE status = ?),
+			MAX(completed_at),
+			MAX(completed_at) FILTER (WHERE status = ?),
+			MAX(completed_at) FILTER (WHERE status = ?),
+			NOW()
+		FROM workflow_executions
+		WHERE status IN ? AND workflow_rule_id NOT IN (SELECT workflow_rule_id FROM workflow_rule_statistics)
+		GROUP BY workflow_rule_id
+		ON CONFLICT (workflow_rule_id) DO NOTHING`,
+		models.WorkflowExecutionStatusSucceeded,
+		models.WorkflowExecutionStatusFailed,
+		models.WorkflowExecutionStatusSucceeded,
+		models.WorkflowExecutionStatusFailed,
+		[]models.WorkflowExecutionStatus{models.WorkflowExecutionStatusSucceeded, models.WorkflowExecutionStatusFailed},
+	).Error
+	if err != nil {
+		log.Printf("workflow engine failed to initialize rule statistics: %v", err)
+	}
+}
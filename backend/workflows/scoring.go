@@ -0,0 +1,285 @@
+package workflows
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/nlstn/my-crm/backend/models"
+)
+
+const leadScoreBatchSize = 500
+
+// ScoredActivity is the part of an activity lead scoring rules look at.
+type ScoredActivity struct {
+	LeadID       uint
+	ActivityType string
+	ActivityTime time.Time
+}
+
+// ScoreLead returns the score of a lead under the given rules at now, and the reason listing the rules that
+// contributed to it. activities are the lead's activities.
+func ScoreLead(rules []models.LeadScoringRule, lead *models.Lead, activities []ScoredActivity, now time.Time) (int, string) {
+	score := 0
+	var reasons []string
+	for i := range rules {
+		rule := &rules[i]
+		switch rule.Criterion {
+		case models.LeadScoringFieldValue:
+			if matchesLeadField(rule, lead) {
+				score += rule.Points
+				reasons = append(reasons, fmt.Sprintf("%s %+d", rule.Name, rule.Points))
+			}
+		case models.LeadScoringEmailDomain:
+			if matchesEmailDomain(rule.Value, lead.Email) {
+				score += rule.Points
+				reasons = append(reasons, fmt.Sprintf("%s %+d", rule.Name, rule.Points))
+			}
+		case models.LeadScoringActivityType, models.LeadScoringRecentActivity:
+			points, count := activityPoints(rule, activities, now)
+			if points != 0 {
+				score += points
+				reasons = append(reasons, fmt.Sprintf("%s %+d (%d activities)", rule.Name, points, count))
+			}
+		}
+	}
+	return score, strings.Join(reasons, "; ")
+}
+
+func matchesLeadField(rule *models.LeadScoringRule, lead *models.Lead) bool {
+	var value string
+	switch rule.Field {
+	case "Source":
+		value = lead.Source
+	case "Title":
+		value = lead.Title
+	case "Company":
+		value = lead.Company
+	case "Website":
+		value = lead.Website
+	case "Email":
+		value = lead.Email
+	case "Phone":
+		value = lead.Phone
+	case "Status":
+		value = string(lead.Status)
+	default:
+		return false
+	}
+
+	value = strings.ToLower(strings.TrimSpace(value))
+	expected := strings.ToLower(strings.TrimSpace(rule.Value))
+	switch rule.Operator {
+	case models.LeadScoringPresent:
+		return value != ""
+	case models.LeadScoringContains:
+		return expected != "" && strings.Contains(value, expected)
+	default:
+		return expected != "" && value == expected
+	}
+}
+
+// matchesEmailDomain reports whether an email address is at domain or one of its subdomains.
+func matchesEmailDomain(domain, email string) bool {
+	domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+	at := strings.LastIndex(email, "@")
+	if domain == "" || at < 0 {
+		return false
+	}
+	emailDomain := strings.ToLower(strings.TrimSpace(email[at+1:]))
+	return emailDomain == domain || strings.HasSuffix(emailDomain, "."+domain)
+}
+
+// activityPoints returns the rounded points an activity rule awards for the given activities, and how many of
+// them matched.
+func activityPoints(rule *models.LeadScoringRule, activities []ScoredActivity, now time.Time) (int, int) {
+	total := 0.0
+	count := 0
+	for _, activity := range activities {
+		if rule.Criterion == models.LeadScoringActivityType &&
+			!strings.EqualFold(strings.TrimSpace(activity.ActivityType), strings.TrimSpace(rule.Value)) {
+			continue
+		}
+
+		ageDays := now.Sub(activity.ActivityTime).Hours() / 24
+		if ageDays < 0 {
+			ageDays = 0
+		}
+		if rule.WindowDays > 0 && ageDays > float64(rule.WindowDays) {
+			continue
+		}
+
+		points := float64(rule.Points)
+		if rule.HalfLifeDays > 0 {
+			points *= math.Pow(0.5, ageDays/float64(rule.HalfLifeDays))
+		}
+		total += points
+		count++
+	}
+
+	if rule.MaxPoints > 0 && math.Abs(total) > float64(rule.MaxPoints) {
+		total = math.Copysign(float64(rule.MaxPoints), total)
+	}
+	return int(math.Round(total)), count
+}
+
+// RescoreLeads recalculates the scores of the leads with the given IDs, or of every lead when ids is nil, and
+// stores the ones that changed. It returns how many leads changed.
+func (e *Engine) RescoreLeads(ctx context.Context, ids []uint) (int, error) {
+	db := e.db.WithContext(WithoutEvents(ctx))
+
+	var rules []models.LeadScoringRule
+	if err := db.Where("is_active = ?", true).Order("id ASC").Find(&rules).Error; err != nil {
+		return 0, fmt.Errorf("load lead scoring rules: %w", err)
+	}
+	usesActivities := false
+	for _, rule := range rules {
+		if rule.Criterion == models.LeadScoringActivityType || rule.Criterion == models.LeadScoringRecentActivity {
+			usesActivities = true
+		}
+	}
+
+	now := time.Now().UTC()
+	changed := 0
+	var lastID uint
+	for {
+		var leads []models.Lead
+		query := db.Order("id ASC").Limit(leadScoreBatchSize)
+		if ids != nil {
+			if len(ids) == 0 {
+				break
+			}
+			batch := ids
+			if len(batch) > leadScoreBatchSize {
+				batch = batch[:leadScoreBatchSize]
+			}
+			ids = ids[len(batch):]
+			query = query.Where("id IN ?", batch)
+		} else {
+			query = query.Where("id > ?", lastID)
+		}
+		if err := query.Find(&leads).Error; err != nil {
+			return changed, fmt.Errorf("load leads: %w", err)
+		}
+		if len(leads) == 0 {
+			if ids == nil {
+				break
+			}
+			continue
+		}
+		lastID = leads[len(leads)-1].ID
+
+		activities := make(map[uint][]ScoredActivity)
+		if usesActivities {
+			leadIDs := make([]uint, len(leads))
+			for i := range leads {
+				leadIDs[i] = leads[i].ID
+			}
+			var rows []ScoredActivity
+			if err := db.Model(&models.Activity{}).Select("lead_id", "activity_type", "activity_time").
+				Where("lead_id IN ?", leadIDs).Find(&rows).Error; err != nil {
+				return changed, fmt.Errorf("load lead activities: %w", err)
+			}
+			for _, row := range rows {
+				activities[row.LeadID] = append(activities[row.LeadID], row)
+			}
+		}
+
+		for i := range leads {
+			lead := &leads[i]
+			score, reason := ScoreLead(rules, lead, activities[lead.ID], now)
+			if score == lead.Score && reason == lead.ScoreReason {
+				continue
+			}
+			// UpdateColumns leaves UpdatedAt alone, the lead itself did not change
+			if err := db.Model(&models.Lead{}).Where("id = ?", lead.ID).
+				UpdateColumns(map[string]interface{}{"score": score, "score_reason": reason}).Error; err != nil {
+				return changed, fmt.Errorf("store score of lead %d: %w", lead.ID, err)
+			}
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// rescoreForEvent recalculates the scores affected by a change: of a lead when it or one of its activities
+// changed, and of every lead when a scoring rule changed.
+func (e *Engine) rescoreForEvent(event Event) {
+	var ids []uint
+	switch event.ModelName {
+	case "Lead":
+		if event.Type == EventTypeDeleted {
+			return
+		}
+		if id, ok := uintFromState(event.PrimaryKey); ok {
+			ids = append(ids, id)
+		}
+	case "Activity":
+		for _, state := range []map[string]interface{}{event.OldState, event.NewState} {
+			if id, ok := uintFromState(state["LeadID"]); ok && !containsUint(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	case "LeadScoringRule":
+		if _, err := e.RescoreLeads(context.Background(), nil); err != nil {
+			log.Printf("workflow engine failed to rescore leads: %v", err)
+		}
+		return
+	default:
+		return
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+	if _, err := e.RescoreLeads(context.Background(), ids); err != nil {
+		log.Printf("workflow engine failed to rescore leads %v: %v", ids, err)
+	}
+}
+
+// monitorLeadScores rescores every lead on startup, which covers leads created while the engine was not running,
+// and then every LeadScoreInterval.
+func (e *Engine) monitorLeadScores() {
+	if e.config.LeadScoreInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(e.config.LeadScoreInterval)
+	defer ticker.Stop()
+
+	for {
+		changed, err := e.RescoreLeads(context.Background(), nil)
+		if err != nil {
+			log.Printf("workflow engine failed to rescore leads: %v", err)
+		} else if changed > 0 {
+			log.Printf("workflow engine rescored %d leads", changed)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// scoredModel reports whether changes to a model can change lead scores.
+func scoredModel(name string) bool {
+	switch name {
+	case "Lead", "Activity", "LeadScoringRule":
+		return true
+	}
+	return false
+}
+
+func containsUint(values []uint, value uint) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -89,14 +89,24 @@ interface ConvertLeadActionResult {
   LeadID: number
   AccountID: number
   ContactID: number
+  OpportunityID?: number | null
   AccountReused: boolean
   ContactReused: boolean
+  ActivitiesMoved: number
+  TasksMoved: number
 }
 
 type ConvertLeadActionPayload = {
   AccountName?: string
   ExistingAccountID?: number
   ExistingContactID?: number
+  OnDuplicate?: 'Create' | 'Fail' | 'Link'
+  CreateOpportunity?: boolean
+  OpportunityName?: string
+  OpportunityAmount?: number
+  ExpectedCloseDate?: string
+  OpportunityStage?: 'Prospecting' | 'Qualification' | 'NeedsAnalysis' | 'Proposal' | 'Negotiation'
+  MigrateHistory?: boolean
 }
 
 export function useConvertLead(id: string) {
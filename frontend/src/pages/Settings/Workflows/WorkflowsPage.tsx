@@ -444,6 +444,9 @@ export default function WorkflowSettingsPage() {
                         >
                           {rule.IsActive ? 'Active' : 'Inactive'}
                         </span>
+                        {!rule.IsActive && rule.DisabledReason && (
+                          <div className="mt-1 text-xs text-error-600 dark:text-error-400">{rule.DisabledReason}</div>
+                        )}
                       </td>
                       <td className="px-4 py-3 text-right">
                         <div className="flex justify-end gap-2">
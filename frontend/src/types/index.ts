@@ -71,10 +71,13 @@ export interface Lead {
   Source?: string
   Status: LeadStatus
   Notes?: string
+  DisqualificationReason?: string
   OwnerEmployeeID?: number
   ConvertedAccountID?: number
   ConvertedContactID?: number
   ConvertedAt?: string
+  Score: number
+  ScoreReason?: string
   CreatedAt: string
   UpdatedAt: string
   ConvertedAccount?: Account
@@ -82,6 +85,47 @@ export interface Lead {
   OwnerEmployee?: Employee
   Activities?: Activity[]
   Tasks?: Task[]
+  StatusHistory?: LeadStatusHistory[]
+}
+
+export interface LeadStatusHistory {
+  ID: number
+  LeadID: number
+  Status: LeadStatus
+  PreviousStatus?: LeadStatus | null
+  Reason?: string
+  ChangedAt: string
+  ChangedByEmployeeID?: number
+  ChangedBy?: Employee
+}
+
+export type WebFormLeadField = 'Name' | 'Email' | 'Phone' | 'Company' | 'Title' | 'Website' | 'Source' | 'Notes'
+
+export interface WebFormField {
+  ID: number
+  WebFormID: number
+  FormField: string
+  LeadField: WebFormLeadField
+  Required: boolean
+  CreatedAt: string
+  UpdatedAt: string
+}
+
+export interface WebForm {
+  ID: number
+  Name: string
+  Description?: string
+  Key: string
+  DefaultSource?: string
+  OwnerEmployeeID?: number
+  HoneypotField?: string
+  MaxSubmissionsPerMinute: number
+  RedirectURL?: string
+  IsActive: boolean
+  CreatedAt: string
+  UpdatedAt: string
+  Fields?: WebFormField[]
+  OwnerEmployee?: Employee
 }
 
 export interface Issue {
@@ -220,12 +264,162 @@ export interface Employee {
   Phone?: string
   Department?: string
   Position?: string
+  Territory?: string
   HireDate?: string
   Notes?: string
   CreatedAt: string
   UpdatedAt: string
 }
 
+export type AssignmentStrategy = 'RoundRobin' | 'LeastOpenWorkload' | 'Territory'
+
+export interface AssignmentRule {
+  ID: number
+  Name: string
+  Description?: string
+  EntityType: 'Lead' | 'Account' | 'Issue'
+  SortOrder: number
+  Strategy: AssignmentStrategy
+  Source?: string
+  Country?: string
+  Industry?: string
+  IssuePriority?: number | null
+  EmployeeIDs: number[]
+  LastAssignedEmployeeID?: number | null
+  IsActive: boolean
+  CreatedAt: string
+  UpdatedAt: string
+}
+
+export type ImportJobStatus = 'Pending' | 'Running' | 'Succeeded' | 'Failed' | 'Cancelled'
+
+export interface ImportJob {
+  ID: number
+  EntitySet: string
+  FileName?: string
+  Mode: 'insert' | 'update' | 'upsert'
+  MatchKey?: string
+  SkipInvalidRows: boolean
+  CreateMissingTags: boolean
+  ImportMappingID?: number | null
+  Status: ImportJobStatus
+  CancelRequested: boolean
+  TotalRows: number
+  ProcessedRows: number
+  InsertedRows: number
+  UpdatedRows: number
+  UnchangedRows: number
+  ErrorCount: number
+  ErrorReport?: string
+  LastError?: string
+  StartedAt?: string | null
+  FinishedAt?: string | null
+  CreatedAt: string
+  UpdatedAt: string
+}
+
+export interface ImportMappingColumn {
+  ID: number
+  ImportMappingID: number
+  SourceColumn?: string
+  TargetField: string
+  Constant?: string
+  Transforms?: string
+  DateFormat?: string
+  CreatedAt: string
+  UpdatedAt: string
+}
+
+export interface ImportMapping {
+  ID: number
+  Name: string
+  Description?: string
+  EntitySet: string
+  Columns?: ImportMappingColumn[]
+  CreatedAt: string
+  UpdatedAt: string
+}
+
+export interface ExternalReference {
+  ID: number
+  SourceSystem: string
+  EntitySet: string
+  ExternalID: string
+  EntityID: number
+  CreatedAt: string
+  UpdatedAt: string
+}
+
+export type DuplicateEntityType = 'Account' | 'Contact' | 'Lead'
+export type DuplicateMatchMethod = 'Exact' | 'Fuzzy'
+
+export interface DuplicateRule {
+  ID: number
+  Name: string
+  EntityType: DuplicateEntityType
+  Field: string
+  Method: DuplicateMatchMethod
+  Threshold: number
+  IsActive: boolean
+  CreatedAt: string
+  UpdatedAt: string
+}
+
+export type DuplicateCandidateStatus = 'Open' | 'Dismissed' | 'Merged'
+
+export interface DuplicateCandidate {
+  ID: number
+  EntityType: DuplicateEntityType
+  RecordID: number
+  DuplicateID: number
+  Score: number
+  Reasons?: string
+  Status: DuplicateCandidateStatus
+  DetectedAt: string
+  ReviewedAt?: string
+  CreatedAt: string
+  UpdatedAt: string
+}
+
+export interface DuplicateMatch {
+  EntityType: DuplicateEntityType
+  ID: number
+  Name: string
+  Score: number
+  Fields: string[]
+  Reasons: string[]
+}
+
+export interface AuditEntry {
+  ID: number
+  EntityType: string
+  EntityID: number
+  Action: 'Merge'
+  RelatedID?: number
+  Summary?: string
+  Details?: string
+  CreatedAt: string
+}
+
+export type LeadScoringCriterion = 'FieldValue' | 'EmailDomain' | 'ActivityType' | 'RecentActivity'
+
+export interface LeadScoringRule {
+  ID: number
+  Name: string
+  Description?: string
+  Criterion: LeadScoringCriterion
+  Field?: string
+  Operator: 'Equals' | 'Contains' | 'Present'
+  Value?: string
+  Points: number
+  WindowDays: number
+  HalfLifeDays: number
+  MaxPoints: number
+  IsActive: boolean
+  CreatedAt: string
+  UpdatedAt: string
+}
+
 export interface Product {
   ID: number
   Name: string
@@ -254,6 +448,38 @@ export interface WorkflowRule {
   ActionType: WorkflowActionType
   ActionConfig?: Record<string, unknown>
   IsActive: boolean
+  MaxExecutionsPerMinute?: number
+  MaxExecutionsPerEntity?: number
+  DisabledReason?: string
+  DisabledAt?: string
+  CreatedAt: string
+  UpdatedAt: string
+  Statistics?: WorkflowRuleStatistic
+}
+
+export interface WorkflowRuleStatistic {
+  WorkflowRuleID: number
+  SucceededCount: number
+  FailedCount: number
+  LastStatus?: WorkflowExecution['Status']
+  LastRunAt?: string
+  LastSucceededAt?: string
+  LastFailedAt?: string
+  UpdatedAt: string
+}
+
+export interface WorkflowRetentionPolicy {
+  ID: number
+  Name: string
+  Description?: string
+  Status?: WorkflowExecution['Status'] | ''
+  RetentionDays: number
+  Archive: boolean
+  IsActive: boolean
+  LastRunAt?: string
+  LastPrunedCount: number
+  LastArchiveFile?: string
+  LastError?: string
   CreatedAt: string
   UpdatedAt: string
 }
@@ -270,6 +496,8 @@ export interface WorkflowExecution {
   ResultSummary?: string
   ErrorMessage?: string
   EventPayload?: Record<string, unknown>
+  ChainDepth?: number
+  CausationExecutionID?: number
   CreatedAt: string
   CompletedAt?: string
   WorkflowRule?: WorkflowRule